@@ -0,0 +1,86 @@
+// Package cmdline adds command-line options to a GApplication, which parses
+// them along with its own options, such as --help.
+package cmdline
+
+// #cgo pkg-config: gio-2.0
+// #include <gio/gio.h>
+// #include <stdlib.h>
+//
+// static void add_option(GApplication *app, gchar *name, GOptionArg arg,
+//                        gpointer data, gchar *description,
+//                        gchar *arg_description) {
+//     GOptionEntry entries[2] = {{0}};
+//     entries[0].long_name = name;
+//     entries[0].arg = arg;
+//     entries[0].arg_data = data;
+//     entries[0].description = description;
+//     entries[0].arg_description = arg_description;
+//     g_application_add_main_option_entries(app, entries);
+// }
+import "C"
+
+import (
+	"github.com/gotk3/gotk3/glib"
+	"unsafe"
+)
+
+// StringOption is an option which takes a value, such as --config PATH.
+type StringOption struct {
+	value unsafe.Pointer
+}
+
+// FlagOption is an option which takes no value, such as --no-autoconnect.
+type FlagOption struct {
+	value unsafe.Pointer
+}
+
+// AddStringOption adds the option --name to the application. argDescription
+// names the option's value in the output of --help.
+func AddStringOption(app *glib.Application, name string, argDescription string,
+	description string) *StringOption {
+	option := &StringOption{value: C.calloc(1, C.sizeof_gpointer)}
+	addOption(app, name, C.G_OPTION_ARG_STRING, option.value, description,
+		argDescription)
+	return option
+}
+
+// AddFlagOption adds the option --name, which takes no value, to the
+// application.
+func AddFlagOption(app *glib.Application, name string,
+	description string) *FlagOption {
+	option := &FlagOption{value: C.calloc(1, C.sizeof_gboolean)}
+	addOption(app, name, C.G_OPTION_ARG_NONE, option.value, description, "")
+	return option
+}
+
+// Value returns the value given for the option, or an empty string if the
+// option was not given. Options are parsed before the application's
+// 'handle-local-options' signal is emitted.
+func (option *StringOption) Value() string {
+	value := *(**C.char)(option.value)
+	if value == nil {
+		return ""
+	}
+	return C.GoString(value)
+}
+
+// Set reports whether the option was given. Options are parsed before the
+// application's 'handle-local-options' signal is emitted.
+func (option *FlagOption) Set() bool {
+	return *(*C.gboolean)(option.value) != 0
+}
+
+// addOption adds an option storing its value in data. The strings describing
+// the option, and the storage for its value, are never freed, as the
+// application refers to them for as long as it runs.
+func addOption(app *glib.Application, name string, arg C.GOptionArg,
+	data unsafe.Pointer, description string, argDescription string) {
+	var cArgDescription *C.gchar
+	if argDescription != "" {
+		cArgDescription = (*C.gchar)(C.CString(argDescription))
+	}
+
+	C.add_option((*C.GApplication)(unsafe.Pointer(app.Native())),
+		(*C.gchar)(C.CString(name)), arg, C.gpointer(data),
+		(*C.gchar)(C.CString(description)), cArgDescription)
+}
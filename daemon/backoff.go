@@ -0,0 +1,42 @@
+package daemon
+
+import "time"
+
+// Backoff computes the delays between successive attempts to reach the
+// daemon. Each delay is double the previous one, starting at Initial and
+// capped at Max.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+
+	attempts int
+}
+
+// NewBackoff creates a Backoff with the given initial and maximum delays.
+func NewBackoff(initial time.Duration, max time.Duration) *Backoff {
+	return &Backoff{Initial: initial, Max: max}
+}
+
+// Next returns the delay before the next attempt, and records the attempt.
+func (b *Backoff) Next() time.Duration {
+	delay := b.Initial
+	for i := 0; i < b.attempts && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+
+	b.attempts++
+	return delay
+}
+
+// Attempts returns the number of attempts recorded since the last Reset.
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
+
+// Reset restarts the sequence of delays from Initial.
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
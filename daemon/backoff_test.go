@@ -0,0 +1,55 @@
+package daemon_test
+
+import (
+	"main/daemon"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := daemon.NewBackoff(2*time.Second, 60*time.Second)
+
+	want := []time.Duration{
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		16 * time.Second,
+		32 * time.Second,
+		// The delay is capped at the maximum
+		60 * time.Second,
+		60 * time.Second,
+	}
+	for i, delay := range want {
+		if got := b.Next(); got != delay {
+			t.Errorf("attempt %d: got delay %v, want %v", i+1, got, delay)
+		}
+		if attempts := b.Attempts(); attempts != i+1 {
+			t.Errorf("got %d attempts, want %d", attempts, i+1)
+		}
+	}
+
+	b.Reset()
+	if attempts := b.Attempts(); attempts != 0 {
+		t.Errorf("got %d attempts after Reset, want none", attempts)
+	}
+	if got := b.Next(); got != 2*time.Second {
+		t.Errorf("got delay %v after Reset, want %v", got, 2*time.Second)
+	}
+}
+
+func TestBackoffCapsLongSequences(t *testing.T) {
+	b := daemon.NewBackoff(time.Second, time.Minute)
+	for i := 0; i < 1000; i++ {
+		b.Next()
+	}
+	if got := b.Next(); got != time.Minute {
+		t.Errorf("got delay %v, want %v", got, time.Minute)
+	}
+}
+
+func TestBackoffInitialAboveMax(t *testing.T) {
+	b := daemon.NewBackoff(time.Minute, time.Second)
+	if got := b.Next(); got != time.Second {
+		t.Errorf("got delay %v, want %v", got, time.Second)
+	}
+}
@@ -0,0 +1,487 @@
+package daemon
+
+import (
+	"context"
+	"github.com/adamdb5/opennord"
+	"github.com/adamdb5/opennord/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"io"
+	"main/daemon/daemonerr"
+	"os"
+	"time"
+)
+
+// ConnectTimeout is the maximum amount of time a Connect stream may remain
+// open. Negotiating a VPN session can take considerably longer than a regular
+// request, so it is not bound by opennord.RequestTimeout.
+const ConnectTimeout = 2 * time.Minute
+
+// Client communicates with a NordVPN daemon listening on an arbitrary unix
+// socket. It mirrors the method set of opennord.Client, which is hardwired to
+// the system socket, except that Connect accepts a context so that a pending
+// connection can be cancelled.
+type Client struct {
+	grpcConnection *grpc.ClientConn
+	daemonClient   pb.DaemonClient
+}
+
+// NewClient creates a client for the daemon listening on the unix socket at
+// socketPath.
+func NewClient(socketPath string) (*Client, error) {
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, daemonerr.FromDialError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		opennord.RequestTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "unix://"+socketPath,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock())
+	if err != nil {
+		return nil, daemonerr.FromDialError(err)
+	}
+
+	return &Client{
+		grpcConnection: conn,
+		daemonClient:   pb.NewDaemonClient(conn),
+	}, nil
+}
+
+// Close closes the underlying gRPC connection.
+func (c *Client) Close() error {
+	return c.grpcConnection.Close()
+}
+
+// convertError classifies an error returned by a gRPC call. The resulting
+// error reports the daemon's message, matching the errors returned by
+// opennord.Client, but retains the status code via daemonerr.
+func convertError(err error) error {
+	return daemonerr.FromError(err)
+}
+
+// connectStream cancels the context of a Connect stream once the stream has
+// been fully consumed.
+type connectStream struct {
+	pb.Daemon_ConnectClient
+	cancel context.CancelFunc
+}
+
+// Recv receives the next message from the stream. io.EOF is returned once the
+// stream has been fully consumed.
+func (s connectStream) Recv() (*pb.ConnectResponse, error) {
+	msg, err := s.Daemon_ConnectClient.Recv()
+	if err == io.EOF {
+		s.cancel()
+		return nil, err
+	}
+	if err != nil {
+		s.cancel()
+		return nil, convertError(err)
+	}
+	return msg, nil
+}
+
+// AccountInfo calls the AccountInfo RPC and returns an AccountResponse.
+func (c *Client) AccountInfo() (*pb.AccountResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.AccountInfo(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return r, nil
+}
+
+// Cities calls the Cities RPC and returns a CitiesResponse.
+func (c *Client) Cities(country string) (*pb.CitiesResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.Cities(ctx, &pb.CitiesRequest{
+		Protocol:  pb.ProtocolEnum_UDP,
+		Obfuscate: false,
+		Country:   country,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if r.GetType() != opennord.ErrOk {
+		return nil, errUnknown()
+	}
+	return r, nil
+}
+
+// Connect calls the Connect RPC and returns a stream of ConnectResponse.
+// Cancelling ctx aborts the stream.
+func (c *Client) Connect(ctx context.Context, req *pb.ConnectRequest) (
+	pb.Daemon_ConnectClient, error) {
+	ctx, cancel := context.WithTimeout(ctx, ConnectTimeout)
+
+	r, err := c.daemonClient.Connect(ctx, req)
+	if err != nil {
+		cancel()
+		return nil, convertError(err)
+	}
+	return connectStream{Daemon_ConnectClient: r, cancel: cancel}, nil
+}
+
+// Countries calls the Countries RPC and returns a CountriesResponse.
+func (c *Client) Countries() (*pb.CountriesResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.Countries(ctx, &pb.CountriesRequest{
+		Protocol:  pb.ProtocolEnum_UDP,
+		Obfuscate: false,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return r, nil
+}
+
+// Disconnect calls the Disconnect RPC and terminates the current VPN session.
+func (c *Client) Disconnect() error {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	_, err := c.daemonClient.Disconnect(ctx, &pb.DisconnectRequest{Id: 0})
+	if err != nil {
+		return convertError(err)
+	}
+	return nil
+}
+
+// FrontendCountries calls the FrontendCountries RPC and returns a
+// FrontendCountriesResponse.
+func (c *Client) FrontendCountries() (*pb.FrontendCountriesResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.FrontendCountries(ctx, &pb.CountriesRequest{
+		Protocol:  pb.ProtocolEnum_UDP,
+		Obfuscate: false,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return r, nil
+}
+
+// Groups calls the Groups RPC and returns a GroupsResponse.
+func (c *Client) Groups(req *pb.GroupsRequest) (*pb.GroupsResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.Groups(ctx, req)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return r, nil
+}
+
+// IsLoggedIn calls the IsLoggedIn RPC and returns a IsLoggedInResponse.
+func (c *Client) IsLoggedIn() (*pb.IsLoggedInResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.IsLoggedIn(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return r, nil
+}
+
+// Login calls the Login RPC.
+func (c *Client) Login(req *pb.LoginRequest) error {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.Login(ctx, req)
+	if err != nil {
+		return convertError(err)
+	}
+	if r.GetType() != opennord.ErrOk {
+		return errUnknown()
+	}
+	return nil
+}
+
+// LoginOAuth2 calls the LoginOAuth2 RPC.
+func (c *Client) LoginOAuth2() (*pb.LoginOAuth2Response, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.LoginOAuth2(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return r, nil
+}
+
+// Logout calls the Logout RPC.
+func (c *Client) Logout() error {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	_, err := c.daemonClient.Logout(ctx, &pb.LogoutRequest{Id: 0})
+	if err != nil {
+		return convertError(err)
+	}
+	return nil
+}
+
+// Plans calls the Plans RPC.
+func (c *Client) Plans() (*pb.PlansResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.Plans(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if r.GetType() != opennord.ErrOk {
+		return nil, errUnknown()
+	}
+	return r, nil
+}
+
+// Ping checks that the daemon is alive via the Ping RPC.
+func (c *Client) Ping() error {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.Ping(ctx, &emptypb.Empty{})
+	if err != nil {
+		return convertError(err)
+	}
+	if r.GetType() != opennord.ErrOk {
+		return errUnknown()
+	}
+	return nil
+}
+
+// RateConnection calls the RateConnection RPC.
+func (c *Client) RateConnection(req *pb.RateConnectionRequest) error {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.RateConnection(ctx, req)
+	if err != nil {
+		return convertError(err)
+	}
+	if r.GetType() != opennord.ErrOk {
+		return errUnknown()
+	}
+	return nil
+}
+
+// SetAutoConnect calls the SetAutoConnect RPC.
+func (c *Client) SetAutoConnect(req *pb.SetAutoConnectRequest) (*pb.Payload,
+	error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.SetAutoConnect(ctx, req)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if r.GetType() == opennord.StatusGenericError {
+		return nil, errAlreadySet("auto-connect already enabled / disabled")
+	}
+	if r.GetType() != opennord.StatusOk {
+		return nil, errUnknown()
+	}
+	return r, nil
+}
+
+// SetCyberSec calls the SetCyberSec RPC.
+func (c *Client) SetCyberSec(enabled bool) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetCyberSec(ctx,
+			&pb.SetCyberSecRequest{CyberSec: enabled})
+	}, "")
+}
+
+// SetDefaults calls the SetDefaults RPC.
+func (c *Client) SetDefaults() error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetDefaults(ctx, &emptypb.Empty{})
+	}, "")
+}
+
+// SetDns calls the SetDns RPC.
+func (c *Client) SetDns(req *pb.SetDNSRequest) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetDns(ctx, req)
+	}, "")
+}
+
+// SetFirewall calls the SetFirewall RPC.
+func (c *Client) SetFirewall(enabled bool) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetFirewall(ctx,
+			&pb.SetGenericRequest{Enabled: enabled})
+	}, "firewall already enabled / disabled")
+}
+
+// SetIpv6 calls the SetIpv6 RPC.
+func (c *Client) SetIpv6(enabled bool) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetIpv6(ctx,
+			&pb.SetGenericRequest{Enabled: enabled})
+	}, "IPv6 already enabled / disabled")
+}
+
+// SetKillSwitch calls the SetKillSwitch RPC.
+func (c *Client) SetKillSwitch(enabled bool) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetKillSwitch(ctx,
+			&pb.SetKillSwitchRequest{Enabled: enabled})
+	}, "kill switch already enabled / disabled")
+}
+
+// SetNotify calls the SetNotify RPC.
+func (c *Client) SetNotify(enabled bool) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetNotify(ctx, &pb.SetNotifyRequest{
+			Uid:    uint32(os.Getuid()),
+			Notify: enabled,
+		})
+	}, "")
+}
+
+// SetObfuscate calls the SetObfuscate RPC.
+func (c *Client) SetObfuscate(enabled bool) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetObfuscate(ctx,
+			&pb.SetGenericRequest{Enabled: enabled})
+	}, "")
+}
+
+// SetProtocol calls the SetProtocol RPC.
+func (c *Client) SetProtocol(protocol pb.ProtocolEnum) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetProtocol(ctx,
+			&pb.SetProtocolRequest{Protocol: protocol})
+	}, "")
+}
+
+// SetTechnology calls the SetTechnology RPC.
+func (c *Client) SetTechnology(technology pb.TechnologyEnum) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetTechnology(ctx,
+			&pb.SetTechnologyRequest{Technology: technology})
+	}, "technology already selected")
+}
+
+// SetWhitelist calls the SetWhitelist RPC.
+func (c *Client) SetWhitelist(req *pb.SetWhitelistRequest) error {
+	return c.setGeneric(func(ctx context.Context) (*pb.Payload, error) {
+		return c.daemonClient.SetWhitelist(ctx, req)
+	}, "")
+}
+
+// Settings calls the Settings RPC.
+func (c *Client) Settings() (*pb.SettingsResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.Settings(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if r.GetType() != opennord.StatusOk {
+		return nil, errUnknown()
+	}
+	return r, nil
+}
+
+// SettingsProtocols calls the SettingsProtocols RPC.
+func (c *Client) SettingsProtocols() (*pb.ProtocolsResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.SettingsProtocols(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if r.GetType() != opennord.StatusOk {
+		return nil, errUnknown()
+	}
+	return r, nil
+}
+
+// SettingsTechnologies calls the SettingsTechnologies RPC.
+func (c *Client) SettingsTechnologies() (*pb.TechnologyResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.SettingsTechnologies(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if r.GetType() != opennord.StatusOk {
+		return nil, errUnknown()
+	}
+	return r, nil
+}
+
+// Status calls the Status RPC and returns a StatusResponse.
+func (c *Client) Status() (*pb.StatusResponse, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := c.daemonClient.Status(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return r, nil
+}
+
+// setGeneric performs a settings RPC which returns a Payload. If
+// alreadySetMessage is not empty, a StatusGenericError response is reported
+// using that message.
+func (c *Client) setGeneric(call func(ctx context.Context) (*pb.Payload,
+	error), alreadySetMessage string) error {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	r, err := call(ctx)
+	if err != nil {
+		return convertError(err)
+	}
+	if alreadySetMessage != "" && r.GetType() == opennord.StatusGenericError {
+		return errAlreadySet(alreadySetMessage)
+	}
+	if r.GetType() != opennord.StatusOk {
+		return errUnknown()
+	}
+	return nil
+}
+
+// errUnknown returns the error reported when the daemon responds with an
+// unexpected payload type.
+func errUnknown() error {
+	return daemonerr.New(daemonerr.Unknown, "unknown error")
+}
+
+// errAlreadySet returns the error reported when a setting already has the
+// requested value.
+func errAlreadySet(message string) error {
+	return &daemonerr.Error{
+		Kind:    daemonerr.InvalidSetting,
+		Message: message,
+		Err:     daemonerr.ErrAlreadySet,
+	}
+}
+
+// requestContext returns a new context bound by opennord.RequestTimeout.
+func requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), opennord.RequestTimeout)
+}
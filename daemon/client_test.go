@@ -0,0 +1,206 @@
+package daemon_test
+
+import (
+	"errors"
+	"github.com/adamdb5/opennord/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"main/daemon"
+	"main/daemon/daemonerr"
+	"main/daemon/daemontest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newFakeDaemon starts a fake daemon and dials it with daemon.NewClient. Both
+// are closed when the test finishes.
+func newFakeDaemon(t *testing.T) (*daemontest.Server, *daemon.Client) {
+	t.Helper()
+	server, err := daemontest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	client, err := daemon.NewClient(server.SocketPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return server, client
+}
+
+func TestNewClientMissingSocket(t *testing.T) {
+	_, err := daemon.NewClient(filepath.Join(t.TempDir(), "nordvpnd.sock"))
+	if !errors.Is(err, daemonerr.ErrUnreachable) {
+		t.Errorf("got error %v, want the daemon to be unreachable", err)
+	}
+}
+
+func TestClientCannedResponses(t *testing.T) {
+	_, client := newFakeDaemon(t)
+
+	countries, err := client.Countries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Germany", "United_Kingdom"}
+	if !reflect.DeepEqual(countries.GetCountries(), want) {
+		t.Errorf("got countries %v, want %v", countries.GetCountries(), want)
+	}
+
+	cities, err := client.Cities("Germany")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"Berlin", "Frankfurt"}
+	if !reflect.DeepEqual(cities.GetCities(), want) {
+		t.Errorf("got cities %v, want %v", cities.GetCities(), want)
+	}
+
+	groups, err := client.Groups(&pb.GroupsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"P2P", "Standard_VPN_Servers"}
+	if !reflect.DeepEqual(groups.GetGroups(), want) {
+		t.Errorf("got groups %v, want %v", groups.GetGroups(), want)
+	}
+
+	account, err := client.AccountInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.GetEmail() != "user@example.com" {
+		t.Errorf("got email %q, want \"user@example.com\"",
+			account.GetEmail())
+	}
+
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.GetState() != "Disconnected" {
+		t.Errorf("got state %q, want \"Disconnected\"", status.GetState())
+	}
+}
+
+func TestClientSettings(t *testing.T) {
+	server, client := newFakeDaemon(t)
+
+	if err := client.SetKillSwitch(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetProtocol(pb.ProtocolEnum_TCP); err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := client.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settings.GetSettings().GetKillSwitch() {
+		t.Error("kill switch was not enabled")
+	}
+	server.Update(func(state *daemontest.State) {
+		if state.Protocol != pb.ProtocolEnum_TCP {
+			t.Errorf("got protocol %v, want TCP", state.Protocol)
+		}
+	})
+}
+
+func TestClientInjectedFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want *daemonerr.Error
+	}{
+		{
+			name: "not logged in",
+			err:  daemontest.ErrNotLoggedIn,
+			want: daemonerr.ErrNotLoggedIn,
+		},
+		{
+			name: "permission denied",
+			err:  status.Error(codes.PermissionDenied, "permission denied"),
+			want: daemonerr.ErrPermissionDenied,
+		},
+		{
+			name: "invalid setting",
+			err:  status.Error(codes.InvalidArgument, "invalid country"),
+			want: daemonerr.ErrInvalidSetting,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newFakeDaemon(t)
+			server.Fail("Countries", test.err)
+
+			if _, err := client.Countries(); !errors.Is(err, test.want) {
+				t.Errorf("got error %v, want %v", err, test.want.Kind)
+			}
+
+			// Other RPCs are unaffected
+			if _, err := client.Status(); err != nil {
+				t.Errorf("got error %v from Status, want none", err)
+			}
+
+			server.Fail("Countries", nil)
+			if _, err := client.Countries(); err != nil {
+				t.Errorf("got error %v once the failure was removed, "+
+					"want none", err)
+			}
+		})
+	}
+}
+
+func TestClientCalls(t *testing.T) {
+	server, client := newFakeDaemon(t)
+
+	for i := 0; i < 3; i++ {
+		if err := client.Ping(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server.Fail("Status", daemontest.ErrNotLoggedIn)
+	_, _ = client.Status()
+
+	calls := map[string]int{"Ping": 3, "Status": 1, "Countries": 0}
+	for rpc, want := range calls {
+		if got := server.Calls(rpc); got != want {
+			t.Errorf("got %d calls to %s, want %d", got, rpc, want)
+		}
+	}
+}
+
+func TestClientClassifiesErrors(t *testing.T) {
+	calls := map[string]func(client *daemon.Client) error{
+		"Countries": func(client *daemon.Client) error {
+			_, err := client.Countries()
+			return err
+		},
+		"Groups": func(client *daemon.Client) error {
+			_, err := client.Groups(&pb.GroupsRequest{})
+			return err
+		},
+		"IsLoggedIn": func(client *daemon.Client) error {
+			_, err := client.IsLoggedIn()
+			return err
+		},
+	}
+
+	for rpc, call := range calls {
+		t.Run(rpc, func(t *testing.T) {
+			server, client := newFakeDaemon(t)
+			server.Fail(rpc, status.Error(codes.Unavailable, "unavailable"))
+
+			err := call(client)
+			if kind := daemonerr.KindOf(err); kind != daemonerr.Unreachable {
+				t.Errorf("got error kind %v, want %v", kind,
+					daemonerr.Unreachable)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package daemon
+
+import (
+	"errors"
+	"github.com/adamdb5/opennord"
+	"github.com/adamdb5/opennord/pb"
+	"main/daemon/daemonerr"
+	"strings"
+)
+
+// ConnectEventType identifies the stage of a connection attempt described by
+// a ConnectEvent.
+type ConnectEventType int
+
+const (
+	// ConnectStarted is emitted once the daemon has accepted the request.
+	ConnectStarted ConnectEventType = iota
+	// ConnectServerChosen is emitted once the daemon has picked a server.
+	ConnectServerChosen
+	// ConnectConnecting is emitted while the tunnel is being negotiated.
+	ConnectConnecting
+	// ConnectConnected is emitted once the tunnel has been established.
+	ConnectConnected
+	// ConnectFailed is emitted if the connection attempt was unsuccessful.
+	ConnectFailed
+)
+
+// String returns a human-readable name for the event type.
+func (t ConnectEventType) String() string {
+	switch t {
+	case ConnectStarted:
+		return "Started"
+	case ConnectServerChosen:
+		return "Server Chosen"
+	case ConnectConnecting:
+		return "Connecting"
+	case ConnectConnected:
+		return "Connected"
+	case ConnectFailed:
+		return "Failed"
+	default:
+		return "Unknown"
+	}
+}
+
+// ConnectEvent describes a single stage of a connection attempt.
+type ConnectEvent struct {
+	Type ConnectEventType
+	// Server is the display name of the server, e.g. "Germany #123".
+	Server string
+	// Hostname is the hostname of the server, e.g. "de123.nordvpn.com".
+	Hostname string
+	// Reason describes why the attempt failed. It is only set for
+	// ConnectFailed events.
+	Reason string
+	// Err is the error which caused the attempt to fail, if any.
+	Err error
+}
+
+// ErrConnectInterrupted is reported when the Connect stream ends before the
+// daemon has reported either success or failure.
+var ErrConnectInterrupted = errors.New("the connection attempt ended unexpectedly")
+
+// ConnectParser turns the messages streamed by the Connect RPC into
+// ConnectEvents. A new parser must be used for each connection attempt.
+type ConnectParser struct {
+	started   bool
+	finished  bool
+	connected bool
+	server    string
+	hostname  string
+}
+
+// Parse returns the events described by a single streamed message.
+func (p *ConnectParser) Parse(msg *pb.ConnectResponse) []ConnectEvent {
+	if p.finished {
+		return nil
+	}
+
+	events := p.start()
+	messages := msg.GetMessages()
+
+	switch msgType := msg.GetType(); {
+	case msgType == opennord.StatusConnecting:
+		events = append(events, p.chooseServer(messages)...)
+		events = append(events, p.event(ConnectConnecting))
+	case msgType == opennord.StatusConnected:
+		events = append(events, p.chooseServer(messages)...)
+		events = append(events, p.event(ConnectConnected))
+		p.finished = true
+		p.connected = true
+	case msgType >= opennord.StatusGenericError:
+		reason := strings.Join(messages, " ")
+		if reason == "" {
+			reason = "unknown error"
+		}
+		err := daemonerr.FromMessage(reason)
+		events = append(events, p.fail(err.UserMessage(), err))
+	}
+
+	return events
+}
+
+// Fail returns the events describing an attempt terminated by err, which may
+// have been returned either by the Connect RPC itself or by the stream.
+func (p *ConnectParser) Fail(err error) []ConnectEvent {
+	if p.finished {
+		return nil
+	}
+
+	events := p.start()
+	return append(events, p.fail(daemonerr.UserMessage(err), err))
+}
+
+// Finish returns the events describing the end of the stream. If the daemon
+// did not report the outcome of the attempt, a failure is reported.
+func (p *ConnectParser) Finish() []ConnectEvent {
+	if p.finished {
+		return nil
+	}
+
+	return p.Fail(ErrConnectInterrupted)
+}
+
+// Connected reports whether the daemon has reported a successful connection.
+func (p *ConnectParser) Connected() bool {
+	return p.connected
+}
+
+// start returns the ConnectStarted event if it has not yet been emitted.
+func (p *ConnectParser) start() []ConnectEvent {
+	if p.started {
+		return nil
+	}
+
+	p.started = true
+	return []ConnectEvent{p.event(ConnectStarted)}
+}
+
+// chooseServer records the server described by messages, returning a
+// ConnectServerChosen event if it differs from the server already recorded.
+// The daemon sends the server's display name followed by its hostname.
+func (p *ConnectParser) chooseServer(messages []string) []ConnectEvent {
+	var server, hostname string
+	switch len(messages) {
+	case 0:
+		return nil
+	case 1:
+		server, hostname = messages[0], messages[0]
+	default:
+		server, hostname = messages[0], messages[1]
+	}
+
+	if server == p.server && hostname == p.hostname {
+		return nil
+	}
+
+	p.server = server
+	p.hostname = hostname
+	return []ConnectEvent{p.event(ConnectServerChosen)}
+}
+
+// fail marks the attempt as finished and returns a ConnectFailed event.
+func (p *ConnectParser) fail(reason string, err error) ConnectEvent {
+	p.finished = true
+	event := p.event(ConnectFailed)
+	event.Reason = reason
+	event.Err = err
+	return event
+}
+
+// event returns an event of the given type describing the current server.
+func (p *ConnectParser) event(eventType ConnectEventType) ConnectEvent {
+	return ConnectEvent{
+		Type:     eventType,
+		Server:   p.server,
+		Hostname: p.hostname,
+	}
+}
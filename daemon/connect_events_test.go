@@ -0,0 +1,218 @@
+package daemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/adamdb5/opennord/pb"
+	"io"
+	"main/daemon"
+	"main/daemon/daemonerr"
+	"main/daemon/daemontest"
+	"testing"
+	"time"
+)
+
+// parseSequence feeds the messages and terminating error of a Connect stream
+// through a new ConnectParser, returning every event it emits.
+func parseSequence(messages []*pb.ConnectResponse,
+	err error) []daemon.ConnectEvent {
+	parser := &daemon.ConnectParser{}
+	var events []daemon.ConnectEvent
+	for _, msg := range messages {
+		events = append(events, parser.Parse(msg)...)
+	}
+	if err != nil {
+		return append(events, parser.Fail(err)...)
+	}
+	return append(events, parser.Finish()...)
+}
+
+// checkEvents fails the test unless the types and reasons of events match
+// those of want.
+func checkEvents(t *testing.T, events []daemon.ConnectEvent,
+	want []daemon.ConnectEvent) {
+	t.Helper()
+	if len(events) != len(want) {
+		t.Fatalf("got %d events %v, want %d %v", len(events), events,
+			len(want), want)
+	}
+	for i, event := range events {
+		if event.Type != want[i].Type {
+			t.Errorf("event %d: got type %v, want %v", i, event.Type,
+				want[i].Type)
+		}
+		if event.Reason != want[i].Reason {
+			t.Errorf("event %d: got reason %q, want %q", i, event.Reason,
+				want[i].Reason)
+		}
+	}
+}
+
+func TestConnectParserSequences(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []*pb.ConnectResponse
+		err      error
+		want     []daemon.ConnectEvent
+		kind     daemonerr.Kind
+	}{
+		{
+			name:     "success",
+			messages: daemontest.ConnectSequenceSuccess,
+			want: []daemon.ConnectEvent{
+				{Type: daemon.ConnectStarted},
+				{Type: daemon.ConnectServerChosen},
+				{Type: daemon.ConnectConnecting},
+				{Type: daemon.ConnectConnected},
+			},
+		},
+		{
+			name:     "not logged in",
+			messages: daemontest.ConnectSequenceNotLoggedIn,
+			err:      daemonerr.FromError(daemontest.ErrNotLoggedIn),
+			want: []daemon.ConnectEvent{
+				{Type: daemon.ConnectStarted},
+				{
+					Type:   daemon.ConnectFailed,
+					Reason: "You are not logged in to NordVPN.",
+				},
+			},
+			kind: daemonerr.NotLoggedIn,
+		},
+		{
+			name:     "server not found",
+			messages: daemontest.ConnectSequenceServerNotFound,
+			err:      daemonerr.FromError(daemontest.ErrServerNotFound),
+			want: []daemon.ConnectEvent{
+				{Type: daemon.ConnectStarted},
+				{
+					Type:   daemon.ConnectFailed,
+					Reason: "The specified server or group does not exist.",
+				},
+			},
+			kind: daemonerr.ServerNotFound,
+		},
+		{
+			name:     "generic failure",
+			messages: daemontest.ConnectSequenceGenericFailure,
+			want: []daemon.ConnectEvent{
+				{Type: daemon.ConnectStarted},
+				{Type: daemon.ConnectServerChosen},
+				{Type: daemon.ConnectConnecting},
+				{Type: daemon.ConnectFailed, Reason: "unknown error"},
+			},
+			kind: daemonerr.Unknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := parseSequence(test.messages, test.err)
+			checkEvents(t, events, test.want)
+
+			last := events[len(events)-1]
+			if last.Type != daemon.ConnectFailed {
+				return
+			}
+			if last.Err == nil {
+				t.Fatal("failure event has no error")
+			}
+			if kind := daemonerr.KindOf(last.Err); kind != test.kind {
+				t.Errorf("got error kind %v, want %v", kind, test.kind)
+			}
+		})
+	}
+}
+
+func TestConnectParserServer(t *testing.T) {
+	event := func(msg *pb.ConnectResponse) daemon.ConnectEvent {
+		events := parseSequence([]*pb.ConnectResponse{msg}, nil)
+		return events[1]
+	}
+
+	chosen := event(daemontest.ConnectSequenceSuccess[0])
+	if chosen.Type != daemon.ConnectServerChosen {
+		t.Fatalf("got type %v, want %v", chosen.Type,
+			daemon.ConnectServerChosen)
+	}
+	if chosen.Server != "Germany #123" ||
+		chosen.Hostname != "de123.nordvpn.com" {
+		t.Errorf("got server %q (%q), want \"Germany #123\" "+
+			"(\"de123.nordvpn.com\")", chosen.Server, chosen.Hostname)
+	}
+}
+
+func TestConnectParserInterrupted(t *testing.T) {
+	events := parseSequence(daemontest.ConnectSequenceSuccess[:1], nil)
+	checkEvents(t, events, []daemon.ConnectEvent{
+		{Type: daemon.ConnectStarted},
+		{Type: daemon.ConnectServerChosen},
+		{Type: daemon.ConnectConnecting},
+		{
+			Type:   daemon.ConnectFailed,
+			Reason: daemon.ErrConnectInterrupted.Error(),
+		},
+	})
+	if err := events[3].Err; !errors.Is(err, daemon.ErrConnectInterrupted) {
+		t.Errorf("got error %v, want %v", err, daemon.ErrConnectInterrupted)
+	}
+}
+
+func TestConnectParserIgnoresEventsAfterOutcome(t *testing.T) {
+	parser := &daemon.ConnectParser{}
+	for _, msg := range daemontest.ConnectSequenceSuccess {
+		parser.Parse(msg)
+	}
+	if !parser.Connected() {
+		t.Fatal("parser does not report the connection")
+	}
+	if events := parser.Finish(); len(events) != 0 {
+		t.Errorf("got events %v after connecting, want none", events)
+	}
+	if events := parser.Fail(io.ErrUnexpectedEOF); len(events) != 0 {
+		t.Errorf("got events %v after connecting, want none", events)
+	}
+}
+
+func TestConnectParserTimeout(t *testing.T) {
+	server, err := daemontest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Update(func(state *daemontest.State) {
+		state.ConnectDelay = time.Minute
+	})
+
+	client, err := server.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+
+	parser := &daemon.ConnectParser{}
+	var events []daemon.ConnectEvent
+	stream, err := client.Connect(ctx, &pb.ConnectRequest{})
+	for err == nil {
+		var msg *pb.ConnectResponse
+		if msg, err = stream.Recv(); err == nil {
+			events = append(events, parser.Parse(msg)...)
+		}
+	}
+	events = append(events, parser.Fail(err)...)
+
+	checkEvents(t, events, []daemon.ConnectEvent{
+		{Type: daemon.ConnectStarted},
+		{
+			Type:   daemon.ConnectFailed,
+			Reason: "The NordVPN daemon did not respond in time.",
+		},
+	})
+	if !errors.Is(events[1].Err, daemonerr.ErrTimeout) {
+		t.Errorf("got error %v, want a timeout", events[1].Err)
+	}
+}
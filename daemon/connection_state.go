@@ -0,0 +1,264 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+)
+
+// ConnectionState is the state of the VPN connection as understood by the
+// application.
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota
+	StateConnecting
+	StateConnected
+	StateReconnecting
+	StateDisconnecting
+	StateError
+)
+
+// String returns a human-readable name for the state.
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "Disconnected"
+	case StateConnecting:
+		return "Connecting"
+	case StateConnected:
+		return "Connected"
+	case StateReconnecting:
+		return "Reconnecting"
+	case StateDisconnecting:
+		return "Disconnecting"
+	case StateError:
+		return "Error"
+	default:
+		return "Unknown"
+	}
+}
+
+// Transitioning reports whether the connection is changing between states,
+// during which new connections and settings changes should not be started.
+func (s ConnectionState) Transitioning() bool {
+	return s == StateConnecting || s == StateReconnecting ||
+		s == StateDisconnecting
+}
+
+// CanConnect reports whether a new connection may be started.
+func (s ConnectionState) CanConnect() bool {
+	return !s.Transitioning()
+}
+
+// CanDisconnect reports whether there is a session which may be disconnected.
+func (s ConnectionState) CanDisconnect() bool {
+	return s == StateConnected || s == StateReconnecting
+}
+
+// Transition records a change of connection state.
+type Transition struct {
+	From ConnectionState
+	To   ConnectionState
+	Time time.Time
+	// Err is set when transitioning to StateError.
+	Err error
+}
+
+// MaxTransitions is the number of transitions retained by a
+// ConnectionStateMachine.
+const MaxTransitions = 100
+
+// ConnectionStateMachine tracks the ConnectionState by consuming status
+// snapshots from the daemon, events from the Connect stream and the
+// disconnect requests made by the user. It is safe for concurrent use;
+// listeners are invoked on the goroutine which caused the transition.
+type ConnectionStateMachine struct {
+	mu               sync.Mutex
+	state            ConnectionState
+	err              error
+	errFromDaemon    bool
+	connectRequested bool
+	transitions      []Transition
+	listeners        []func(Transition)
+}
+
+// NewConnectionStateMachine creates a state machine in the Disconnected
+// state.
+func NewConnectionStateMachine() *ConnectionStateMachine {
+	return &ConnectionStateMachine{
+		transitions: []Transition{{
+			From: StateDisconnected,
+			To:   StateDisconnected,
+			Time: time.Now(),
+		}},
+	}
+}
+
+// OnTransition registers fn to be invoked after every change of state.
+func (m *ConnectionStateMachine) OnTransition(fn func(Transition)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// State returns the current state.
+func (m *ConnectionStateMachine) State() ConnectionState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Err returns the error which caused the machine to enter StateError, or nil
+// if the machine is in another state.
+func (m *ConnectionStateMachine) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Since returns the time at which the current state was entered.
+func (m *ConnectionStateMachine) Since() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transitions[len(m.transitions)-1].Time
+}
+
+// Transitions returns the most recent transitions, oldest first.
+func (m *ConnectionStateMachine) Transitions() []Transition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Transition(nil), m.transitions...)
+}
+
+// HandleSnapshot updates the state from a status snapshot published by the
+// daemon.
+func (m *ConnectionStateMachine) HandleSnapshot(snapshot Snapshot) {
+	m.mu.Lock()
+	notify := m.handleSnapshot(snapshot)
+	m.mu.Unlock()
+	notify()
+}
+
+// HandleConnectEvent updates the state from an event of the Connect stream.
+func (m *ConnectionStateMachine) HandleConnectEvent(event ConnectEvent) {
+	m.mu.Lock()
+	notify := m.handleConnectEvent(event)
+	m.mu.Unlock()
+	notify()
+}
+
+// BeginDisconnect records that the user has requested a disconnect.
+func (m *ConnectionStateMachine) BeginDisconnect() {
+	m.mu.Lock()
+	m.connectRequested = false
+	notify := m.transition(StateDisconnecting, nil, false)
+	m.mu.Unlock()
+	notify()
+}
+
+// EndDisconnect records the outcome of a disconnect request, including one
+// made to abandon a cancelled connection attempt. A nil err indicates that the
+// session was torn down.
+func (m *ConnectionStateMachine) EndDisconnect(err error) {
+	m.mu.Lock()
+	m.connectRequested = false
+	var notify func()
+	if err != nil {
+		notify = m.transition(StateError, err, false)
+	} else {
+		notify = m.transition(StateDisconnected, nil, false)
+	}
+	m.mu.Unlock()
+	notify()
+}
+
+// handleSnapshot implements HandleSnapshot. The caller must hold the lock.
+func (m *ConnectionStateMachine) handleSnapshot(snapshot Snapshot) func() {
+	if snapshot.Err != nil {
+		return m.transition(StateError, snapshot.Err, true)
+	}
+
+	switch snapshot.State {
+	case "Connected":
+		if m.state == StateDisconnecting {
+			return func() {}
+		}
+		return m.transition(StateConnected, nil, false)
+	case "Connecting", "Reconnecting":
+		switch m.state {
+		case StateConnected, StateReconnecting:
+			return m.transition(StateReconnecting, nil, false)
+		case StateConnecting, StateDisconnecting:
+			return func() {}
+		default:
+			// A connection was started by another client, e.g. the CLI
+			return m.transition(StateConnecting, nil, false)
+		}
+	default:
+		switch {
+		case m.state == StateConnecting && m.connectRequested:
+			// The daemon has not yet started connecting, the outcome will be
+			// reported by the Connect stream
+			return func() {}
+		case m.state == StateError && !m.errFromDaemon:
+			// Keep reporting the failed connection attempt
+			return func() {}
+		default:
+			return m.transition(StateDisconnected, nil, false)
+		}
+	}
+}
+
+// handleConnectEvent implements HandleConnectEvent. The caller must hold the
+// lock.
+func (m *ConnectionStateMachine) handleConnectEvent(
+	event ConnectEvent) func() {
+	switch event.Type {
+	case ConnectStarted:
+		m.connectRequested = true
+		return m.transition(StateConnecting, nil, false)
+	case ConnectConnected:
+		m.connectRequested = false
+		return m.transition(StateConnected, nil, false)
+	case ConnectFailed:
+		m.connectRequested = false
+		return m.transition(StateError, event.Err, false)
+	default:
+		return func() {}
+	}
+}
+
+// transition changes the state, returning a function which notifies the
+// listeners of the change. The caller must hold the lock, and must call the
+// returned function once the lock has been released.
+func (m *ConnectionStateMachine) transition(to ConnectionState, err error,
+	errFromDaemon bool) func() {
+	if to == m.state && (to != StateError || sameError(err, m.err)) {
+		return func() {}
+	}
+
+	t := Transition{From: m.state, To: to, Time: time.Now(), Err: err}
+	m.state = to
+	m.err = err
+	m.errFromDaemon = errFromDaemon
+	m.transitions = append(m.transitions, t)
+	if len(m.transitions) > MaxTransitions {
+		m.transitions = m.transitions[len(m.transitions)-MaxTransitions:]
+	}
+
+	listeners := make([]func(Transition), len(m.listeners))
+	copy(listeners, m.listeners)
+	return func() {
+		for _, fn := range listeners {
+			fn(t)
+		}
+	}
+}
+
+// sameError reports whether two errors have the same message.
+func sameError(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Error() == b.Error()
+}
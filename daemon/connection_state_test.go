@@ -0,0 +1,306 @@
+package daemon_test
+
+import (
+	"errors"
+	"main/daemon"
+	"testing"
+)
+
+// step feeds a single input to a ConnectionStateMachine.
+type step func(m *daemon.ConnectionStateMachine)
+
+// snapshot reports the given daemon state.
+func snapshot(state string) step {
+	return func(m *daemon.ConnectionStateMachine) {
+		m.HandleSnapshot(daemon.Snapshot{State: state})
+	}
+}
+
+// snapshotErr reports that the status could not be retrieved.
+func snapshotErr(message string) step {
+	return func(m *daemon.ConnectionStateMachine) {
+		m.HandleSnapshot(daemon.Snapshot{Err: errors.New(message)})
+	}
+}
+
+// event reports an event of the Connect stream.
+func event(eventType daemon.ConnectEventType, err error) step {
+	return func(m *daemon.ConnectionStateMachine) {
+		m.HandleConnectEvent(daemon.ConnectEvent{Type: eventType, Err: err})
+	}
+}
+
+func beginDisconnect(m *daemon.ConnectionStateMachine) {
+	m.BeginDisconnect()
+}
+
+// endDisconnect reports the outcome of a disconnect request.
+func endDisconnect(err error) step {
+	return func(m *daemon.ConnectionStateMachine) {
+		m.EndDisconnect(err)
+	}
+}
+
+func TestConnectionStateMachine(t *testing.T) {
+	errFailed := errors.New("connection failed")
+
+	tests := []struct {
+		name  string
+		steps []step
+		want  daemon.ConnectionState
+		// transitions is the number of transitions the steps cause.
+		transitions int
+	}{
+		{
+			name: "connect",
+			steps: []step{
+				event(daemon.ConnectStarted, nil),
+				event(daemon.ConnectServerChosen, nil),
+				event(daemon.ConnectConnected, nil),
+			},
+			want:        daemon.StateConnected,
+			transitions: 2,
+		},
+		{
+			name: "connect failure",
+			steps: []step{
+				event(daemon.ConnectStarted, nil),
+				event(daemon.ConnectFailed, errFailed),
+			},
+			want:        daemon.StateError,
+			transitions: 2,
+		},
+		{
+			name: "connecting kept while the connect is requested",
+			steps: []step{
+				event(daemon.ConnectStarted, nil),
+				snapshot("Disconnected"),
+			},
+			want:        daemon.StateConnecting,
+			transitions: 1,
+		},
+		{
+			name: "connecting kept while the daemon connects",
+			steps: []step{
+				event(daemon.ConnectStarted, nil),
+				snapshot("Connecting"),
+			},
+			want:        daemon.StateConnecting,
+			transitions: 1,
+		},
+		{
+			name:        "connection started by another client",
+			steps:       []step{snapshot("Connecting")},
+			want:        daemon.StateConnecting,
+			transitions: 1,
+		},
+		{
+			name: "connection by another client abandoned",
+			steps: []step{
+				snapshot("Connecting"),
+				snapshot("Disconnected"),
+			},
+			want:        daemon.StateDisconnected,
+			transitions: 2,
+		},
+		{
+			name: "reconnect",
+			steps: []step{
+				snapshot("Connected"),
+				snapshot("Reconnecting"),
+				snapshot("Connecting"),
+				snapshot("Connected"),
+			},
+			want:        daemon.StateConnected,
+			transitions: 3,
+		},
+		{
+			name: "connected ignored while disconnecting",
+			steps: []step{
+				snapshot("Connected"),
+				beginDisconnect,
+				snapshot("Connected"),
+			},
+			want:        daemon.StateDisconnecting,
+			transitions: 2,
+		},
+		{
+			name: "connecting ignored while disconnecting",
+			steps: []step{
+				snapshot("Connected"),
+				beginDisconnect,
+				snapshot("Reconnecting"),
+			},
+			want:        daemon.StateDisconnecting,
+			transitions: 2,
+		},
+		{
+			name: "disconnect",
+			steps: []step{
+				snapshot("Connected"),
+				beginDisconnect,
+				endDisconnect(nil),
+				snapshot("Disconnected"),
+			},
+			want:        daemon.StateDisconnected,
+			transitions: 3,
+		},
+		{
+			name: "disconnect failure",
+			steps: []step{
+				snapshot("Connected"),
+				beginDisconnect,
+				endDisconnect(errFailed),
+			},
+			want:        daemon.StateError,
+			transitions: 3,
+		},
+		{
+			name: "disconnect clears the connect request",
+			steps: []step{
+				event(daemon.ConnectStarted, nil),
+				beginDisconnect,
+				snapshot("Disconnected"),
+			},
+			want:        daemon.StateDisconnected,
+			transitions: 3,
+		},
+		{
+			name: "connect failure kept when disconnected",
+			steps: []step{
+				event(daemon.ConnectStarted, nil),
+				event(daemon.ConnectFailed, errFailed),
+				snapshot("Disconnected"),
+			},
+			want:        daemon.StateError,
+			transitions: 2,
+		},
+		{
+			name: "daemon error cleared when disconnected",
+			steps: []step{
+				snapshotErr("daemon unreachable"),
+				snapshot("Disconnected"),
+			},
+			want:        daemon.StateDisconnected,
+			transitions: 2,
+		},
+		{
+			name: "connect failure replaced once connected",
+			steps: []step{
+				event(daemon.ConnectFailed, errFailed),
+				snapshot("Connected"),
+			},
+			want:        daemon.StateConnected,
+			transitions: 2,
+		},
+		{
+			name: "repeated errors with the same message",
+			steps: []step{
+				snapshotErr("daemon unreachable"),
+				snapshotErr("daemon unreachable"),
+			},
+			want:        daemon.StateError,
+			transitions: 1,
+		},
+		{
+			name: "repeated errors with another message",
+			steps: []step{
+				snapshotErr("daemon unreachable"),
+				snapshotErr("permission denied"),
+			},
+			want:        daemon.StateError,
+			transitions: 2,
+		},
+		{
+			name: "repeated snapshots",
+			steps: []step{
+				snapshot("Connected"),
+				snapshot("Connected"),
+				snapshot("Disconnected"),
+				snapshot("Disconnected"),
+			},
+			want:        daemon.StateDisconnected,
+			transitions: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := daemon.NewConnectionStateMachine()
+			var notified []daemon.Transition
+			m.OnTransition(func(transition daemon.Transition) {
+				notified = append(notified, transition)
+			})
+
+			for _, step := range test.steps {
+				step(m)
+			}
+
+			if state := m.State(); state != test.want {
+				t.Errorf("got state %v, want %v", state, test.want)
+			}
+			if len(notified) != test.transitions {
+				t.Errorf("got %d transitions %v, want %d", len(notified),
+					notified, test.transitions)
+			}
+			// The initial state is recorded along with the transitions
+			if n := len(m.Transitions()); n != len(notified)+1 {
+				t.Errorf("got %d recorded transitions, want %d", n,
+					len(notified)+1)
+			}
+			if (m.State() == daemon.StateError) != (m.Err() != nil) {
+				t.Errorf("got error %v in state %v", m.Err(), m.State())
+			}
+		})
+	}
+}
+
+func TestConnectionStateMachineTransitions(t *testing.T) {
+	m := daemon.NewConnectionStateMachine()
+	for i := 0; i < daemon.MaxTransitions; i++ {
+		snapshot("Connected")(m)
+		snapshot("Disconnected")(m)
+	}
+
+	transitions := m.Transitions()
+	if len(transitions) != daemon.MaxTransitions {
+		t.Fatalf("got %d transitions, want %d", len(transitions),
+			daemon.MaxTransitions)
+	}
+	last := transitions[len(transitions)-1]
+	if last.From != daemon.StateConnected ||
+		last.To != daemon.StateDisconnected {
+		t.Errorf("got last transition from %v to %v, want from %v to %v",
+			last.From, last.To, daemon.StateConnected,
+			daemon.StateDisconnected)
+	}
+	if !m.Since().Equal(last.Time) {
+		t.Errorf("got state entered at %v, want %v", m.Since(), last.Time)
+	}
+}
+
+func TestConnectionStateCapabilities(t *testing.T) {
+	tests := []struct {
+		state         daemon.ConnectionState
+		canConnect    bool
+		canDisconnect bool
+	}{
+		{daemon.StateDisconnected, true, false},
+		{daemon.StateConnecting, false, false},
+		{daemon.StateConnected, true, true},
+		{daemon.StateReconnecting, false, true},
+		{daemon.StateDisconnecting, false, false},
+		{daemon.StateError, true, false},
+	}
+
+	for _, test := range tests {
+		if got := test.state.CanConnect(); got != test.canConnect {
+			t.Errorf("%v: got CanConnect %v, want %v", test.state, got,
+				test.canConnect)
+		}
+		if got := test.state.CanDisconnect(); got != test.canDisconnect {
+			t.Errorf("%v: got CanDisconnect %v, want %v", test.state, got,
+				test.canDisconnect)
+		}
+	}
+}
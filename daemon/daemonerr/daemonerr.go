@@ -0,0 +1,323 @@
+// Package daemonerr classifies the errors returned by the NordVPN daemon. The
+// gRPC status code and message of each failure are mapped to an Error with a
+// Kind, which determines the message shown to the user and the action they
+// are offered to recover from it.
+package daemonerr
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Kind identifies a class of daemon failure.
+type Kind int
+
+const (
+	Unknown Kind = iota
+	Unreachable
+	PermissionDenied
+	NotLoggedIn
+	SubscriptionExpired
+	ServerNotFound
+	InvalidSetting
+	Timeout
+)
+
+// String returns a human-readable name for the kind.
+func (k Kind) String() string {
+	switch k {
+	case Unreachable:
+		return "daemon unreachable"
+	case PermissionDenied:
+		return "permission denied"
+	case NotLoggedIn:
+		return "not logged in"
+	case SubscriptionExpired:
+		return "subscription expired"
+	case ServerNotFound:
+		return "server not found"
+	case InvalidSetting:
+		return "invalid setting"
+	case Timeout:
+		return "timeout"
+	default:
+		return "unknown error"
+	}
+}
+
+// Action is a recovery action which may be offered to the user.
+type Action int
+
+const (
+	// ActionDismiss offers no recovery beyond dismissing the message.
+	ActionDismiss Action = iota
+	// ActionReconnect re-establishes the connection to the daemon.
+	ActionReconnect
+	// ActionRetry repeats the operation which failed.
+	ActionRetry
+	// ActionLogIn takes the user to the login options.
+	ActionLogIn
+	// ActionRenew takes the user to their Nord Account to renew their
+	// subscription.
+	ActionRenew
+)
+
+// Label returns the text of the button which performs the action.
+func (a Action) Label() string {
+	switch a {
+	case ActionReconnect:
+		return "Reconnect"
+	case ActionRetry:
+		return "Retry"
+	case ActionLogIn:
+		return "Log In"
+	case ActionRenew:
+		return "Renew"
+	default:
+		return "Dismiss"
+	}
+}
+
+// Error is a classified daemon failure.
+type Error struct {
+	Kind Kind
+	// Message is the message reported by the daemon, or the underlying error.
+	Message string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// Sentinel errors which can be compared against using errors.Is, which
+// matches any Error of the same Kind.
+var (
+	ErrUnreachable         = &Error{Kind: Unreachable}
+	ErrPermissionDenied    = &Error{Kind: PermissionDenied}
+	ErrNotLoggedIn         = &Error{Kind: NotLoggedIn}
+	ErrSubscriptionExpired = &Error{Kind: SubscriptionExpired}
+	ErrServerNotFound      = &Error{Kind: ServerNotFound}
+	ErrInvalidSetting      = &Error{Kind: InvalidSetting}
+	ErrTimeout             = &Error{Kind: Timeout}
+)
+
+// ErrAlreadySet underlies the InvalidSetting errors reported when a setting
+// already has the requested value, so that they can be told apart from
+// settings which are genuinely invalid.
+var ErrAlreadySet = errors.New("setting already has the requested value")
+
+// New creates an Error of the given kind with the given message.
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Error returns the message reported by the daemon.
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Kind.String()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an Error of the same Kind.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+// UserMessage returns a description of the failure suitable for displaying to
+// the user.
+func (e *Error) UserMessage() string {
+	switch e.Kind {
+	case Unreachable:
+		return "Could not reach the NordVPN daemon. Make sure nordvpnd is " +
+			"running."
+	case PermissionDenied:
+		return "Permission denied by the NordVPN daemon. Make sure your " +
+			"user is a member of the 'nordvpn' group."
+	case NotLoggedIn:
+		return "You are not logged in to NordVPN."
+	case SubscriptionExpired:
+		return "Your NordVPN subscription has expired."
+	case ServerNotFound:
+		return "The specified server or group does not exist."
+	case InvalidSetting:
+		return "The setting was rejected by the NordVPN daemon: " + e.Error()
+	case Timeout:
+		return "The NordVPN daemon did not respond in time."
+	default:
+		return e.Error()
+	}
+}
+
+// Action returns the recovery action suggested for the failure.
+func (e *Error) Action() Action {
+	switch e.Kind {
+	case Unreachable:
+		return ActionReconnect
+	case PermissionDenied, Timeout:
+		return ActionRetry
+	case NotLoggedIn:
+		return ActionLogIn
+	case SubscriptionExpired:
+		return ActionRenew
+	default:
+		return ActionDismiss
+	}
+}
+
+// FromError classifies an error returned by a gRPC call to the daemon. Errors
+// which have already been classified are returned unchanged, and a nil error
+// returns nil.
+func FromError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: Timeout, Message: err.Error(), Err: err}
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return &Error{Kind: fromMessage(err.Error()), Message: err.Error(),
+			Err: err}
+	}
+
+	message := s.Message()
+	kind := fromMessage(message)
+	if kind == Unknown {
+		kind = fromCode(s.Code())
+	}
+
+	switch {
+	case kind == Unknown && s.Code() == codes.Canceled:
+		return context.Canceled
+	case kind == Unreachable && isPermissionDenied(message):
+		kind = PermissionDenied
+	}
+
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// FromMessage classifies a failure reported by the daemon as a message rather
+// than as a gRPC error.
+func FromMessage(message string) *Error {
+	return &Error{Kind: fromMessage(message), Message: message}
+}
+
+// FromDialError classifies an error which occurred while connecting to the
+// daemon's socket.
+func FromDialError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	kind := Unreachable
+	switch {
+	case errors.Is(err, os.ErrPermission), errors.Is(err, syscall.EACCES),
+		isPermissionDenied(err.Error()):
+		kind = PermissionDenied
+	case errors.Is(err, context.DeadlineExceeded):
+		kind = Timeout
+	}
+
+	return &Error{Kind: kind, Message: err.Error(), Err: err}
+}
+
+// KindOf returns the Kind of err, or Unknown if err has not been classified.
+func KindOf(err error) Kind {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+	return Unknown
+}
+
+// UserMessage returns a description of err suitable for displaying to the
+// user.
+func UserMessage(err error) string {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.UserMessage()
+	}
+	return err.Error()
+}
+
+// ActionOf returns the recovery action suggested for err.
+func ActionOf(err error) Action {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Action()
+	}
+	return ActionDismiss
+}
+
+// fromCode classifies a gRPC status code.
+func fromCode(code codes.Code) Kind {
+	switch code {
+	case codes.Unavailable:
+		return Unreachable
+	case codes.PermissionDenied:
+		return PermissionDenied
+	case codes.Unauthenticated:
+		return NotLoggedIn
+	case codes.NotFound:
+		return ServerNotFound
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return InvalidSetting
+	case codes.DeadlineExceeded:
+		return Timeout
+	default:
+		return Unknown
+	}
+}
+
+// fromMessage classifies a message reported by the daemon.
+func fromMessage(message string) Kind {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "not logged in"):
+		return NotLoggedIn
+	case strings.Contains(lower, "expired") ||
+		strings.Contains(lower, "renew your subscription"):
+		return SubscriptionExpired
+	case strings.Contains(lower, "does not exist") ||
+		strings.Contains(lower, "not found"):
+		return ServerNotFound
+	case isPermissionDenied(lower):
+		return PermissionDenied
+	case strings.Contains(lower, "already enabled") ||
+		strings.Contains(lower, "already selected") ||
+		strings.Contains(lower, "invalid"):
+		return InvalidSetting
+	case strings.Contains(lower, "connection refused") ||
+		strings.Contains(lower, "no such file or directory") ||
+		strings.Contains(lower, "error while dialing"):
+		return Unreachable
+	default:
+		return Unknown
+	}
+}
+
+// isPermissionDenied reports whether message describes a permission failure.
+func isPermissionDenied(message string) bool {
+	return strings.Contains(strings.ToLower(message), "permission denied")
+}
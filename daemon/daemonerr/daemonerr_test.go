@@ -0,0 +1,216 @@
+package daemonerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFromErrorCodes(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want Kind
+	}{
+		{codes.Unavailable, Unreachable},
+		{codes.PermissionDenied, PermissionDenied},
+		{codes.Unauthenticated, NotLoggedIn},
+		{codes.NotFound, ServerNotFound},
+		{codes.InvalidArgument, InvalidSetting},
+		{codes.FailedPrecondition, InvalidSetting},
+		{codes.OutOfRange, InvalidSetting},
+		{codes.DeadlineExceeded, Timeout},
+		{codes.Internal, Unknown},
+		{codes.Unknown, Unknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.code.String(), func(t *testing.T) {
+			err := FromError(status.Error(test.code, "failure"))
+			if kind := KindOf(err); kind != test.want {
+				t.Errorf("got kind %v, want %v", kind, test.want)
+			}
+			if err.Error() != "failure" {
+				t.Errorf("got message %q, want \"failure\"", err.Error())
+			}
+		})
+	}
+}
+
+func TestFromErrorMessages(t *testing.T) {
+	tests := []struct {
+		message string
+		want    Kind
+	}{
+		{"You are not logged in.", NotLoggedIn},
+		{"Your account has expired.", SubscriptionExpired},
+		{"Please renew your subscription.", SubscriptionExpired},
+		{"The specified server does not exist.", ServerNotFound},
+		{"Group not found", ServerNotFound},
+		{"open /run/nordvpn/nordvpnd.sock: permission denied",
+			PermissionDenied},
+		{"Kill Switch is already enabled.", InvalidSetting},
+		{"Protocol is already selected.", InvalidSetting},
+		{"Invalid DNS address", InvalidSetting},
+		{"dial unix: connect: connection refused", Unreachable},
+		{"dial unix: no such file or directory", Unreachable},
+		{"error while dialing", Unreachable},
+		{"something went wrong", Unknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.message, func(t *testing.T) {
+			// The message takes precedence over the code
+			err := FromError(status.Error(codes.Internal, test.message))
+			if kind := KindOf(err); kind != test.want {
+				t.Errorf("got kind %v from the status, want %v", kind,
+					test.want)
+			}
+
+			if kind := FromMessage(test.message).Kind; kind != test.want {
+				t.Errorf("got kind %v from the message, want %v", kind,
+					test.want)
+			}
+
+			err = FromError(errors.New(test.message))
+			if kind := KindOf(err); kind != test.want {
+				t.Errorf("got kind %v from a plain error, want %v", kind,
+					test.want)
+			}
+		})
+	}
+}
+
+func TestFromErrorSpecialCases(t *testing.T) {
+	if err := FromError(nil); err != nil {
+		t.Errorf("got %v from nil, want nil", err)
+	}
+
+	classified := New(NotLoggedIn, "not logged in")
+	if err := FromError(classified); err != classified {
+		t.Errorf("got %v, want the classified error unchanged", err)
+	}
+
+	if err := FromError(context.Canceled); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	err := FromError(status.Error(codes.Canceled, "context canceled"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v from a cancelled call, want %v", err,
+			context.Canceled)
+	}
+
+	err = FromError(fmt.Errorf("call: %w", context.DeadlineExceeded))
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want it to wrap %v", err, context.DeadlineExceeded)
+	}
+
+	// The daemon's socket may be unavailable because it cannot be opened
+	err = FromError(status.Error(codes.Unavailable,
+		"connection error: permission denied"))
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("got %v, want permission denied", err)
+	}
+}
+
+func TestFromDialError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{"refused", syscall.ECONNREFUSED, Unreachable},
+		{"missing", os.ErrNotExist, Unreachable},
+		{"permission", os.ErrPermission, PermissionDenied},
+		{"access", syscall.EACCES, PermissionDenied},
+		{"timeout", context.DeadlineExceeded, Timeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := FromDialError(fmt.Errorf("dial: %w", test.err))
+			if kind := KindOf(err); kind != test.want {
+				t.Errorf("got kind %v, want %v", kind, test.want)
+			}
+		})
+	}
+
+	if err := FromDialError(nil); err != nil {
+		t.Errorf("got %v from nil, want nil", err)
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		kind Kind
+		want Action
+	}{
+		{Unreachable, ActionReconnect},
+		{PermissionDenied, ActionRetry},
+		{Timeout, ActionRetry},
+		{NotLoggedIn, ActionLogIn},
+		{SubscriptionExpired, ActionRenew},
+		{ServerNotFound, ActionDismiss},
+		{InvalidSetting, ActionDismiss},
+		{Unknown, ActionDismiss},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kind.String(), func(t *testing.T) {
+			err := fmt.Errorf("operation failed: %w", New(test.kind, "failure"))
+			if kind := KindOf(err); kind != test.kind {
+				t.Errorf("got kind %v, want %v", kind, test.kind)
+			}
+			if action := ActionOf(err); action != test.want {
+				t.Errorf("got action %v, want %v", action.Label(),
+					test.want.Label())
+			}
+		})
+	}
+}
+
+func TestUnclassifiedErrors(t *testing.T) {
+	err := errors.New("failure")
+	if kind := KindOf(err); kind != Unknown {
+		t.Errorf("got kind %v, want %v", kind, Unknown)
+	}
+	if action := ActionOf(err); action != ActionDismiss {
+		t.Errorf("got action %v, want %v", action.Label(),
+			ActionDismiss.Label())
+	}
+	if message := UserMessage(err); message != "failure" {
+		t.Errorf("got message %q, want \"failure\"", message)
+	}
+
+	// A raw gRPC error has not been classified
+	err = status.Error(codes.Unavailable, "unavailable")
+	if kind := KindOf(err); kind != Unknown {
+		t.Errorf("got kind %v from a raw gRPC error, want %v", kind,
+			Unknown)
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	err := fmt.Errorf("call: %w", New(NotLoggedIn, "you are not logged in"))
+	if !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("%v does not match %v", err, ErrNotLoggedIn)
+	}
+	if errors.Is(err, ErrSubscriptionExpired) {
+		t.Errorf("%v matches %v", err, ErrSubscriptionExpired)
+	}
+	if message := UserMessage(err); message !=
+		"You are not logged in to NordVPN." {
+		t.Errorf("got message %q", message)
+	}
+	if message := ErrTimeout.Error(); message != Timeout.String() {
+		t.Errorf("got message %q for an error without one, want %q",
+			message, Timeout.String())
+	}
+}
@@ -0,0 +1,55 @@
+package daemontest
+
+import (
+	"github.com/adamdb5/opennord"
+	"github.com/adamdb5/opennord/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The sequences below model the messages streamed by nordvpnd, and may be
+// assigned to State.ConnectMessages along with the matching
+// State.ConnectError.
+
+// ConnectSequenceSuccess is the sequence of messages streamed by the daemon
+// when a connection is established successfully.
+var ConnectSequenceSuccess = []*pb.ConnectResponse{
+	{
+		Type:     opennord.StatusConnecting,
+		Messages: []string{"Germany #123", "de123.nordvpn.com"},
+	},
+	{
+		Type:     opennord.StatusConnected,
+		Messages: []string{"Germany #123", "de123.nordvpn.com"},
+	},
+}
+
+// ConnectSequenceNotLoggedIn is the sequence of messages streamed by the
+// daemon when the user is not logged in. The stream is terminated by
+// ErrNotLoggedIn before any messages are sent.
+var ConnectSequenceNotLoggedIn []*pb.ConnectResponse
+
+// ErrNotLoggedIn is the error returned by the daemon when an RPC requires the
+// user to be logged in.
+var ErrNotLoggedIn = status.Error(codes.Unknown, "You are not logged in.")
+
+// ConnectSequenceServerNotFound is the sequence of messages streamed by the
+// daemon when the requested server tag does not match any server.
+var ConnectSequenceServerNotFound []*pb.ConnectResponse
+
+// ErrServerNotFound is the error which terminates the Connect stream when the
+// requested server tag does not match any server.
+var ErrServerNotFound = status.Error(codes.Unknown,
+	"The specified server does not exist.")
+
+// ConnectSequenceGenericFailure is the sequence of messages streamed by the
+// daemon when the tunnel could not be established.
+var ConnectSequenceGenericFailure = []*pb.ConnectResponse{
+	{
+		Type:     opennord.StatusConnecting,
+		Messages: []string{"Germany #123", "de123.nordvpn.com"},
+	},
+	{
+		Type: opennord.StatusGenericError,
+	},
+}
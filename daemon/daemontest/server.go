@@ -0,0 +1,570 @@
+// Package daemontest provides an in-process fake NordVPN daemon for use in
+// tests. The fake speaks the daemon's gRPC protocol over a temporary unix
+// socket, serves canned responses from a scriptable State and allows failures
+// to be injected into individual RPCs.
+package daemontest
+
+import (
+	"context"
+	"github.com/adamdb5/opennord"
+	"github.com/adamdb5/opennord/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"io/ioutil"
+	"main/daemon"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State holds the canned responses served by the fake daemon. Settings RPCs
+// update the State in the same way the real daemon would update its own
+// configuration.
+type State struct {
+	LoggedIn     bool
+	Email        string
+	ExpiresAt    string
+	OAuthURL     string
+	Status       *pb.StatusResponse
+	Countries    []string
+	Cities       map[string][]string
+	Groups       []string
+	Protocols    []string
+	Technologies []string
+	Settings     *pb.Settings
+	CyberSec     bool
+	Obfuscate    bool
+	Protocol     pb.ProtocolEnum
+	DNS          []string
+	Whitelist    *pb.Whitelist
+	AutoConnect  *pb.SetAutoConnectRequest
+
+	// ConnectMessages is the sequence of messages streamed in response to a
+	// Connect request. ConnectError, if set, terminates the stream after the
+	// messages have been sent.
+	ConnectMessages []*pb.ConnectResponse
+	ConnectError    error
+	// ConnectDelay is the time waited before each message is sent, which can
+	// be used to simulate a slow negotiation.
+	ConnectDelay time.Duration
+	// ConnectedStatus is the status reported once a Connect stream has
+	// completed successfully.
+	ConnectedStatus *pb.StatusResponse
+	// LastConnectRequest is the most recent request received by Connect.
+	LastConnectRequest *pb.ConnectRequest
+}
+
+// NewState returns a State describing a logged in user who is not connected
+// to a VPN.
+func NewState() *State {
+	return &State{
+		LoggedIn:  true,
+		Email:     "user@example.com",
+		ExpiresAt: "2030-01-01 00:00:00",
+		OAuthURL:  "https://example.com/oauth",
+		Status:    &pb.StatusResponse{State: "Disconnected"},
+		Countries: []string{"Germany", "United_Kingdom"},
+		Cities: map[string][]string{
+			"Germany":        {"Berlin", "Frankfurt"},
+			"United_Kingdom": {"London", "Manchester"},
+		},
+		Groups:       []string{"P2P", "Standard_VPN_Servers"},
+		Protocols:    []string{"UDP", "TCP"},
+		Technologies: []string{"OPENVPN", "NORDLYNX"},
+		Settings: &pb.Settings{
+			Technology: pb.TechnologyEnum_NORDLYNX,
+		},
+		Protocol:        pb.ProtocolEnum_UDP,
+		Whitelist:       &pb.Whitelist{Ports: &pb.Ports{}},
+		ConnectMessages: ConnectSequenceSuccess,
+		ConnectedStatus: &pb.StatusResponse{
+			State:      "Connected",
+			Technology: pb.TechnologyEnum_NORDLYNX,
+			Protocol:   pb.ProtocolEnum_UDP,
+			Ip:         "192.0.2.1",
+			Hostname:   "de123.nordvpn.com",
+			Country:    "Germany",
+			City:       "Berlin",
+		},
+	}
+}
+
+// Server is a fake NordVPN daemon listening on a temporary unix socket.
+type Server struct {
+	pb.UnimplementedDaemonServer
+
+	mu       sync.Mutex
+	state    *State
+	failures map[string]error
+	calls    map[string]int
+
+	dir        string
+	socketPath string
+	grpcServer *grpc.Server
+}
+
+// NewServer starts a fake daemon serving the default State.
+func NewServer() (*Server, error) {
+	dir, err := ioutil.TempDir("", "daemontest")
+	if err != nil {
+		return nil, err
+	}
+
+	socketPath := filepath.Join(dir, "nordvpnd.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	server := &Server{
+		state:      NewState(),
+		failures:   map[string]error{},
+		calls:      map[string]int{},
+		dir:        dir,
+		socketPath: socketPath,
+		grpcServer: grpc.NewServer(),
+	}
+	pb.RegisterDaemonServer(server.grpcServer, server)
+	go func() { _ = server.grpcServer.Serve(listener) }()
+
+	return server, nil
+}
+
+// SocketPath returns the path of the unix socket the fake daemon listens on.
+func (s *Server) SocketPath() string {
+	return s.socketPath
+}
+
+// Dial creates a client connected to the fake daemon.
+func (s *Server) Dial() (*daemon.Client, error) {
+	return daemon.NewClient(s.socketPath)
+}
+
+// Close stops the fake daemon and removes its socket.
+func (s *Server) Close() {
+	s.grpcServer.Stop()
+	_ = os.RemoveAll(s.dir)
+}
+
+// Update calls fn with the State while holding the server's lock, allowing
+// the canned responses to be changed while the server is running.
+func (s *Server) Update(fn func(state *State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.state)
+}
+
+// Fail causes every subsequent call to the named RPC to return err. Passing a
+// nil err removes the injected failure.
+func (s *Server) Fail(rpc string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.failures, rpc)
+	} else {
+		s.failures[rpc] = err
+	}
+}
+
+// Calls returns the number of times the named RPC has been called.
+func (s *Server) Calls(rpc string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[rpc]
+}
+
+// begin records a call to the named RPC, acquires the server's lock and
+// returns any injected failure. The caller must release the lock.
+func (s *Server) begin(rpc string) error {
+	s.mu.Lock()
+	s.calls[rpc]++
+	return s.failures[rpc]
+}
+
+// ok returns a successful Payload.
+func ok() *pb.Payload {
+	return &pb.Payload{Type: opennord.StatusOk}
+}
+
+// AccountInfo implements pb.DaemonServer.
+func (s *Server) AccountInfo(context.Context, *emptypb.Empty) (
+	*pb.AccountResponse, error) {
+	err := s.begin("AccountInfo")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AccountResponse{
+		Type:      opennord.ErrOk,
+		Email:     s.state.Email,
+		ExpiresAt: s.state.ExpiresAt,
+	}, nil
+}
+
+// Cities implements pb.DaemonServer.
+func (s *Server) Cities(_ context.Context, req *pb.CitiesRequest) (
+	*pb.CitiesResponse, error) {
+	err := s.begin("Cities")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CitiesResponse{
+		Type:   opennord.ErrOk,
+		Cities: s.state.Cities[req.GetCountry()],
+	}, nil
+}
+
+// Connect implements pb.DaemonServer.
+func (s *Server) Connect(req *pb.ConnectRequest,
+	stream pb.Daemon_ConnectServer) error {
+	err := s.begin("Connect")
+	s.state.LastConnectRequest = proto.Clone(req).(*pb.ConnectRequest)
+	messages := s.state.ConnectMessages
+	connectErr := s.state.ConnectError
+	delay := s.state.ConnectDelay
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		select {
+		case <-time.After(delay):
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+	if connectErr != nil {
+		return connectErr
+	}
+
+	s.Update(func(state *State) {
+		state.Status = proto.Clone(state.ConnectedStatus).(*pb.StatusResponse)
+	})
+	return nil
+}
+
+// Countries implements pb.DaemonServer.
+func (s *Server) Countries(context.Context, *pb.CountriesRequest) (
+	*pb.CountriesResponse, error) {
+	err := s.begin("Countries")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CountriesResponse{
+		Type:      opennord.ErrOk,
+		Countries: s.state.Countries,
+	}, nil
+}
+
+// Disconnect implements pb.DaemonServer.
+func (s *Server) Disconnect(context.Context, *pb.DisconnectRequest) (
+	*pb.Payload, error) {
+	err := s.begin("Disconnect")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Status = &pb.StatusResponse{State: "Disconnected"}
+	return ok(), nil
+}
+
+// FrontendCountries implements pb.DaemonServer.
+func (s *Server) FrontendCountries(context.Context, *pb.CountriesRequest) (
+	*pb.FrontendCountriesResponse, error) {
+	err := s.begin("FrontendCountries")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var countries []*pb.FrontendCountry
+	for _, country := range s.state.Countries {
+		countries = append(countries, &pb.FrontendCountry{Name: country})
+	}
+	return &pb.FrontendCountriesResponse{Countries: countries}, nil
+}
+
+// Groups implements pb.DaemonServer.
+func (s *Server) Groups(context.Context, *pb.GroupsRequest) (
+	*pb.GroupsResponse, error) {
+	err := s.begin("Groups")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GroupsResponse{
+		Type:   opennord.ErrOk,
+		Groups: s.state.Groups,
+	}, nil
+}
+
+// IsLoggedIn implements pb.DaemonServer.
+func (s *Server) IsLoggedIn(context.Context, *emptypb.Empty) (
+	*pb.IsLoggedInResponse, error) {
+	err := s.begin("IsLoggedIn")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.IsLoggedInResponse{IsLoggedIn: s.state.LoggedIn}, nil
+}
+
+// Login implements pb.DaemonServer.
+func (s *Server) Login(_ context.Context, req *pb.LoginRequest) (*pb.Payload,
+	error) {
+	err := s.begin("Login")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.LoggedIn = true
+	s.state.Email = req.GetUsername()
+	return ok(), nil
+}
+
+// LoginOAuth2 implements pb.DaemonServer.
+func (s *Server) LoginOAuth2(context.Context, *emptypb.Empty) (
+	*pb.LoginOAuth2Response, error) {
+	err := s.begin("LoginOAuth2")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.LoginOAuth2Response{Url: s.state.OAuthURL}, nil
+}
+
+// Logout implements pb.DaemonServer.
+func (s *Server) Logout(context.Context, *pb.LogoutRequest) (*pb.Payload,
+	error) {
+	err := s.begin("Logout")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.LoggedIn = false
+	return ok(), nil
+}
+
+// Ping implements pb.DaemonServer.
+func (s *Server) Ping(context.Context, *emptypb.Empty) (*pb.Payload, error) {
+	err := s.begin("Ping")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return ok(), nil
+}
+
+// SetAutoConnect implements pb.DaemonServer.
+func (s *Server) SetAutoConnect(_ context.Context,
+	req *pb.SetAutoConnectRequest) (*pb.Payload, error) {
+	err := s.begin("SetAutoConnect")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.AutoConnect = proto.Clone(req).(*pb.SetAutoConnectRequest)
+	s.state.Settings.AutoConnect = req.GetAutoConnect()
+	return ok(), nil
+}
+
+// SetCyberSec implements pb.DaemonServer.
+func (s *Server) SetCyberSec(_ context.Context, req *pb.SetCyberSecRequest) (
+	*pb.Payload, error) {
+	err := s.begin("SetCyberSec")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.CyberSec = req.GetCyberSec()
+	return ok(), nil
+}
+
+// SetDefaults implements pb.DaemonServer.
+func (s *Server) SetDefaults(context.Context, *emptypb.Empty) (*pb.Payload,
+	error) {
+	err := s.begin("SetDefaults")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defaults := NewState()
+	s.state.Settings = defaults.Settings
+	s.state.CyberSec = defaults.CyberSec
+	s.state.Obfuscate = defaults.Obfuscate
+	s.state.Protocol = defaults.Protocol
+	s.state.DNS = defaults.DNS
+	s.state.Whitelist = defaults.Whitelist
+	return ok(), nil
+}
+
+// SetDns implements pb.DaemonServer.
+func (s *Server) SetDns(_ context.Context, req *pb.SetDNSRequest) (
+	*pb.Payload, error) {
+	err := s.begin("SetDns")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.DNS = req.GetDns()
+	s.state.CyberSec = req.GetCyberSec()
+	return ok(), nil
+}
+
+// SetFirewall implements pb.DaemonServer.
+func (s *Server) SetFirewall(_ context.Context, req *pb.SetGenericRequest) (
+	*pb.Payload, error) {
+	err := s.begin("SetFirewall")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Settings.Firewall = req.GetEnabled()
+	return ok(), nil
+}
+
+// SetIpv6 implements pb.DaemonServer.
+func (s *Server) SetIpv6(_ context.Context, req *pb.SetGenericRequest) (
+	*pb.Payload, error) {
+	err := s.begin("SetIpv6")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Settings.Ipv6 = req.GetEnabled()
+	return ok(), nil
+}
+
+// SetKillSwitch implements pb.DaemonServer.
+func (s *Server) SetKillSwitch(_ context.Context,
+	req *pb.SetKillSwitchRequest) (*pb.Payload, error) {
+	err := s.begin("SetKillSwitch")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Settings.KillSwitch = req.GetEnabled()
+	return ok(), nil
+}
+
+// SetNotify implements pb.DaemonServer.
+func (s *Server) SetNotify(_ context.Context, req *pb.SetNotifyRequest) (
+	*pb.Payload, error) {
+	err := s.begin("SetNotify")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Settings.Notify = req.GetNotify()
+	return ok(), nil
+}
+
+// SetObfuscate implements pb.DaemonServer.
+func (s *Server) SetObfuscate(_ context.Context, req *pb.SetGenericRequest) (
+	*pb.Payload, error) {
+	err := s.begin("SetObfuscate")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Obfuscate = req.GetEnabled()
+	return ok(), nil
+}
+
+// SetProtocol implements pb.DaemonServer.
+func (s *Server) SetProtocol(_ context.Context, req *pb.SetProtocolRequest) (
+	*pb.Payload, error) {
+	err := s.begin("SetProtocol")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Protocol = req.GetProtocol()
+	return ok(), nil
+}
+
+// SetTechnology implements pb.DaemonServer.
+func (s *Server) SetTechnology(_ context.Context,
+	req *pb.SetTechnologyRequest) (*pb.Payload, error) {
+	err := s.begin("SetTechnology")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Settings.Technology = req.GetTechnology()
+	return ok(), nil
+}
+
+// SetWhitelist implements pb.DaemonServer.
+func (s *Server) SetWhitelist(_ context.Context,
+	req *pb.SetWhitelistRequest) (*pb.Payload, error) {
+	err := s.begin("SetWhitelist")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Whitelist = proto.Clone(req.GetWhitelist()).(*pb.Whitelist)
+	return ok(), nil
+}
+
+// Settings implements pb.DaemonServer.
+func (s *Server) Settings(context.Context, *emptypb.Empty) (
+	*pb.SettingsResponse, error) {
+	err := s.begin("Settings")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SettingsResponse{
+		Type:     opennord.StatusOk,
+		Settings: proto.Clone(s.state.Settings).(*pb.Settings),
+	}, nil
+}
+
+// SettingsProtocols implements pb.DaemonServer.
+func (s *Server) SettingsProtocols(context.Context, *emptypb.Empty) (
+	*pb.ProtocolsResponse, error) {
+	err := s.begin("SettingsProtocols")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ProtocolsResponse{
+		Type:      opennord.StatusOk,
+		Protocols: s.state.Protocols,
+	}, nil
+}
+
+// SettingsTechnologies implements pb.DaemonServer.
+func (s *Server) SettingsTechnologies(context.Context, *emptypb.Empty) (
+	*pb.TechnologyResponse, error) {
+	err := s.begin("SettingsTechnologies")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.TechnologyResponse{
+		Type:         opennord.StatusOk,
+		Technologies: s.state.Technologies,
+	}, nil
+}
+
+// Status implements pb.DaemonServer.
+func (s *Server) Status(context.Context, *emptypb.Empty) (*pb.StatusResponse,
+	error) {
+	err := s.begin("Status")
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(s.state.Status).(*pb.StatusResponse), nil
+}
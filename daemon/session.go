@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"github.com/adamdb5/opennord/pb"
+	"io"
+)
+
+// ErrNotConnected is returned by Disconnect when the daemon reports that there
+// is no VPN session to end, which usually means the user disconnected with
+// some other tool.
+var ErrNotConnected = errors.New("you are not connected to a VPN")
+
+// SessionClient is the set of daemon RPCs used to start and end a VPN
+// session. It is implemented by Client.
+type SessionClient interface {
+	Connect(ctx context.Context, req *pb.ConnectRequest) (
+		pb.Daemon_ConnectClient, error)
+	Disconnect() error
+	Status() (*pb.StatusResponse, error)
+}
+
+var _ SessionClient = (*Client)(nil)
+
+// Connect sends the connect request to the daemon and consumes the resulting
+// stream, passing each connect event to post as soon as it is parsed. If the
+// stream ends before the daemon reports a connection, ErrConnectInterrupted is
+// returned. If ctx is cancelled, the partially established session is torn
+// down and the context's error is returned without posting a failure. This
+// function blocks until the attempt is over.
+func Connect(ctx context.Context, client SessionClient, req *pb.ConnectRequest,
+	post func(event ConnectEvent)) error {
+	parser := &ConnectParser{}
+	postAll := func(events []ConnectEvent) {
+		for _, event := range events {
+			post(event)
+		}
+	}
+
+	stream, err := client.Connect(ctx, req)
+	if err != nil {
+		postAll(parser.Fail(err))
+		return err
+	}
+
+	for {
+		msg, err := stream.Recv()
+
+		if err == io.EOF {
+			postAll(parser.Finish())
+			if !parser.Connected() {
+				return ErrConnectInterrupted
+			}
+			return nil
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				// The daemon may have started establishing the connection
+				// before the request was cancelled, so make sure it is torn
+				// down.
+				_ = client.Disconnect()
+				return ctx.Err()
+			}
+			postAll(parser.Fail(err))
+			return err
+		}
+
+		postAll(parser.Parse(msg))
+	}
+}
+
+// Disconnect ends the current VPN session, returning the status reported by
+// the daemon beforehand. If there is no session to end, ErrNotConnected is
+// returned along with the status. This function blocks until the daemon has
+// responded.
+func Disconnect(client SessionClient) (*pb.StatusResponse, error) {
+	status, err := client.Status()
+	if err != nil {
+		return nil, err
+	}
+	if status.GetState() == "Disconnected" {
+		return status, ErrNotConnected
+	}
+
+	return status, client.Disconnect()
+}
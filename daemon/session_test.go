@@ -0,0 +1,148 @@
+package daemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/adamdb5/opennord/pb"
+	"main/daemon"
+	"main/daemon/daemonerr"
+	"main/daemon/daemontest"
+	"testing"
+	"time"
+)
+
+func TestConnect(t *testing.T) {
+	server, client := newFakeDaemon(t)
+
+	var events []daemon.ConnectEvent
+	err := daemon.Connect(context.Background(), client,
+		&pb.ConnectRequest{ServerTag: "germany"},
+		func(event daemon.ConnectEvent) { events = append(events, event) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, events, []daemon.ConnectEvent{
+		{Type: daemon.ConnectStarted},
+		{Type: daemon.ConnectServerChosen},
+		{Type: daemon.ConnectConnecting},
+		{Type: daemon.ConnectConnected},
+	})
+
+	server.Update(func(state *daemontest.State) {
+		if tag := state.LastConnectRequest.GetServerTag(); tag != "germany" {
+			t.Errorf("got server tag %q, want \"germany\"", tag)
+		}
+	})
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.GetState() != "Connected" {
+		t.Errorf("got state %q, want \"Connected\"", status.GetState())
+	}
+}
+
+func TestConnectFailure(t *testing.T) {
+	server, client := newFakeDaemon(t)
+	server.Update(func(state *daemontest.State) {
+		state.ConnectMessages = daemontest.ConnectSequenceNotLoggedIn
+		state.ConnectError = daemontest.ErrNotLoggedIn
+	})
+
+	var events []daemon.ConnectEvent
+	err := daemon.Connect(context.Background(), client, &pb.ConnectRequest{},
+		func(event daemon.ConnectEvent) { events = append(events, event) })
+	if !errors.Is(err, daemonerr.ErrNotLoggedIn) {
+		t.Errorf("got error %v, want not logged in", err)
+	}
+	checkEvents(t, events, []daemon.ConnectEvent{
+		{Type: daemon.ConnectStarted},
+		{
+			Type:   daemon.ConnectFailed,
+			Reason: "You are not logged in to NordVPN.",
+		},
+	})
+}
+
+func TestConnectInterrupted(t *testing.T) {
+	server, client := newFakeDaemon(t)
+	server.Update(func(state *daemontest.State) {
+		state.ConnectMessages = daemontest.ConnectSequenceSuccess[:1]
+	})
+
+	var events []daemon.ConnectEvent
+	err := daemon.Connect(context.Background(), client, &pb.ConnectRequest{},
+		func(event daemon.ConnectEvent) { events = append(events, event) })
+	if !errors.Is(err, daemon.ErrConnectInterrupted) {
+		t.Errorf("got error %v, want %v", err, daemon.ErrConnectInterrupted)
+	}
+	if last := events[len(events)-1]; last.Type != daemon.ConnectFailed {
+		t.Errorf("got final event %v, want %v", last.Type,
+			daemon.ConnectFailed)
+	}
+}
+
+func TestConnectCancelled(t *testing.T) {
+	server, client := newFakeDaemon(t)
+	server.Update(func(state *daemontest.State) {
+		state.ConnectDelay = time.Minute
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	var events []daemon.ConnectEvent
+	err := daemon.Connect(ctx, client, &pb.ConnectRequest{},
+		func(event daemon.ConnectEvent) { events = append(events, event) })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %v, want none", events)
+	}
+	if calls := server.Calls("Disconnect"); calls != 1 {
+		t.Errorf("got %d calls to Disconnect, want 1", calls)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	server, client := newFakeDaemon(t)
+	err := daemon.Connect(context.Background(), client, &pb.ConnectRequest{},
+		func(daemon.ConnectEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := daemon.Disconnect(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.GetHostname() != "de123.nordvpn.com" {
+		t.Errorf("got hostname %q, want \"de123.nordvpn.com\"",
+			status.GetHostname())
+	}
+	if calls := server.Calls("Disconnect"); calls != 1 {
+		t.Errorf("got %d calls to Disconnect, want 1", calls)
+	}
+
+	if _, err := daemon.Disconnect(client); !errors.Is(err,
+		daemon.ErrNotConnected) {
+		t.Errorf("got error %v, want %v", err, daemon.ErrNotConnected)
+	}
+	if calls := server.Calls("Disconnect"); calls != 1 {
+		t.Errorf("got %d calls to Disconnect, want 1", calls)
+	}
+}
+
+func TestDisconnectStatusFailure(t *testing.T) {
+	server, client := newFakeDaemon(t)
+	server.Fail("Status", daemontest.ErrNotLoggedIn)
+
+	if _, err := daemon.Disconnect(client); !errors.Is(err,
+		daemonerr.ErrNotLoggedIn) {
+		t.Errorf("got error %v, want not logged in", err)
+	}
+	if calls := server.Calls("Disconnect"); calls != 0 {
+		t.Errorf("got %d calls to Disconnect, want none", calls)
+	}
+}
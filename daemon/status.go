@@ -0,0 +1,247 @@
+package daemon
+
+import (
+	"github.com/adamdb5/opennord/pb"
+	"sync"
+	"time"
+)
+
+// StatusSource is implemented by clients which can report the daemon's
+// connection status.
+type StatusSource interface {
+	Status() (*pb.StatusResponse, error)
+}
+
+// Snapshot is an immutable view of the VPN connection status at a point in
+// time.
+type Snapshot struct {
+	State         string
+	Hostname      string
+	Country       string
+	City          string
+	IP            string
+	Technology    pb.TechnologyEnum
+	Protocol      pb.ProtocolEnum
+	BytesReceived int64
+	BytesSent     int64
+	Uptime        time.Duration
+	// Err is set if the status could not be retrieved from the daemon, in
+	// which case the remaining fields are empty.
+	Err error
+	// Time is the time at which the status was retrieved.
+	Time time.Time
+}
+
+// NewSnapshot creates a Snapshot from the daemon's response to a Status
+// request.
+func NewSnapshot(status *pb.StatusResponse, err error) Snapshot {
+	if err != nil {
+		return Snapshot{Err: err, Time: time.Now()}
+	}
+
+	return Snapshot{
+		State:         status.GetState(),
+		Hostname:      status.GetHostname(),
+		Country:       status.GetCountry(),
+		City:          status.GetCity(),
+		IP:            status.GetIp(),
+		Technology:    status.GetTechnology(),
+		Protocol:      status.GetProtocol(),
+		BytesReceived: status.GetDownload(),
+		BytesSent:     status.GetUpload(),
+		Uptime:        time.Duration(status.GetUptime()),
+		Time:          time.Now(),
+	}
+}
+
+// Connected reports whether the snapshot describes an established VPN
+// session.
+func (s Snapshot) Connected() bool {
+	return s.Err == nil && s.State == "Connected"
+}
+
+// Equal reports whether two snapshots describe the same status, ignoring the
+// time at which they were taken.
+func (s Snapshot) Equal(other Snapshot) bool {
+	if (s.Err == nil) != (other.Err == nil) {
+		return false
+	}
+	if s.Err != nil && s.Err.Error() != other.Err.Error() {
+		return false
+	}
+
+	s.Err, other.Err = nil, nil
+	s.Time, other.Time = time.Time{}, time.Time{}
+	return s == other
+}
+
+// StatusPoller periodically retrieves the connection status from the daemon
+// and publishes a Snapshot to its subscribers whenever the status changes. It
+// is safe for concurrent use.
+//
+// Subscribers are invoked on the poller's goroutine, so any consumer which
+// updates GTK widgets must marshal the update onto the GTK main loop.
+type StatusPoller struct {
+	interval time.Duration
+
+	mu          sync.Mutex
+	source      StatusSource
+	latest      Snapshot
+	published   bool
+	subscribers map[int]func(Snapshot)
+	nextID      int
+	running     bool
+
+	refresh chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewStatusPoller creates a poller which retrieves the status once every
+// interval. The poller does nothing until both a source has been set and
+// Start has been called.
+func NewStatusPoller(interval time.Duration) *StatusPoller {
+	return &StatusPoller{
+		interval:    interval,
+		subscribers: map[int]func(Snapshot){},
+		refresh:     make(chan struct{}, 1),
+	}
+}
+
+// SetSource sets the client used to retrieve the status. A nil source pauses
+// polling.
+func (p *StatusPoller) SetSource(source StatusSource) {
+	p.mu.Lock()
+	p.source = source
+	p.mu.Unlock()
+
+	p.Refresh()
+}
+
+// Subscribe registers fn to receive every published snapshot. If a snapshot
+// has already been published, fn is immediately invoked with it. The returned
+// function removes the subscription.
+func (p *StatusPoller) Subscribe(fn func(Snapshot)) (unsubscribe func()) {
+	p.mu.Lock()
+	id := p.nextID
+	p.nextID++
+	p.subscribers[id] = fn
+	latest, published := p.latest, p.published
+	p.mu.Unlock()
+
+	if published {
+		fn(latest)
+	}
+
+	return func() {
+		p.mu.Lock()
+		delete(p.subscribers, id)
+		p.mu.Unlock()
+	}
+}
+
+// Latest returns the most recently published snapshot.
+func (p *StatusPoller) Latest() Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.latest
+}
+
+// Refresh requests that the status is retrieved immediately rather than at
+// the next interval. It does not block.
+func (p *StatusPoller) Refresh() {
+	select {
+	case p.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Start begins polling on a new goroutine. Calling Start on a running poller
+// has no effect.
+func (p *StatusPoller) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running {
+		return
+	}
+
+	p.running = true
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run(p.stop, p.done)
+}
+
+// Stop stops polling and waits for the polling goroutine to exit. No
+// subscribers are invoked once Stop has returned, but work they have deferred,
+// such as updates queued on the GTK main loop, may still run. Such work should
+// check Running first.
+func (p *StatusPoller) Stop() {
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return
+	}
+	p.running = false
+	stop, done := p.stop, p.done
+	p.mu.Unlock()
+
+	close(stop)
+	<-done
+}
+
+// Running reports whether the poller has been started and not yet stopped.
+func (p *StatusPoller) Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+// run polls the source until stop is closed.
+func (p *StatusPoller) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-p.refresh:
+		}
+	}
+}
+
+// poll retrieves the status from the source and publishes it if it has
+// changed.
+func (p *StatusPoller) poll() {
+	p.mu.Lock()
+	source := p.source
+	p.mu.Unlock()
+
+	if source == nil {
+		return
+	}
+
+	snapshot := NewSnapshot(source.Status())
+
+	p.mu.Lock()
+	if p.published && p.latest.Equal(snapshot) {
+		p.mu.Unlock()
+		return
+	}
+	p.latest = snapshot
+	p.published = true
+	subscribers := make([]func(Snapshot), 0, len(p.subscribers))
+	for _, fn := range p.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	p.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(snapshot)
+	}
+}
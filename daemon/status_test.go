@@ -0,0 +1,45 @@
+package daemon_test
+
+import (
+	"main/daemon"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatusPollerStop(t *testing.T) {
+	_, client := newFakeDaemon(t)
+	poller := daemon.NewStatusPoller(time.Millisecond)
+	poller.SetSource(client)
+
+	var published int32
+	poller.Subscribe(func(daemon.Snapshot) {
+		atomic.AddInt32(&published, 1)
+	})
+	if poller.Running() {
+		t.Error("poller is running before Start")
+	}
+
+	poller.Start()
+	if !poller.Running() {
+		t.Error("poller is not running after Start")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&published) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no snapshot was published")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	poller.Stop()
+	if poller.Running() {
+		t.Error("poller is running after Stop")
+	}
+	count := atomic.LoadInt32(&published)
+	poller.Refresh()
+	time.Sleep(20 * time.Millisecond)
+	if got := atomic.LoadInt32(&published); got != count {
+		t.Errorf("got %d snapshots after Stop, want none", got-count)
+	}
+}
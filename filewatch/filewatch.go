@@ -0,0 +1,150 @@
+// Package filewatch reports changes to files made by other programs, using
+// inotify.
+package filewatch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// watchMask selects the events which indicate that a file in a watched
+// directory has been written, replaced or removed. Editors and dotfile tools
+// often replace a file by renaming a new file over it, so the directory is
+// watched rather than the file itself.
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// Watcher watches a file for changes.
+type Watcher struct {
+	file    *os.File
+	names   map[int32]map[string]bool
+	delay   time.Duration
+	changed func()
+
+	mutex sync.Mutex
+	timer *time.Timer
+}
+
+// Watch starts watching the file at path, which need not exist. If path is a
+// symbolic link, the file it points to is watched as well. Once the file
+// has changed and no further changes have been made for the given delay,
+// changed is invoked on a separate goroutine. Bursts of changes, such as
+// writing a file in several parts, are therefore reported once.
+func Watch(path string, delay time.Duration, changed func()) (*Watcher,
+	error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	// As the descriptor is non-blocking, reads wait using the runtime's
+	// poller, and are interrupted when the file is closed.
+	watcher := &Watcher{
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		names:   map[int32]map[string]bool{},
+		delay:   delay,
+		changed: changed,
+	}
+
+	paths := []string{path}
+	if target, err := filepath.EvalSymlinks(path); err == nil &&
+		target != path {
+		paths = append(paths, target)
+	}
+
+	for _, path := range paths {
+		wd, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), watchMask)
+		if err != nil {
+			_ = watcher.file.Close()
+			return nil, os.NewSyscallError("inotify_add_watch", err)
+		}
+		// A link and its target in the same directory share a descriptor
+		if watcher.names[int32(wd)] == nil {
+			watcher.names[int32(wd)] = map[string]bool{}
+		}
+		watcher.names[int32(wd)][filepath.Base(path)] = true
+	}
+
+	go watcher.run()
+	return watcher, nil
+}
+
+// Close stops watching the file. Changes which are waiting for the delay to
+// pass are not reported.
+func (watcher *Watcher) Close() error {
+	watcher.mutex.Lock()
+	if watcher.timer != nil {
+		watcher.timer.Stop()
+	}
+	watcher.mutex.Unlock()
+
+	return watcher.file.Close()
+}
+
+// run reads events until the watcher is closed. Should reading fail for any
+// reason other than an interrupted system call, the error would recur on every
+// read, so no further changes are reported.
+func (watcher *Watcher) run() {
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := watcher.file.Read(buffer)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		if watcher.matches(buffer[:n]) {
+			watcher.schedule()
+		}
+	}
+}
+
+// matches reports whether any of the events in buffer concern the watched
+// file.
+func (watcher *Watcher) matches(buffer []byte) bool {
+	matched := false
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buffer); {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+		start := offset + syscall.SizeofInotifyEvent
+		end := start + int(event.Len)
+		if end > len(buffer) {
+			break
+		}
+		offset = end
+
+		name := string(trimNul(buffer[start:end]))
+		if watcher.names[event.Wd][name] {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// schedule invokes changed once the delay has passed, postponing any earlier
+// invocation which is still waiting.
+func (watcher *Watcher) schedule() {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	if watcher.timer != nil {
+		watcher.timer.Stop()
+	}
+	watcher.timer = time.AfterFunc(watcher.delay, watcher.changed)
+}
+
+// trimNul removes the padding following an event's file name.
+func trimNul(name []byte) []byte {
+	for i, b := range name {
+		if b == 0 {
+			return name[:i]
+		}
+	}
+	return name
+}
@@ -4,7 +4,12 @@ go 1.17
 
 require github.com/gotk3/gotk3 v0.6.1
 
-require github.com/adamdb5/opennord v1.0.0
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/adamdb5/opennord v1.0.0
+	google.golang.org/grpc v1.43.0
+	google.golang.org/protobuf v1.25.0
+)
 
 require (
 	github.com/golang/protobuf v1.4.3 // indirect
@@ -12,6 +17,4 @@ require (
 	golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd // indirect
 	golang.org/x/text v0.3.0 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
-	google.golang.org/grpc v1.43.0 // indirect
-	google.golang.org/protobuf v1.25.0 // indirect
 )
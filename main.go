@@ -3,32 +3,90 @@ package main
 import (
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
+	"main/cmdline"
 	"main/types"
 	"main/util"
 	"os"
 )
 
+// defaultUIPath is the GtkBuilder file defining the interface, unless another
+// is given with --ui.
+const defaultUIPath = "ui/window.glade"
+
 func main() {
 	application, _ := gtk.ApplicationNew(types.AppId,
 		glib.APPLICATION_FLAGS_NONE)
 
-	application.Connect("activate", func() {
-		builder, err := gtk.BuilderNewFromFile("ui/window.glade")
+	configOption := cmdline.AddStringOption(&application.Application,
+		"config", "PATH", "Use the config file at PATH")
+	profileOption := cmdline.AddStringOption(&application.Application,
+		"profile", "NAME", "Use the saved profile NAME for this run")
+	protocolOption := cmdline.AddStringOption(&application.Application,
+		"protocol", "UDP|TCP", "Use the given protocol for this run")
+	technologyOption := cmdline.AddStringOption(&application.Application,
+		"technology", "OPENVPN|NORDLYNX",
+		"Use the given technology for this run")
+	noAutoConnectOption := cmdline.AddFlagOption(&application.Application,
+		"no-autoconnect", "Disable auto-connect for this run")
+	uiOption := cmdline.AddStringOption(&application.Application,
+		"ui", "PATH", "Build the interface from the GtkBuilder file at PATH")
+	printConfigOption := cmdline.AddFlagOption(&application.Application,
+		"print-effective-config",
+		"Print the config with the overrides applied, then exit")
+
+	var overrides types.Overrides
+
+	// The options have been parsed by the time this signal is emitted.
+	// Returning -1 continues to activate the application, and any other value
+	// exits with that status.
+	application.Connect("handle-local-options", func() int {
+		environment, err := types.OverridesFromEnvironment()
 		if err != nil {
-			util.LogFatal("Could not build interface", err)
+			util.LogError("Invalid environment", err)
+			return 1
+		}
+
+		overrides = environment.Merge(types.Overrides{
+			ConfigPath:    configOption.Value(),
+			UIPath:        uiOption.Value(),
+			Profile:       profileOption.Value(),
+			Protocol:      protocolOption.Value(),
+			Technology:    technologyOption.Value(),
+			NoAutoConnect: noAutoConnectOption.Set(),
+		})
+
+		if printConfigOption.Set() {
+			if err := types.PrintEffectiveConfig(overrides,
+				os.Stdout); err != nil {
+				util.LogError("Unable to print config", err)
+				return 1
+			}
+			return 0
 		}
+		return -1
+	})
 
-		app := types.BuildApplication(builder)
-		err = app.ConnectToDaemon()
+	application.Connect("activate", func() {
+		uiPath := overrides.UIPath
+		if uiPath == "" {
+			uiPath = defaultUIPath
+		}
+
+		builder, err := gtk.BuilderNewFromFile(uiPath)
 		if err != nil {
-			infoBar := app.Window.InfoBar
-			infoBar.Button.SetLabel("Retry")
-			infoBar.Button.Connect("clicked", app.ConnectToDaemon)
-			infoBar.DisplayMessage("Could not connect to NordVPN daemon",
-				gtk.MESSAGE_ERROR)
+			util.LogFatal("Could not build interface", err)
 		}
 
-		go app.UpdateSessionStatus()
+		app := types.BuildApplication(builder, overrides)
+		// Failures are reported in the info bar by ConnectToDaemon
+		app.ConnectToDaemon()
+
+		app.StatusPoller.Start()
+		application.Connect("shutdown", func() {
+			app.Supervisor.Stop()
+			app.StatusPoller.Stop()
+			app.StopConfigWatcher()
+		})
 
 		gtkWindow := app.Window.Window
 		gtkWindow.Show()
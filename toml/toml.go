@@ -0,0 +1,160 @@
+// Package toml encodes and decodes TOML documents using
+// github.com/BurntSushi/toml, converting them to and from the generic values
+// produced by encoding/json. Values which JSON cannot represent are rejected:
+// dates and times, and infinite and NaN floats.
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	burntsushi "github.com/BurntSushi/toml"
+	"math"
+	"strings"
+	"time"
+)
+
+// Marshal encodes fields as a TOML document. The values must be those
+// produced by decoding JSON into an interface{}: nil, bool, float64, string,
+// []interface{} and map[string]interface{}. As TOML has no null, fields whose
+// value is nil are omitted.
+func Marshal(fields map[string]interface{}) ([]byte, error) {
+	table, err := encodeTable(nil, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	encoder := burntsushi.NewEncoder(&buffer)
+	encoder.Indent = ""
+	if err := encoder.Encode(table); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// encodeTable converts the values of table, found at path, to those written
+// by the encoder. Fields whose value is nil are omitted.
+func encodeTable(path []string, table map[string]interface{}) (
+	map[string]interface{}, error) {
+	converted := make(map[string]interface{}, len(table))
+	for key, value := range table {
+		if value == nil {
+			continue
+		}
+		value, err := encodeValue(append(path[:len(path):len(path)], key),
+			value)
+		if err != nil {
+			return nil, err
+		}
+		converted[key] = value
+	}
+	return converted, nil
+}
+
+// encodeValue converts a value found at path to one written by the encoder.
+// Whole numbers are converted to integers, so that they are not written as
+// floats such as 1.0.
+func encodeValue(path []string, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("%s: null cannot be represented in TOML",
+			strings.Join(path, "."))
+	case bool, int, int64, string:
+		return value, nil
+	case float64:
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return nil, fmt.Errorf("%s: unsupported number %v: infinite and "+
+				"NaN floats are not supported", strings.Join(path, "."),
+				value)
+		}
+		if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+			return int64(value), nil
+		}
+		return value, nil
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, element := range value {
+			var err error
+			converted[i], err = encodeValue(path, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return converted, nil
+	case map[string]interface{}:
+		return encodeTable(path, value)
+	default:
+		return nil, fmt.Errorf("%s: unsupported value of type %T",
+			strings.Join(path, "."), value)
+	}
+}
+
+// Unmarshal decodes a TOML document into the generic values produced by
+// encoding/json, except that integers are decoded as int64.
+func Unmarshal(data []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if _, err := burntsushi.Decode(string(data), &fields); err != nil {
+		return nil, err
+	}
+	return decodeTable(nil, fields)
+}
+
+// decodeTable converts the values of a decoded table, found at path, to
+// those produced by encoding/json.
+func decodeTable(path []string, table map[string]interface{}) (
+	map[string]interface{}, error) {
+	converted := make(map[string]interface{}, len(table))
+	for key, value := range table {
+		value, err := decodeValue(append(path[:len(path):len(path)], key),
+			value)
+		if err != nil {
+			return nil, err
+		}
+		converted[key] = value
+	}
+	return converted, nil
+}
+
+// decodeValue converts a decoded value, found at path, to one produced by
+// encoding/json. Arrays of tables are converted to []interface{}.
+func decodeValue(path []string, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case bool, int64, string:
+		return value, nil
+	case float64:
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return nil, fmt.Errorf("%s: unsupported number %v: infinite and "+
+				"NaN floats are not supported", strings.Join(path, "."),
+				value)
+		}
+		return value, nil
+	case time.Time:
+		return nil, fmt.Errorf("%s: dates and times are not supported",
+			strings.Join(path, "."))
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, element := range value {
+			var err error
+			converted[i], err = decodeValue(path, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return converted, nil
+	case []map[string]interface{}:
+		converted := make([]interface{}, len(value))
+		for i, element := range value {
+			var err error
+			converted[i], err = decodeTable(path, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return converted, nil
+	case map[string]interface{}:
+		return decodeTable(path, value)
+	default:
+		return nil, fmt.Errorf("%s: unsupported value of type %T",
+			strings.Join(path, "."), value)
+	}
+}
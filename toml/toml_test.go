@@ -0,0 +1,194 @@
+package toml
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bundle is a document of the shape exported by the application.
+const bundle = `{
+  "Format": "nordvpn-gtk-bundle",
+  "Version": 1,
+  "ActiveProfile": "work \"office\"",
+  "Settings": {
+    "Protocol": "UDP",
+    "KillSwitch": true,
+    "DNS": ["1.1.1.1", "8.8.8.8"],
+    "Ratio": 0.25,
+    "Empty": [],
+    "WhiteList": {"Subnets": ["10.0.0.0/8"], "UDPPorts": [{"From": 53}]}
+  },
+  "Profiles": {
+    "café\ttab": {"Protocol": "TCP", "Nested": {"Deep": {"Value": -12}}},
+    "home": {"Protocol": "UDP", "Servers": [{"Tag": "de"}, {"Tag": "uk"}]}
+  }
+}`
+
+// jsonFields decodes a JSON document as the application does.
+func jsonFields(t *testing.T, document string) map[string]interface{} {
+	t.Helper()
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(document), &fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+// normalise converts the values decoded from TOML to those decoded from JSON,
+// so that the two may be compared.
+func normalise(t *testing.T, fields map[string]interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatalf("decoded document cannot be encoded as JSON: %v", err)
+	}
+	var normalised interface{}
+	if err := json.Unmarshal(data, &normalised); err != nil {
+		t.Fatal(err)
+	}
+	return normalised
+}
+
+func TestRoundTrip(t *testing.T) {
+	fields := jsonFields(t, bundle)
+
+	data, err := Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("%v in\n%s", err, data)
+	}
+
+	var want interface{} = fields
+	if got := normalise(t, decoded); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v\nfrom\n%s", got, want, data)
+	}
+}
+
+func TestMarshalOmitsNull(t *testing.T) {
+	data, err := Marshal(jsonFields(t, `{"A": null, "B": {"C": null}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "C") || strings.Contains(string(data),
+		"A =") {
+		t.Errorf("null fields were written:\n%s", data)
+	}
+}
+
+func TestMarshalRejectsNonFinite(t *testing.T) {
+	for _, number := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		fields := map[string]interface{}{"Number": number}
+		data, err := Marshal(fields)
+		if err == nil {
+			t.Errorf("%v was encoded as\n%s", number, data)
+		} else if !strings.Contains(err.Error(), "not supported") {
+			t.Errorf("got error %q, want it to say %v is not supported",
+				err, number)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{
+			name:     "implicit parent table",
+			document: "[a.b]\nc = 1\n[a]\nd = 2\n",
+			want:     `{"a": {"b": {"c": 1}, "d": 2}}`,
+		},
+		{
+			name:     "sub-table of dotted key",
+			document: "[a]\nb.c = 1\n[a.b.d]\ne = 2\n",
+			want:     `{"a": {"b": {"c": 1, "d": {"e": 2}}}}`,
+		},
+		{
+			name: "array of tables",
+			document: "[[a]]\nb = 1\n[a.c]\nd = 2\n" +
+				"[[a]]\nb = 3\n[a.c]\nd = 4\n",
+			want: `{"a": [{"b": 1, "c": {"d": 2}}, ` +
+				`{"b": 3, "c": {"d": 4}}]}`,
+		},
+		{
+			name:     "strings",
+			document: `a = "tab\there \u00e9" # comment` + "\nb = 'C:\\path'\n",
+			want:     `{"a": "tab\there é", "b": "C:\\path"}`,
+		},
+		{
+			name:     "multi-line strings",
+			document: "a = \"\"\"\nfirst\nsecond\"\"\"\nb = '''\nC:\\path'''\n",
+			want:     `{"a": "first\nsecond", "b": "C:\\path"}`,
+		},
+		{
+			name:     "numbers",
+			document: "a = 1_000\nb = -0.5\nc = 1e3\nd = 0x1f\n",
+			want:     `{"a": 1000, "b": -0.5, "c": 1000, "d": 31}`,
+		},
+		{
+			name:     "inline values",
+			document: "a = [1, [true, 'x'], { b = 2 }]\nc = {}\n",
+			want:     `{"a": [1, [true, "x"], {"b": 2}], "c": {}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := Unmarshal([]byte(test.document))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want interface{} = jsonFields(t, test.want)
+			if got := normalise(t, fields); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"duplicate table", "[a]\nb = 1\n[a]\nc = 2\n"},
+		{"duplicate empty table", "[a]\n[a]\n"},
+		{"duplicate nested table", "[a.b]\n[a]\n[a.b]\n"},
+		{"table defined by key", "a = { b = 1 }\n[a]\nc = 2\n"},
+		{"table header for array of tables", "[[a]]\n[a]\n"},
+		{"array of tables for static array", "a = [1]\n[[a]]\n"},
+		{"array of tables for inline tables", "a = [{ b = 1 }]\n[[a]]\n"},
+		{"duplicate key", "a = 1\na = 2\n"},
+		{"positive infinity", "a = inf\n"},
+		{"signed infinity", "a = +inf\n"},
+		{"negative infinity", "a = -inf\n"},
+		{"nan", "a = nan\n"},
+		{"signed nan", "a = -nan\n"},
+		{"infinity in array", "a = [1, inf]\n"},
+		{"date", "a = 1979-05-27\n"},
+		{"date-time", "a = 1979-05-27T07:32:00Z\n"},
+		{"time in array of tables", "[[a]]\nb = [07:32:00]\n"},
+		{"leading zero", "a = 012\n"},
+		{"unterminated string", "a = \"text\n"},
+		{"invalid escape", `a = "\q"`},
+		{"missing value", "a =\n"},
+		{"trailing characters", "a = 1 2\n"},
+		{"invalid UTF-8", "a = \"\xff\"\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := Unmarshal([]byte(test.document))
+			if err == nil {
+				t.Errorf("got %v, want an error", fields)
+			}
+		})
+	}
+}
@@ -1,14 +1,17 @@
 package types
 
 import (
+	"context"
 	"github.com/adamdb5/opennord/pb"
 	"github.com/gotk3/gotk3/gtk"
+	"main/daemon"
 	"main/util"
 	"os/exec"
 )
 
 // AccountTab contains the GTK components for the 'Account' GTKNotebook page.
 type AccountTab struct {
+	Grid              *gtk.Grid
 	StatusLabel       *gtk.Label
 	EmailLabel        *gtk.Label
 	ExpiresLabel      *gtk.Label
@@ -22,12 +25,16 @@ type AccountTab struct {
 	OpenBrowserButton *gtk.Button
 	LoginFrame        *gtk.Frame
 	OAuthFrame        *gtk.Frame
+
+	loggedIn        bool
+	connectionState daemon.ConnectionState
 }
 
 // BuildAccountTab constructs the GTKNotebook page for the 'Account' tab from
 // the provided builder.
 func BuildAccountTab(builder *gtk.Builder) *AccountTab {
 	return &AccountTab{
+		Grid: util.BuilderGetGrid(builder, "account_grid"),
 		StatusLabel: util.BuilderGetLabel(builder,
 			"account_status_label"),
 		EmailLabel: util.BuilderGetLabel(builder,
@@ -57,24 +64,50 @@ func BuildAccountTab(builder *gtk.Builder) *AccountTab {
 	}
 }
 
+// SetLoggedIn enables the login options if the user is logged out, or the
+// 'Logout' button if the user is logged in.
+func (accountTab *AccountTab) SetLoggedIn(loggedIn bool) {
+	accountTab.loggedIn = loggedIn
+	accountTab.updateSensitivity()
+}
+
+// UpdateControls disables the login and logout options while the connection
+// state is changing.
+func (accountTab *AccountTab) UpdateControls(state daemon.ConnectionState) {
+	accountTab.connectionState = state
+	accountTab.updateSensitivity()
+}
+
+// updateSensitivity enables / disables the login and logout options depending
+// on whether the user is logged in and the connection state.
+func (accountTab *AccountTab) updateSensitivity() {
+	idle := !accountTab.connectionState.Transitioning()
+	accountTab.LoginFrame.SetSensitive(idle && !accountTab.loggedIn)
+	accountTab.OAuthFrame.SetSensitive(idle && !accountTab.loggedIn)
+	accountTab.LogoutButton.SetSensitive(idle && accountTab.loggedIn)
+}
+
 // AccountRefreshClicked is invoked whenever the 'Refresh' button on the
 // 'Account' tab is clicked.
 func AccountRefreshClicked(app *Application) error {
-	isLoggedIn, err := app.Client.IsLoggedIn()
-
-	if err != nil {
-		util.LogError("Lost connection to NordVPN daemon", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage(
-			"Lost connection to NordVPN daemon", gtk.MESSAGE_ERROR)
+	var isLoggedIn *pb.IsLoggedInResponse
+	client := app.Client
+
+	app.RunOperation("Refreshing account...", func(context.Context) error {
+		var err error
+		isLoggedIn, err = client.IsLoggedIn()
 		return err
-	}
+	}, func(err error) {
+		if err != nil {
+			app.DisplayError("Unable to refresh account", err,
+				func() { _ = AccountRefreshClicked(app) })
+			return
+		}
 
-	if isLoggedIn.GetIsLoggedIn() {
-		_ = app.UpdateAccountInformation()
-	}
+		if isLoggedIn.GetIsLoggedIn() {
+			app.UpdateAccountInformation()
+		}
+	})
 
 	return nil
 }
@@ -82,43 +115,49 @@ func AccountRefreshClicked(app *Application) error {
 // GenerateOAuthClicked is invoked whenever the 'Generate OAuth Token' button
 // on the 'Account' tab is clicked.
 func GenerateOAuthClicked(app *Application) error {
-	isLoggedIn, err := app.Client.IsLoggedIn()
 	infoBar := app.Window.InfoBar
+	var isLoggedIn *pb.IsLoggedInResponse
+	var oauth *pb.LoginOAuth2Response
+	var loggedInErr error
+	client := app.Client
+
+	app.RunOperation("Generating OAuth token...", func(context.Context) error {
+		isLoggedIn, loggedInErr = client.IsLoggedIn()
+		if loggedInErr != nil || isLoggedIn.GetIsLoggedIn() {
+			return nil
+		}
 
-	if err != nil {
-		util.LogError("Lost connection to NordVPN daemon", err)
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Lost connection to NordVPN daemon",
-			gtk.MESSAGE_ERROR)
+		var err error
+		oauth, err = client.LoginOAuth2()
 		return err
-	}
-
-	// This should only happen if the user already logged in using the CLI
-	if isLoggedIn.GetIsLoggedIn() {
-		_ = app.UpdateAccountInformation()
-		return nil
-	}
+	}, func(err error) {
+		if loggedInErr != nil {
+			app.DisplayError("Unable to get OAuth token", loggedInErr,
+				func() { _ = GenerateOAuthClicked(app) })
+			return
+		}
 
-	oauth, err := app.Client.LoginOAuth2()
-	if err != nil {
-		util.LogError("Unable to get OAuth token", err)
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to get OAuth token", gtk.MESSAGE_ERROR)
-		return err
-	}
+		// This should only happen if the user already logged in using the CLI
+		if isLoggedIn.GetIsLoggedIn() {
+			app.UpdateAccountInformation()
+			return
+		}
 
-	accountTab := app.Window.AccountTab
-	accountTab.OAuthURLEntry.SetText(oauth.GetUrl())
-	accountTab.OpenBrowserButton.Connect("clicked", func() {
-		err = exec.Command("xdg-open", oauth.GetUrl()).Start()
 		if err != nil {
-			util.LogError("Unable to open URL", err)
-			infoBar.Button.SetLabel("Dismiss")
-			infoBar.Button.Connect("clicked", infoBar.HideMessage)
-			infoBar.DisplayMessage("Unable to open URL", gtk.MESSAGE_ERROR)
+			app.DisplayError("Unable to get OAuth token", err,
+				func() { _ = GenerateOAuthClicked(app) })
+			return
 		}
+
+		accountTab := app.Window.AccountTab
+		accountTab.OAuthURLEntry.SetText(oauth.GetUrl())
+		accountTab.OpenBrowserButton.Connect("clicked", func() {
+			err = exec.Command("xdg-open", oauth.GetUrl()).Start()
+			if err != nil {
+				util.LogError("Unable to open URL", err)
+				infoBar.DisplayMessage("Unable to open URL", gtk.MESSAGE_ERROR)
+			}
+		})
 	})
 
 	return nil
@@ -127,80 +166,88 @@ func GenerateOAuthClicked(app *Application) error {
 // LoginClicked is invoked whenever the 'Login' button on the 'Account' tab is
 // clicked.
 func LoginClicked(app *Application) error {
-	isLoggedIn, err := app.Client.IsLoggedIn()
 	infoBar := app.Window.InfoBar
+	username, _ := app.Window.AccountTab.EmailEntry.GetText()
+	password, _ := app.Window.AccountTab.PasswordEntry.GetText()
+	var isLoggedIn *pb.IsLoggedInResponse
+	var loggedInErr error
+	client := app.Client
+
+	app.RunOperation("Logging in...", func(context.Context) error {
+		isLoggedIn, loggedInErr = client.IsLoggedIn()
+		if loggedInErr != nil || isLoggedIn.GetIsLoggedIn() {
+			return nil
+		}
 
-	if err != nil {
-		util.LogError("Lost connection to NordVPN daemon", err)
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Lost connection to NordVPN daemon",
-			gtk.MESSAGE_ERROR)
-		return err
-	}
+		return client.Login(&pb.LoginRequest{
+			Username: username,
+			Password: password,
+		})
+	}, func(err error) {
+		if loggedInErr != nil {
+			app.DisplayError("Unable to log in", loggedInErr,
+				func() { _ = LoginClicked(app) })
+			return
+		}
 
-	// This should only happen if the user already logged in using the CLI
-	if isLoggedIn.GetIsLoggedIn() {
-		_ = app.UpdateAccountInformation()
-		return nil
-	}
+		// This should only happen if the user already logged in using the CLI
+		if isLoggedIn.GetIsLoggedIn() {
+			app.UpdateAccountInformation()
+			return
+		}
 
-	username, _ := app.Window.AccountTab.EmailEntry.GetText()
-	password, _ := app.Window.AccountTab.PasswordEntry.GetText()
-	err = app.Client.Login(&pb.LoginRequest{
-		Username: username,
-		Password: password,
+		if err != nil {
+			app.DisplayError("Unable to log in", err, nil)
+			return
+		}
+
+		app.UpdateAccountInformation()
+		util.LogInfo("Logged in using email " + username)
+		infoBar.DisplayMessage("Logged in using email "+username,
+			gtk.MESSAGE_INFO)
 	})
-	if err != nil {
-		util.LogError("Unable to log in", err)
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to log in", gtk.MESSAGE_ERROR)
-		return err
-	}
 
-	_ = app.UpdateAccountInformation()
-	util.LogInfo("Logged in using email" + username)
-	infoBar.Button.SetLabel("Dismiss")
-	infoBar.Button.Connect("clicked", infoBar.HideMessage)
-	infoBar.DisplayMessage("Logged in using email "+username, gtk.MESSAGE_INFO)
 	return nil
 }
 
 // LogoutClicked is invoked whenever the 'Logout' button on the 'Account' tab is
 // clicked.
 func LogoutClicked(app *Application) error {
-	isLoggedIn, err := app.Client.IsLoggedIn()
 	infoBar := app.Window.InfoBar
+	var isLoggedIn *pb.IsLoggedInResponse
+	var loggedInErr error
+	client := app.Client
+
+	app.RunOperation("Logging out...", func(context.Context) error {
+		isLoggedIn, loggedInErr = client.IsLoggedIn()
+		if loggedInErr != nil || !isLoggedIn.GetIsLoggedIn() {
+			return nil
+		}
 
-	if err != nil {
-		util.LogError("Lost connection to NordVPN", err)
-		infoBar.Button.SetLabel("Reconnect")
-		infoBar.Button.Connect("clicked", func() { _ = app.ConnectToDaemon() })
-		infoBar.DisplayMessage("Lost connection to NordVPN daemon",
-			gtk.MESSAGE_ERROR)
-		return err
-	}
+		return client.Logout()
+	}, func(err error) {
+		if loggedInErr != nil {
+			app.DisplayError("Unable to log out", loggedInErr,
+				func() { _ = LogoutClicked(app) })
+			return
+		}
 
-	// This should only happen if the user already logged out using the CLI
-	if !isLoggedIn.GetIsLoggedIn() {
-		_ = app.UpdateAccountInformation()
-		return nil
-	}
+		// This should only happen if the user already logged out using the CLI
+		if !isLoggedIn.GetIsLoggedIn() {
+			app.UpdateAccountInformation()
+			return
+		}
 
-	err = app.Client.Logout()
-	if err != nil {
-		util.LogError("Unable to log out", err)
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to log out", gtk.MESSAGE_ERROR)
-		return err
-	}
+		if err != nil {
+			app.DisplayError("Unable to log out", err,
+				func() { _ = LogoutClicked(app) })
+			return
+		}
+
+		app.UpdateAccountInformation()
+		util.LogInfo("Logged out")
+		infoBar.DisplayMessage("Successfully logged out.", gtk.MESSAGE_INFO)
+	})
 
-	_ = app.UpdateAccountInformation()
-	util.LogInfo("Logged out")
-	infoBar.Button.SetLabel("Dismiss")
-	infoBar.Button.Connect("clicked", infoBar.HideMessage)
-	infoBar.DisplayMessage("Successfully logged out.", gtk.MESSAGE_INFO)
 	return nil
 }
@@ -1,295 +1,560 @@
 package types
 
 import (
+	"context"
 	"errors"
-	"github.com/adamdb5/opennord"
 	"github.com/adamdb5/opennord/pb"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
-	"io"
+	"main/daemon"
+	"main/daemon/daemonerr"
+	"main/filewatch"
 	"main/util"
+	"main/whitelist"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// Application contains references to the OpenNord client and all functional
+// Application contains references to the daemon client and all functional
 // GTK Controls.
 type Application struct {
-	Client *opennord.Client
-	Window *Window
-	Config *Config
+	Client       DaemonClient
+	Window       *Window
+	Config       *Config
+	StatusPoller *daemon.StatusPoller
+	Connection   *daemon.ConnectionStateMachine
+	Supervisor   *DaemonSupervisor
+	// Presets is the catalogue of whitelist presets which may be enabled.
+	Presets *whitelist.Catalogue
+	// ConfigPath is the path of the user's config file, or empty if it could
+	// not be determined, in which case the config cannot be saved.
+	ConfigPath string
+	// Overrides are the settings given on the command line or in the
+	// environment, which are applied whenever the config is loaded.
+	Overrides Overrides
+
+	// DialDaemon creates the client used by ConnectToDaemon and the daemon
+	// supervisor. It defaults to DialSystemDaemon, and may be replaced to
+	// connect to a fake daemon.
+	DialDaemon func() (DaemonClient, error)
+
+	callbacksRegistered bool
+
+	// populating is set while the controls are being populated, during which
+	// the settings callbacks are not invoked.
+	populating bool
+
+	// groupsRequests counts the requests for the groups, so that only the
+	// groups retrieved by the latest request are listed.
+	groupsRequests uint64
+
+	// resolvingHostnames is set while the whitelisted hostnames are being
+	// resolved, and resolveHostnamesAgain if they should be resolved again
+	// once finished.
+	resolvingHostnames    bool
+	resolveHostnamesAgain bool
+
+	// appliedWhiteList is the whitelist as it was last accepted by the
+	// daemon, which the expired entries and moved hostnames are removed from
+	// and updated in, so that unapplied edits to the whitelist in use are not
+	// sent to the daemon behind the user's back.
+	appliedWhiteList *WhiteList
+	// expiringWhitelist is set while expired entries are being removed from
+	// the daemon. After a failure, they are removed again once expiryRetryAt
+	// has passed, which is delayed by expiryBackoff so that the failure is
+	// not reported every WhitelistExpiryInterval.
+	expiringWhitelist bool
+	expiryRetryAt     time.Time
+	expiryBackoff     *daemon.Backoff
+
+	// configWatcher reloads the config when the config file is changed by
+	// another program, or is nil if the file is not being watched.
+	configWatcher *filewatch.Watcher
 }
 
 // BuildApplication instantiates the Application and registers the GTK
-// components.
-func BuildApplication(builder *gtk.Builder) *Application {
+// components. The config is loaded from the path given in the overrides, or
+// the default path otherwise, and the overrides are then applied to it.
+func BuildApplication(builder *gtk.Builder, overrides Overrides) *Application {
 	window := BuildWindow(builder)
+
+	configPath := overrides.ConfigPath
+	if configPath == "" {
+		var err error
+		if configPath, err = DefaultConfigPath(); err != nil {
+			util.LogWarning("Unable to determine user config directory", err)
+		}
+	}
+	config, configProblems := LoadConfig(configPath)
+	for _, problem := range config.ApplyOverrides(overrides) {
+		util.LogWarning("Unable to apply override: "+problem, nil)
+		configProblems = append(configProblems, problem)
+	}
+
 	app := &Application{
-		Client: nil,
-		Window: window,
-		Config: LoadConfig(),
+		Client:       nil,
+		Window:       window,
+		Config:       config,
+		ConfigPath:   configPath,
+		Overrides:    overrides,
+		Presets:      LoadPresets(),
+		StatusPoller: daemon.NewStatusPoller(StatusPollInterval),
+		Connection:   daemon.NewConnectionStateMachine(),
+		DialDaemon:   DialSystemDaemon,
+		expiryBackoff: daemon.NewBackoff(ReconnectInitialDelay,
+			ReconnectMaxDelay),
 	}
+	// Until the whitelist is next applied, the daemon is taken to be using
+	// the saved whitelist
+	app.appliedWhiteList = config.WhiteList.Clone()
+	app.Supervisor = NewDaemonSupervisor(app)
+	app.PopulateProfiles()
+	app.ReportConfigProblems(configProblems)
+	app.StartWhitelistExpiry()
+	app.StartHostnameResolution()
+	app.StartConfigWatcher()
+
+	app.Connection.OnTransition(func(transition daemon.Transition) {
+		util.LogInfo("Connection state changed from " +
+			transition.From.String() + " to " + transition.To.String())
+		app.UpdateControls(transition.To)
+	})
+	app.ApplyLocks()
+
+	app.SubscribeStatus(func(snapshot daemon.Snapshot) {
+		app.UpdateConnectionStatus(snapshot)
+		app.UpdateSessionStatus(snapshot)
+	})
 
 	return app
 }
 
+// ReportConfigProblems displays the problems found while loading the config
+// file in the info bar.
+func (app *Application) ReportConfigProblems(problems []string) {
+	if len(problems) == 0 {
+		return
+	}
+
+	text := "Problem with your config file: " + problems[0]
+	if len(problems) > 1 {
+		text = strconv.Itoa(len(problems)) + " problems with your config " +
+			"file: " + strings.Join(problems, "; ")
+	}
+	app.Window.InfoBar.DisplayMessage(text, gtk.MESSAGE_WARNING)
+}
+
 // RegisterCallbacks connects the GUI controls to the corresponding callbacks.
-func (app Application) RegisterCallbacks() {
+// Callbacks must only be registered once, otherwise each control would invoke
+// its callback multiple times.
+func (app *Application) RegisterCallbacks() {
 	// Connect
 	app.Window.ConnectTab.DisconnectButton.Connect("clicked",
-		func() { _ = DisconnectClicked(&app) })
+		func() { _ = DisconnectClicked(app) })
 	app.Window.ConnectTab.CountriesComboBoxText.Connect("changed",
-		func() { CountrySelected(&app) })
+		func() { CountrySelected(app) })
 	app.Window.ConnectTab.CountryConnectButton.Connect("clicked",
-		func() { _ = ConnectToCountry(&app) })
+		func() { _ = ConnectToCountry(app) })
 	app.Window.ConnectTab.CityConnectButton.Connect("clicked",
-		func() { _ = ConnectToCity(&app) })
+		func() { _ = ConnectToCity(app) })
 	app.Window.ConnectTab.GroupConnectButton.Connect("clicked",
-		func() { _ = ConnectToGroup(&app) })
+		func() { _ = ConnectToGroup(app) })
 	app.Window.ConnectTab.ServerConnectButton.Connect("clicked",
-		func() { _ = ConnectToServer(&app) })
+		func() { _ = ConnectToServer(app) })
 	app.Window.ConnectTab.BestConnectButton.Connect("clicked",
 		func() { _ = app.Connect("") })
 	app.Window.ConnectTab.SaveButton.Connect("clicked",
-		func() { _ = ConnectSaveClicked(&app) })
+		func() { _ = ConnectSaveClicked(app) })
+	app.Window.ConnectTab.OverrideCheckButton.Connect("toggled",
+		func() { ConnectOverrideToggled(app) })
+	app.Window.ConnectTab.OverrideProtocolComboText.Connect("changed",
+		func() { ConnectOverrideChanged(app) })
+	app.Window.ConnectTab.OverrideObfuscationSwitch.Connect("state-set",
+		func() { ConnectOverrideChanged(app) })
+
+	// Profiles
+	app.Window.ProfileSwitcher.ComboText.Connect("changed",
+		func() {
+			if !app.populating {
+				_ = ProfileSelected(app)
+			}
+		})
+	app.Window.ProfileSwitcher.SaveButton.Connect("clicked",
+		func() { _ = ProfileSaveClicked(app) })
+	app.Window.ProfileSwitcher.DeleteButton.Connect("clicked",
+		func() { _ = ProfileDeleteClicked(app) })
 
 	// Configure
+	// The settings callbacks send the new value to the daemon, so they are
+	// not invoked while the controls are being populated.
+	setting := func(callback func(app *Application) error) func() {
+		return func() {
+			if !app.populating {
+				_ = callback(app)
+			}
+		}
+	}
 	app.Window.ConfigureTab.AutoConnectButton.Connect("clicked",
-		func() { _ = AutoConnectClicked(&app) })
+		func() { _ = AutoConnectClicked(app) })
 	app.Window.ConfigureTab.CyberSecSwitch.Connect("state-set",
-		func() { _ = CyberSecSwitchToggled(&app) })
+		setting(CyberSecSwitchToggled))
 	app.Window.ConfigureTab.DnsButton.Connect("clicked",
-		func() { _ = DNSButtonClicked(&app) })
+		func() { _ = DNSButtonClicked(app) })
 	app.Window.ConfigureTab.FirewallSwitch.Connect("state-set",
-		func() { _ = FirewallSwitchToggled(&app) })
+		setting(FirewallSwitchToggled))
 	app.Window.ConfigureTab.IPv6Switch.Connect("state-set",
-		func() { _ = IPv6SwitchToggled(&app) })
+		setting(IPv6SwitchToggled))
 	app.Window.ConfigureTab.KillSwitchSwitch.Connect("state-set",
-		func() { _ = KillSwitchSwitchToggled(&app) })
+		setting(KillSwitchSwitchToggled))
 	app.Window.ConfigureTab.NotifySwitch.Connect("state-set",
-		func() { _ = NotificationsSwitchToggled(&app) })
+		setting(NotificationsSwitchToggled))
 	app.Window.ConfigureTab.ObfuscationSwitch.Connect("state-set",
-		func() { _ = ObfuscationSwitchToggled(&app) })
+		setting(ObfuscationSwitchToggled))
 	app.Window.ConfigureTab.ProtocolComboText.Connect("changed",
-		func() { _ = ProtocolComboTextChanged(&app) })
+		setting(ProtocolComboTextChanged))
 	app.Window.ConfigureTab.TechnologyComboText.Connect("changed",
-		func() { _ = TechnologyComboTextChanged(&app) })
+		setting(TechnologyComboTextChanged))
+	app.Window.ConfigureTab.ExportButton.Connect("clicked",
+		func() { _ = ConfigureExportClicked(app) })
+	app.Window.ConfigureTab.ImportButton.Connect("clicked",
+		func() { _ = ConfigureImportClicked(app) })
 
 	// Whitelist
 	app.Window.WhiteListTab.SubnetAddButton.Connect("clicked",
-		func() { _ = SubnetAddButtonClicked(&app) })
+		func() { _ = SubnetAddButtonClicked(app) })
 	app.Window.WhiteListTab.SubnetRemoveButton.Connect("clicked",
-		func() { _ = SubnetRemoveButtonClicked(&app) })
+		func() { _ = SubnetRemoveButtonClicked(app) })
+	app.Window.WhiteListTab.SubnetDetectButton.Connect("clicked",
+		func() { _ = SubnetDetectButtonClicked(app) })
 	app.Window.WhiteListTab.UDPAddButton.Connect("clicked",
-		func() { _ = UDPAddButtonClicked(&app) })
+		func() { _ = UDPAddButtonClicked(app) })
 	app.Window.WhiteListTab.UDPRemoveButton.Connect("clicked",
-		func() { _ = UDPRemoveButtonClicked(&app) })
+		func() { _ = UDPRemoveButtonClicked(app) })
+	app.Window.WhiteListTab.UDPSuggestButton.Connect("clicked",
+		func() { _ = UDPSuggestButtonClicked(app) })
 	app.Window.WhiteListTab.TCPAddButton.Connect("clicked",
-		func() { _ = TCPAddButtonClicked(&app) })
+		func() { _ = TCPAddButtonClicked(app) })
 	app.Window.WhiteListTab.TCPRemoveButton.Connect("clicked",
-		func() { _ = TCPRemoveButtonClicked(&app) })
+		func() { _ = TCPRemoveButtonClicked(app) })
+	app.Window.WhiteListTab.TCPSuggestButton.Connect("clicked",
+		func() { _ = TCPSuggestButtonClicked(app) })
+	app.Window.WhiteListTab.SimplifyButton.Connect("clicked",
+		func() { _ = WhitelistSimplifyButtonClicked(app) })
+	app.Window.WhiteListTab.ApplyButton.Connect("clicked",
+		func() { _ = WhitelistApplyButtonClicked(app) })
+	app.Window.WhiteListTab.SaveButton.Connect("clicked",
+		func() { _ = WhitelistSaveButtonClicked(app) })
 
 	// Account
 	app.Window.AccountTab.RefreshButton.Connect("clicked",
-		func() { _ = AccountRefreshClicked(&app) })
+		func() { _ = AccountRefreshClicked(app) })
 	app.Window.AccountTab.OAuthButton.Connect("clicked",
-		func() { _ = GenerateOAuthClicked(&app) })
+		func() { _ = GenerateOAuthClicked(app) })
 	app.Window.AccountTab.LoginButton.Connect("clicked",
-		func() { _ = LoginClicked(&app) })
+		func() { _ = LoginClicked(app) })
 	app.Window.AccountTab.LogoutButton.Connect("clicked",
-		func() { _ = LogoutClicked(&app) })
+		func() { _ = LogoutClicked(app) })
 }
 
-// PopulateCountries makes a request via the client to retrieve all countries
-// supported by the daemon.
-func (app Application) PopulateCountries() error {
-	countries, err := app.Client.Countries()
+// PopulateCountries retrieves all countries supported by the daemon in the
+// background, and lists them on the 'Connect' tab once they have arrived.
+func (app *Application) PopulateCountries() {
+	client := app.Client
+	var countries *pb.CountriesResponse
+	RunInBackground(func() error {
+		var err error
+		countries, err = client.Countries()
+		return err
+	}, func(err error) {
+		// Another client was attached in the meantime
+		if app.Client != client {
+			return
+		}
+		app.showCountries(countries, err)
+	})
+}
 
+// showCountries lists the countries on the 'Connect' tab, or reports the error
+// returned while retrieving them.
+func (app *Application) showCountries(countries *pb.CountriesResponse,
+	err error) {
 	if err != nil {
-		util.LogError("Unable to retrieve countries", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to retrieve countries",
-			gtk.MESSAGE_ERROR)
-		return err
+		app.DisplayError("Unable to retrieve countries", err,
+			app.PopulateCountries)
+		return
 	}
 
-	list, _ := gtk.ListStoreNew(glib.TYPE_STRING)
+	connectTab := app.Window.ConnectTab
+	connectTab.CountriesComboBoxText.RemoveAll()
 	for _, country := range countries.GetCountries() {
-		appendIter := list.Append()
-		_ = list.SetValue(appendIter, 0, country)
+		connectTab.CountriesComboBoxText.AppendText(country)
 	}
-
-	renderer, _ := gtk.CellRendererTextNew()
-	connectTab := app.Window.ConnectTab
-	connectTab.CountriesComboBoxText.SetModel(list)
-	connectTab.CountriesComboBoxText.PackStart(renderer, true)
 	connectTab.CountriesComboBoxText.SetActive(0)
-
-	return nil
 }
 
-// PopulateCities makes a request via the client to retrieve all cities
-// supported by the daemon.
-func (app Application) PopulateCities() error {
+// PopulateCities retrieves all cities of the country selected on the
+// 'Connect' tab in the background, and lists them once they have arrived. The
+// saved city is selected if it is in the country.
+func (app *Application) PopulateCities() {
+	client := app.Client
 	connectTab := app.Window.ConnectTab
+	country := connectTab.CountriesComboBoxText.GetActiveText()
 
-	cities, err := app.Client.Cities(
-		connectTab.CountriesComboBoxText.GetActiveText())
-
-	if err != nil {
-		util.LogError("Unable to retrieve cities", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to retrieve cities",
-			gtk.MESSAGE_ERROR)
+	var cities *pb.CitiesResponse
+	RunInBackground(func() error {
+		var err error
+		cities, err = client.Cities(country)
 		return err
-	}
-
-	list, _ := gtk.ListStoreNew(glib.TYPE_STRING)
-	for _, city := range cities.GetCities() {
-		appendIter := list.Append()
-		_ = list.SetValue(appendIter, 0, city)
-	}
+	}, func(err error) {
+		// The cities of another country are being retrieved instead
+		if app.Client != client ||
+			connectTab.CountriesComboBoxText.GetActiveText() != country {
+			return
+		}
 
-	renderer, _ := gtk.CellRendererTextNew()
-	connectTab.CitiesComboBoxText.SetModel(list)
-	connectTab.CitiesComboBoxText.PackStart(renderer, true)
-	connectTab.CitiesComboBoxText.SetActive(0)
+		if err != nil {
+			app.DisplayError("Unable to retrieve cities", err,
+				app.PopulateCities)
+			return
+		}
 
-	return nil
+		connectTab.CitiesComboBoxText.RemoveAll()
+		active := 0
+		for i, city := range cities.GetCities() {
+			connectTab.CitiesComboBoxText.AppendText(city)
+			if city == app.Config.Connect.City {
+				active = i
+			}
+		}
+		connectTab.CitiesComboBoxText.SetActive(active)
+	})
 }
 
-// PopulateGroups makes a request via the client to retrieve all groups
-// supported by the daemon.
-func (app Application) PopulateGroups() error {
-	groups, err := app.Client.Groups(&pb.GroupsRequest{
-		Protocol:  pb.ProtocolEnum_UDP,
-		Obfuscate: false,
+// PopulateGroups retrieves all groups supported by the daemon using the
+// effective connect settings in the background, and lists them on the
+// 'Connect' tab once they have arrived. The selected group is kept if it is
+// still available.
+func (app *Application) PopulateGroups() {
+	client := app.Client
+	request := app.EffectiveConnectSettings().GroupsRequest()
+	app.groupsRequests++
+	id := app.groupsRequests
+
+	var groups *pb.GroupsResponse
+	RunInBackground(func() error {
+		var err error
+		groups, err = client.Groups(request)
+		return err
+	}, func(err error) {
+		// The groups have been requested again with other settings
+		if app.Client != client || app.groupsRequests != id {
+			return
+		}
+		app.showGroups(groups, err)
 	})
+}
 
+// showGroups lists the groups on the 'Connect' tab, or reports the error
+// returned while retrieving them.
+func (app *Application) showGroups(groups *pb.GroupsResponse, err error) {
 	if err != nil {
-		util.LogError("Unable to retrieve groups", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to retrieve groups",
-			gtk.MESSAGE_ERROR)
-		return err
-	}
-
-	list, _ := gtk.ListStoreNew(glib.TYPE_STRING)
-	for _, group := range groups.GetGroups() {
-		appendIter := list.Append()
-		_ = list.SetValue(appendIter, 0, group)
+		app.DisplayError("Unable to retrieve groups", err,
+			app.PopulateGroups)
+		return
 	}
 
-	renderer, _ := gtk.CellRendererTextNew()
 	connectTab := app.Window.ConnectTab
-	connectTab.GroupsComboBoxText.SetModel(list)
-	connectTab.GroupsComboBoxText.PackStart(renderer, true)
-	connectTab.GroupsComboBoxText.SetActive(0)
-
-	return nil
+	selected := connectTab.GroupsComboBoxText.GetActiveText()
+	connectTab.GroupsComboBoxText.RemoveAll()
+	active := 0
+	for i, group := range groups.GetGroups() {
+		connectTab.GroupsComboBoxText.AppendText(group)
+		if group == selected {
+			active = i
+		}
+	}
+	connectTab.GroupsComboBoxText.SetActive(active)
 }
 
-// PopulateProtocols makes a request via the client to retrieve all protocols
-// supported by the daemon.
-func (app Application) PopulateProtocols() error {
-	protocols, err := app.Client.SettingsProtocols()
+// PopulateProtocols retrieves all protocols supported by the daemon in the
+// background, and lists them on the 'Configure' tab once they have arrived.
+func (app *Application) PopulateProtocols() {
+	client := app.Client
+	var protocols *pb.ProtocolsResponse
+	RunInBackground(func() error {
+		var err error
+		protocols, err = client.SettingsProtocols()
+		return err
+	}, func(err error) {
+		if app.Client != client {
+			return
+		}
+		app.showProtocols(protocols, err)
+	})
+}
 
+// showProtocols lists the protocols on the 'Configure' tab without invoking
+// the settings callbacks, or reports the error returned while retrieving
+// them.
+func (app *Application) showProtocols(protocols *pb.ProtocolsResponse,
+	err error) {
 	if err != nil {
-		util.LogError("Unable to retrieve protocols", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to retrieve protocols",
-			gtk.MESSAGE_ERROR)
-		return err
+		app.DisplayError("Unable to retrieve protocols", err,
+			app.PopulateProtocols)
+		return
 	}
 
-	list, _ := gtk.ListStoreNew(glib.TYPE_STRING)
+	populating := app.populating
+	app.populating = true
+	configureTab := app.Window.ConfigureTab
+	configureTab.ProtocolComboText.RemoveAll()
 	for _, group := range protocols.GetProtocols() {
-		appendIter := list.Append()
-		_ = list.SetValue(appendIter, 0, group)
+		configureTab.ProtocolComboText.AppendText(group)
 	}
-
-	renderer, _ := gtk.CellRendererTextNew()
-	configureTab := app.Window.ConfigureTab
-	configureTab.ProtocolComboText.SetModel(list)
-	configureTab.ProtocolComboText.PackStart(renderer, true)
 	configureTab.ProtocolComboText.SetActive(0)
-
-	return nil
+	app.populating = populating
 }
 
-// PopulateTechnologies makes a request via the client to retrieve all
-// technologies supported by the daemon.
-func (app Application) PopulateTechnologies() error {
-	technologies, err := app.Client.SettingsTechnologies()
+// PopulateTechnologies retrieves all technologies supported by the daemon in
+// the background, and lists them on the 'Configure' tab once they have
+// arrived.
+func (app *Application) PopulateTechnologies() {
+	client := app.Client
+	var technologies *pb.TechnologyResponse
+	RunInBackground(func() error {
+		var err error
+		technologies, err = client.SettingsTechnologies()
+		return err
+	}, func(err error) {
+		if app.Client != client {
+			return
+		}
+		app.showTechnologies(technologies, err)
+	})
+}
 
+// showTechnologies lists the technologies on the 'Configure' tab without
+// invoking the settings callbacks, or reports the error returned while
+// retrieving them.
+func (app *Application) showTechnologies(
+	technologies *pb.TechnologyResponse, err error) {
 	if err != nil {
-		util.LogError("Unable to retrieve technologies", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to retrieve technologies",
-			gtk.MESSAGE_ERROR)
-		return err
+		app.DisplayError("Unable to retrieve technologies", err,
+			app.PopulateTechnologies)
+		return
 	}
 
-	list, _ := gtk.ListStoreNew(glib.TYPE_STRING)
+	populating := app.populating
+	app.populating = true
+	configureTab := app.Window.ConfigureTab
+	configureTab.TechnologyComboText.RemoveAll()
 	for _, group := range technologies.GetTechnologies() {
-		appendIter := list.Append()
-		_ = list.SetValue(appendIter, 0, group)
+		configureTab.TechnologyComboText.AppendText(group)
 	}
-
-	renderer, _ := gtk.CellRendererTextNew()
-	configureTab := app.Window.ConfigureTab
-	configureTab.TechnologyComboText.SetModel(list)
-	configureTab.TechnologyComboText.PackStart(renderer, true)
 	configureTab.TechnologyComboText.SetActive(0)
-
-	return nil
+	app.populating = populating
 }
 
-// ConnectToDaemon attempts to connect to the NordVPN daemon. If the connection
-// is successful, the connection status and account information will be updated.
-// Additionally, the countries, cities and groups on the 'Connect' tab will be
-// populated.
-func (app *Application) ConnectToDaemon() error {
-	infoBar := app.Window.InfoBar
-	infoBar.HideMessage()
-	client, err := opennord.NewOpenNordClient()
-	if err != nil {
-		util.LogError("Could not connect to NordVPN daemon", err)
-		infoBar.DisplayMessage(
-			"Could not connect to NordVPN daemon", gtk.MESSAGE_ERROR)
+// ConnectToDaemon dials the NordVPN daemon in the background. If the
+// connection is successful, the client is attached once the GTK main loop is
+// idle. If the daemon is unreachable, the error is reported in the info bar,
+// from where the daemon supervisor can be asked to keep trying.
+func (app *Application) ConnectToDaemon() {
+	var client DaemonClient
+	RunInBackground(func() error {
+		var err error
+		client, err = app.DialDaemon()
 		return err
-	}
+	}, func(err error) {
+		if err != nil {
+			app.DisplayError("Could not connect to NordVPN daemon", err,
+				app.Supervisor.Reconnect)
+			return
+		}
 
+		app.AttachClient(client)
+	})
+}
+
+// daemonLists are the lists retrieved from the daemon when a client is
+// attached, along with the errors returned while retrieving them.
+type daemonLists struct {
+	countries       *pb.CountriesResponse
+	countriesErr    error
+	groups          *pb.GroupsResponse
+	groupsErr       error
+	protocols       *pb.ProtocolsResponse
+	protocolsErr    error
+	technologies    *pb.TechnologyResponse
+	technologiesErr error
+}
+
+// AttachClient makes client the application's daemon client, replacing and
+// closing any previous client. The account information, the countries,
+// cities and groups on the 'Connect' tab, and the protocols and technologies
+// on the 'Configure' tab are then retrieved in the background. Once they have
+// arrived, the controls are populated and the daemon's settings are compared
+// with the saved settings. The GUI callbacks are registered the first time a
+// client is attached. This function must be called on the GTK main loop.
+func (app *Application) AttachClient(client DaemonClient) {
+	if app.Client != nil {
+		_ = app.Client.Close()
+	}
 	app.Client = client
 
 	// If we have a good client, we can register our callbacks
-	app.RegisterCallbacks()
+	if !app.callbacksRegistered {
+		app.RegisterCallbacks()
+		app.callbacksRegistered = true
+	}
+
+	// Expired whitelist entries which could not be removed from the previous
+	// client are removed at the next interval
+	app.expiryRetryAt = time.Time{}
+	app.expiryBackoff.Reset()
 
 	// And update the GUI
-	_ = app.UpdateConnectionStatus()
-	_ = app.UpdateAccountInformation()
-	_ = app.PopulateCountries()
-	_ = app.PopulateCities()
-	_ = app.PopulateGroups()
-	_ = app.PopulateProtocols()
-	_ = app.PopulateTechnologies()
-	app.PopulateFromConfig()
+	app.StatusPoller.SetSource(client)
+	app.UpdateAccountInformation()
+
+	request := app.EffectiveConnectSettings().GroupsRequest()
+	app.groupsRequests++
+	id := app.groupsRequests
+
+	var lists daemonLists
+	RunInBackground(func() error {
+		lists.countries, lists.countriesErr = client.Countries()
+		lists.groups, lists.groupsErr = client.Groups(request)
+		lists.protocols, lists.protocolsErr = client.SettingsProtocols()
+		lists.technologies, lists.technologiesErr =
+			client.SettingsTechnologies()
+		return nil
+	}, func(error) {
+		// Another client was attached in the meantime
+		if app.Client != client {
+			return
+		}
 
-	return nil
+		// Selecting the saved country retrieves its cities
+		app.populating = true
+		app.showCountries(lists.countries, lists.countriesErr)
+		if app.groupsRequests == id {
+			app.showGroups(lists.groups, lists.groupsErr)
+		}
+		app.showProtocols(lists.protocols, lists.protocolsErr)
+		app.showTechnologies(lists.technologies, lists.technologiesErr)
+		app.PopulateFromConfig()
+		app.populating = false
+
+		// The daemon's settings may have been changed using another tool,
+		// such as the nordvpn CLI
+		app.CheckSettingsDrift()
+	})
 }
 
-func (app Application) PopulateFromConfig() {
+func (app *Application) PopulateFromConfig() {
+	app.ApplyLocks()
 	connectTab := app.Window.ConnectTab
 
 	// Populate countries
@@ -380,202 +645,209 @@ func (app Application) PopulateFromConfig() {
 		return false
 	})
 
-	// Populate whitelist subnets
-	for _, subnet := range app.Config.WhiteList.Subnets {
-		label, _ := gtk.LabelNew(subnet)
-		row, _ := gtk.ListBoxRowNew()
-		row.SetHAlign(gtk.ALIGN_START)
-		row.Add(label)
-		app.Window.WhiteListTab.SubnetListBox.Add(row)
-		row.ShowAll()
-	}
+	// Populate whitelist
+	whiteListTab := app.Window.WhiteListTab
+	whiteListTab.Populate(app.Config.WhiteList)
+	populatePresetListBox(app)
+}
 
-	// Populate whitelist UDP ports
-	for _, port := range app.Config.WhiteList.UDPPorts {
-		label, _ := gtk.LabelNew(strconv.FormatInt(int64(port), 10))
-		row, _ := gtk.ListBoxRowNew()
-		row.SetHAlign(gtk.ALIGN_START)
-		row.Add(label)
-		app.Window.WhiteListTab.UDPListBox.Add(row)
-		row.ShowAll()
-	}
+// UpdateConnectionStatus feeds the connection status into the connection
+// state machine, and reports if the daemon can no longer be reached. This
+// function must be called on the GTK main loop.
+func (app *Application) UpdateConnectionStatus(snapshot daemon.Snapshot) {
+	app.Connection.HandleSnapshot(snapshot)
 
-	// Populate whitelist TCP ports
-	for _, port := range app.Config.WhiteList.TCPPorts {
-		label, _ := gtk.LabelNew(strconv.FormatInt(int64(port), 10))
-		row, _ := gtk.ListBoxRowNew()
-		row.SetHAlign(gtk.ALIGN_START)
-		row.Add(label)
-		app.Window.WhiteListTab.TCPListBox.Add(row)
-		row.ShowAll()
+	if snapshot.Err != nil {
+		app.DisplayError("Unable to retrieve connection status",
+			snapshot.Err, nil)
 	}
 }
 
-// UpdateConnectionStatus updates the 'Connect' tab status and enables /
-// disables the 'Disconnect' button depending on the connection status.
-func (app Application) UpdateConnectionStatus() error {
-	status, err := app.Client.Status()
-	if err != nil {
-		util.LogError("Lost connection to NordVPN daemon", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Reconnect")
-		infoBar.Button.Connect("clicked", app.ConnectToDaemon)
-		infoBar.DisplayMessage(
-			"Lost connection to NordVPN daemon", gtk.MESSAGE_ERROR)
+// UpdateControls enables / disables the controls on every tab depending on
+// the connection state. This function must be called on the GTK main loop.
+func (app *Application) UpdateControls(state daemon.ConnectionState) {
+	app.Window.ConnectTab.UpdateControls(state)
+	app.Window.SessionTab.StatusLabel.SetText(state.String())
+	app.Window.ConfigureTab.UpdateControls(state)
+	app.Window.WhiteListTab.UpdateControls(state)
+	app.Window.AccountTab.UpdateControls(state)
+}
+
+// UpdateAccountInformation retrieves the user's account information in the
+// background, and updates the 'Account' tab once it has arrived. If the user
+// is logged in, the login options will be disabled. If the user is logged out,
+// the login options will be enabled.
+func (app *Application) UpdateAccountInformation() {
+	client := app.Client
+	var isLoggedIn *pb.IsLoggedInResponse
+	var account *pb.AccountResponse
+	RunInBackground(func() error {
+		var err error
+		isLoggedIn, err = client.IsLoggedIn()
+		if err != nil || !isLoggedIn.GetIsLoggedIn() {
+			return err
+		}
+		account, err = client.AccountInfo()
 		return err
-	}
+	}, func(err error) {
+		// Another client was attached in the meantime
+		if app.Client != client {
+			return
+		}
 
-	connectedText := status.GetState()
-	canDisconnect := connectedText == "Connected"
-	connectTab := app.Window.ConnectTab
-	connectTab.StatusLabel.SetText(connectedText)
-	connectTab.DisconnectButton.SetSensitive(canDisconnect)
+		if err != nil {
+			app.DisplayError("Unable to retrieve account information", err,
+				app.UpdateAccountInformation)
+			return
+		}
 
-	return nil
+		accountTab := app.Window.AccountTab
+		if !isLoggedIn.GetIsLoggedIn() {
+			accountTab.EmailLabel.SetText("N/A")
+			accountTab.ExpiresLabel.SetText("N/A")
+			accountTab.SetLoggedIn(false)
+			accountTab.StatusLabel.SetText("Not Logged In")
+
+			util.LogError("You are not logged in to NordVPN", nil)
+			app.Window.InfoBar.Post(Message{
+				Text:        "You are not logged in to NordVPN",
+				Type:        gtk.MESSAGE_ERROR,
+				ActionLabel: daemonerr.ActionLogIn.Label(),
+				Action: func() {
+					app.Recover(daemonerr.ActionLogIn, nil)
+				},
+			})
+			return
+		}
+
+		accountTab.EmailLabel.SetText(account.GetEmail())
+		accountTab.ExpiresLabel.SetText(account.GetExpiresAt())
+		accountTab.SetLoggedIn(true)
+		accountTab.StatusLabel.SetText("Logged In")
+	})
 }
 
-// UpdateAccountInformation updates the 'Account' tab with the user's account
-// information. If the user is logged in, the login options will be disabled. If
-// the user is logged out, the login options will be enabled.
-func (app Application) UpdateAccountInformation() error {
-	isLoggedIn, err := app.Client.IsLoggedIn()
-	infoBar := app.Window.InfoBar
+// UpdateSessionStatus updates the session details on the 'Session' tab. The
+// status itself is updated by UpdateControls. This function must be called on
+// the GTK main loop.
+func (app *Application) UpdateSessionStatus(snapshot daemon.Snapshot) {
+	sessionTab := app.Window.SessionTab
 
-	if err != nil {
-		util.LogError("Lost connection to NordVPN daemon", err)
-		infoBar.Button.SetLabel("Reconnect")
-		infoBar.Button.Connect("clicked", app.ConnectToDaemon)
-		infoBar.DisplayMessage(
-			"Lost connection to NordVPN daemon", gtk.MESSAGE_ERROR)
-		return err
+	if !snapshot.Connected() {
+		return
 	}
 
-	accountTab := app.Window.AccountTab
-	if !isLoggedIn.GetIsLoggedIn() {
-		accountTab.EmailLabel.SetText("N/A")
-		accountTab.ExpiresLabel.SetText("N/A")
-		accountTab.LoginFrame.SetSensitive(true)
-		accountTab.OAuthFrame.SetSensitive(true)
-		accountTab.LogoutButton.SetSensitive(false)
-		accountTab.StatusLabel.SetText("Not Logged In")
-
-		util.LogError("You are not logged in to NordVPN", nil)
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage(
-			"You are not logged in to NordVPN", gtk.MESSAGE_ERROR)
-		return err
-	}
-
-	account, _ := app.Client.AccountInfo()
-	accountTab.EmailLabel.SetText(account.GetEmail())
-	accountTab.ExpiresLabel.SetText(account.GetExpiresAt())
-	accountTab.LoginFrame.SetSensitive(false)
-	accountTab.OAuthFrame.SetSensitive(false)
-	accountTab.LogoutButton.SetSensitive(true)
-	accountTab.StatusLabel.SetText("Logged In")
+	sessionTab.ServerLabel.SetText(snapshot.Hostname)
+	sessionTab.CountryLabel.SetText(snapshot.Country)
+	sessionTab.CityLabel.SetText(snapshot.City)
+	sessionTab.ServerIPLabel.SetText(snapshot.IP)
+	sessionTab.TechnologyLabel.SetText(snapshot.Technology.String())
+	sessionTab.ProtocolLabel.SetText(snapshot.Protocol.String())
+	sessionTab.BytesReceivedLabel.SetText(util.FormatBytes(snapshot.
+		BytesReceived))
+	sessionTab.BytesSentLabel.SetText(util.FormatBytes(snapshot.BytesSent))
+	sessionTab.UptimeLabel.SetText(util.FormatDuration(int64(snapshot.
+		Uptime)))
+}
 
-	return nil
+// EffectiveConnectSettings returns the settings used for the next connection.
+// These are the settings saved in the config, with any overrides from the
+// 'Connection Options' panel on the 'Connect' tab applied.
+func (app *Application) EffectiveConnectSettings() ConnectSettings {
+	return app.Window.ConnectTab.ApplyOverrides(
+		app.Config.ConnectSettings(app.Presets))
 }
 
-// UpdateSessionStatus updates the information on the 'Session' tab. This
-// function is intended to be run as a goroutine and will update the
-// information once every second.
-func (app Application) UpdateSessionStatus() {
-	for {
-		if app.Client != nil {
-			status, err := app.Client.Status()
-			sessionTab := app.Window.SessionTab
-
-			if err == nil && status.GetState() == "Connected" {
-				sessionTab.StatusLabel.SetText(status.GetState())
-				sessionTab.ServerLabel.SetText(status.GetHostname())
-				sessionTab.CountryLabel.SetText(status.GetCountry())
-				sessionTab.CityLabel.SetText(status.GetCity())
-				sessionTab.ServerIPLabel.SetText(status.GetIp())
-				sessionTab.TechnologyLabel.SetText(status.GetTechnology().
-					String())
-				sessionTab.ProtocolLabel.SetText(status.GetProtocol().String())
-				sessionTab.BytesReceivedLabel.SetText(util.FormatBytes(status.
-					GetDownload()))
-				sessionTab.BytesSentLabel.SetText(util.FormatBytes(status.
-					GetUpload()))
-				sessionTab.UptimeLabel.SetText(util.FormatDuration(status.
-					GetUptime()))
-			} else {
-				sessionTab.StatusLabel.SetText("Disconnected")
+// SubscribeStatus registers fn to receive connection status snapshots from
+// the status poller. Unlike subscribing to the poller directly, fn is invoked
+// on the GTK main loop, and snapshots which were queued before the poller was
+// stopped are discarded. The returned function removes the subscription.
+func (app *Application) SubscribeStatus(
+	fn func(snapshot daemon.Snapshot)) func() {
+	poller := app.StatusPoller
+	return poller.Subscribe(func(snapshot daemon.Snapshot) {
+		glib.IdleAdd(func() {
+			if poller.Running() {
+				fn(snapshot)
 			}
-		}
-		time.Sleep(1 * time.Second)
-	}
+		})
+	})
 }
 
-// Connect connects to the server specified by the given tag.
-func (app Application) Connect(tag string) error {
+// Connect connects to the server specified by the given tag. The connection is
+// established in the background, and may be cancelled using the 'Cancel'
+// button on the 'Connect' tab.
+func (app *Application) Connect(tag string) error {
 	infoBar := app.Window.InfoBar
 
 	if app.Client == nil {
 		errMsg := "you are not connected to the NordVPN daemon"
 		util.LogError(errMsg, nil)
-		infoBar.DisplayMessage(errMsg, gtk.MESSAGE_ERROR)
-		infoBar.Button.SetLabel("Retry")
-		infoBar.Button.Connect("clicked", app.ConnectToDaemon)
+		infoBar.Post(Message{
+			Text:        errMsg,
+			Type:        gtk.MESSAGE_ERROR,
+			ActionLabel: "Retry",
+			Action:      app.Supervisor.Reconnect,
+		})
 
 		return errors.New(errMsg)
 	}
 
-	client, err := app.Client.Connect(&pb.ConnectRequest{
-		ServerTag: tag,
-		Protocol:  pb.ProtocolEnum_UDP,
-		Obfuscate: false,
-		CyberSec:  app.Config.CyberSecEnabled,
-		Dns:       nil,
-		WhiteList: nil,
-	})
+	req := app.EffectiveConnectSettings().ConnectRequest(tag)
 
-	infoBar.Button.Connect("clicked", infoBar.HideMessage)
-	infoBar.Button.SetLabel("Dismiss")
-	if err != nil {
-		util.LogError("Lost connection to NordVPN daemon", err)
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Lost connection to NordVPN daemon: "+err.Error(),
-			gtk.MESSAGE_ERROR)
-		return err
+	description := "Connecting to the best server..."
+	if tag != "" {
+		description = "Connecting to " + tag + "..."
 	}
 
-	count := 0
-	for {
-		msg, err := client.Recv()
-		count++
-
-		if err == io.EOF {
-			break
+	app.RunOperation(description, func(ctx context.Context) error {
+		return app.receiveConnect(ctx, req)
+	}, func(err error) {
+		if errors.Is(err, context.Canceled) {
+			app.Connection.EndDisconnect(nil)
+			util.LogInfo("Connection cancelled")
+			infoBar.DisplayMessage("Connection cancelled", gtk.MESSAGE_INFO)
 		}
 
-		if err != nil {
-			// Format common error
-			if strings.Contains(err.Error(), "You are not logged in") {
-				err = errors.New("you are not logged in")
-			} else {
-				util.LogError("Lost connection to NordVPN daemon", err)
-				infoBar.Button.SetLabel("Dismiss")
-				infoBar.Button.Connect("clicked", infoBar.HideMessage)
-				infoBar.DisplayMessage(
-					"Lost connection to NordVPN daemon: "+err.Error(),
-					gtk.MESSAGE_ERROR)
-			}
-			return err
-		}
+		app.StatusPoller.Refresh()
+	})
 
-		if count == 2 {
-			infoBar.DisplayMessage("Connected to "+msg.GetMessages()[1],
-				gtk.MESSAGE_INFO)
-			util.LogInfo("Connected to " + msg.GetMessages()[1])
-		}
-	}
+	return nil
+}
 
-	_ = app.UpdateConnectionStatus()
+// receiveConnect sends the connect request to the daemon and consumes the
+// resulting stream, posting each connect event to the GTK main loop. This
+// function blocks, and must not be called from the GTK main loop.
+func (app *Application) receiveConnect(ctx context.Context,
+	req *pb.ConnectRequest) error {
+	post := func(event daemon.ConnectEvent) {
+		glib.IdleAdd(func() { app.HandleConnectEvent(event) })
+	}
+	return daemon.Connect(ctx, app.Client, req, post)
+}
 
-	return nil
+// HandleConnectEvent updates the info bar, the 'Connect' tab and the
+// 'Session' tab to reflect the progress of a connection attempt.
+func (app *Application) HandleConnectEvent(event daemon.ConnectEvent) {
+	infoBar := app.Window.InfoBar
+	sessionTab := app.Window.SessionTab
+	app.Connection.HandleConnectEvent(event)
+
+	switch event.Type {
+	case daemon.ConnectStarted:
+		util.LogInfo("Connection requested")
+		app.Window.ConnectTab.BusyLabel.SetText("Choosing a server...")
+	case daemon.ConnectServerChosen:
+		util.LogInfo("Chose server " + event.Hostname)
+		sessionTab.ServerLabel.SetText(event.Hostname)
+	case daemon.ConnectConnecting:
+		app.Window.ConnectTab.BusyLabel.SetText("Connecting to " +
+			event.Server + "...")
+	case daemon.ConnectConnected:
+		util.LogInfo("Connected to " + event.Hostname)
+		infoBar.DisplayMessage("Connected to "+event.Hostname,
+			gtk.MESSAGE_INFO)
+	case daemon.ConnectFailed:
+		app.DisplayError("Unable to connect", event.Err, nil)
+	}
 }
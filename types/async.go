@@ -0,0 +1,42 @@
+package types
+
+import (
+	"context"
+	"github.com/gotk3/gotk3/glib"
+)
+
+// RunInBackground runs work on a separate goroutine so that the GTK main loop
+// is not blocked while waiting for the daemon. Once work has returned, done is
+// called on the GTK main loop with the error returned by work.
+func RunInBackground(work func() error, done func(err error)) {
+	go func() {
+		err := work()
+		glib.IdleAdd(func() { done(err) })
+	}()
+}
+
+// RunOperation runs a user-initiated daemon operation in the background. While
+// the operation is running, the busy indicator on the 'Connect' tab displays
+// the given description, and the 'Cancel' button cancels the context passed
+// to work.
+func (app *Application) RunOperation(description string,
+	work func(ctx context.Context) error, done func(err error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	connectTab := app.Window.ConnectTab
+	id := connectTab.BeginOperation(description, cancel)
+
+	RunInBackground(func() error {
+		defer cancel()
+		return work(ctx)
+	}, func(err error) {
+		connectTab.EndOperation(id)
+		done(err)
+	})
+}
+
+// PostProgress updates the description of the running operation shown on the
+// 'Connect' tab. It is safe to call from any goroutine.
+func (app *Application) PostProgress(description string) {
+	connectTab := app.Window.ConnectTab
+	glib.IdleAdd(func() { connectTab.BusyLabel.SetText(description) })
+}
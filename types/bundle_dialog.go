@@ -0,0 +1,253 @@
+package types
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+	"io/ioutil"
+	"main/util"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ImportDialog contains the GTK components for the dialog which previews the
+// changes an imported bundle would make, and asks whether to merge the bundle
+// into the config or replace the config with it.
+type ImportDialog struct {
+	Dialog             *gtk.Dialog
+	MergeRadioButton   *gtk.RadioButton
+	ReplaceRadioButton *gtk.RadioButton
+	PreviewTextView    *gtk.TextView
+
+	// preview describes the changes made by importing in the given mode.
+	preview func(mode ImportMode) string
+}
+
+// BuildImportDialog constructs the import dialog from the provided builder.
+func BuildImportDialog(builder *gtk.Builder) *ImportDialog {
+	importDialog := &ImportDialog{
+		Dialog: util.BuilderGetDialog(builder, "import_dialog"),
+		MergeRadioButton: util.BuilderGetRadioButton(builder,
+			"import_merge_radio_button"),
+		ReplaceRadioButton: util.BuilderGetRadioButton(builder,
+			"import_replace_radio_button"),
+		PreviewTextView: util.BuilderGetTextView(builder,
+			"import_preview_text_view"),
+	}
+
+	importDialog.MergeRadioButton.Connect("toggled",
+		importDialog.updatePreview)
+	return importDialog
+}
+
+// Run displays the changes described by preview for the selected mode,
+// updating them whenever another mode is selected, and waits for the user to
+// choose whether to import. If the user cancels, ok is false.
+func (importDialog *ImportDialog) Run(preview func(mode ImportMode) string) (
+	mode ImportMode, ok bool) {
+	importDialog.preview = preview
+	defer func() { importDialog.preview = nil }()
+
+	importDialog.MergeRadioButton.SetActive(true)
+	importDialog.updatePreview()
+
+	response := importDialog.Dialog.Run()
+	importDialog.Dialog.Hide()
+	if response != gtk.RESPONSE_OK {
+		return ImportMerge, false
+	}
+	return importDialog.mode(), true
+}
+
+// mode returns the selected import mode.
+func (importDialog *ImportDialog) mode() ImportMode {
+	if importDialog.ReplaceRadioButton.GetActive() {
+		return ImportReplace
+	}
+	return ImportMerge
+}
+
+// updatePreview describes the changes made by importing in the selected mode.
+func (importDialog *ImportDialog) updatePreview() {
+	if importDialog.preview == nil {
+		return
+	}
+	buffer, err := importDialog.PreviewTextView.GetBuffer()
+	if err != nil {
+		util.LogError("Unable to retrieve import preview", err)
+		return
+	}
+	buffer.SetText(importDialog.preview(importDialog.mode()))
+}
+
+// ConfigureExportClicked is invoked whenever the 'Export...' button on the
+// 'Configure' tab is clicked. This function writes the saved settings and
+// profiles to a bundle chosen by the user.
+func ConfigureExportClicked(app *Application) error {
+	path, ok := app.chooseBundleFile(gtk.FILE_CHOOSER_ACTION_SAVE)
+	if !ok {
+		return nil
+	}
+
+	data, err := EncodeBundle(app.Config.ExportBundle(), path)
+	if err == nil {
+		err = ioutil.WriteFile(path, data, 0o600)
+	}
+	if err != nil {
+		util.LogError("Unable to export settings", err)
+		app.Window.InfoBar.DisplayMessage("Unable to export settings: "+
+			err.Error(), gtk.MESSAGE_ERROR)
+		return err
+	}
+
+	util.LogInfo("Exported settings to " + path)
+	app.Window.InfoBar.DisplayMessage("Exported settings to "+
+		filepath.Base(path), gtk.MESSAGE_INFO)
+	return nil
+}
+
+// ConfigureImportClicked is invoked whenever the 'Import...' button on the
+// 'Configure' tab is clicked. This function reads a bundle chosen by the
+// user, previews the changes it would make, and imports it in the mode the
+// user chooses. The imported settings are saved and sent to the daemon.
+func ConfigureImportClicked(app *Application) error {
+	path, ok := app.chooseBundleFile(gtk.FILE_CHOOSER_ACTION_OPEN)
+	if !ok {
+		return nil
+	}
+	name := filepath.Base(path)
+
+	data, err := ioutil.ReadFile(path)
+	var bundle *Bundle
+	var bundleProblems []string
+	if err == nil {
+		bundle, bundleProblems, err = DecodeBundle(data, path)
+	}
+	if err != nil {
+		util.LogError("Unable to import "+path, err)
+		app.Window.InfoBar.DisplayMessage("Unable to import "+name+": "+
+			err.Error(), gtk.MESSAGE_ERROR)
+		return err
+	}
+
+	mode, ok := app.Window.ImportDialog.Run(func(mode ImportMode) string {
+		imported, problems, err := app.Config.ImportBundle(bundle, mode)
+		if err != nil {
+			return "Unable to import " + name + ": " + err.Error()
+		}
+		return describeImport(DiffConfigs(app.Config, imported),
+			append(bundleProblems, problems...))
+	})
+	if !ok {
+		return nil
+	}
+
+	imported, problems, err := app.Config.ImportBundle(bundle, mode)
+	if err != nil {
+		util.LogError("Unable to import "+path, err)
+		app.Window.InfoBar.DisplayMessage("Unable to import "+name+": "+
+			err.Error(), gtk.MESSAGE_ERROR)
+		return err
+	}
+	problems = append(bundleProblems, problems...)
+	problems = append(problems, imported.ApplyOverrides(app.Overrides)...)
+	for _, problem := range problems {
+		util.LogWarning("Not imported: "+problem, nil)
+	}
+	util.LogInfo("Imported settings from " + path)
+
+	app.Config = imported
+	app.populating = true
+	app.PopulateFromConfig()
+	app.populating = false
+	app.PopulateProfiles()
+
+	if err := SaveConfig(app); err != nil {
+		app.DisplaySaveError(err)
+	}
+	app.ResolveHostnames()
+
+	if len(problems) > 0 {
+		text := "Problem importing " + name + ": " + problems[0]
+		if len(problems) > 1 {
+			text = strconv.Itoa(len(problems)) + " problems importing " +
+				name + ": " + strings.Join(problems, "; ")
+		}
+		app.Window.InfoBar.DisplayMessage(text, gtk.MESSAGE_WARNING)
+	}
+
+	if app.Client == nil {
+		return nil
+	}
+	app.PopulateGroups()
+	app.applySettings("imported settings", "Imported settings from "+name)
+	return nil
+}
+
+// describeImport returns the preview of an import listing the differences it
+// makes to the config, and the problems found with the bundle.
+func describeImport(differences []string, problems []string) string {
+	var builder strings.Builder
+	if len(differences) == 0 {
+		builder.WriteString("No settings will change.\n")
+	}
+	for _, difference := range differences {
+		builder.WriteString(difference + "\n")
+	}
+
+	if len(problems) > 0 {
+		builder.WriteString("\nNot imported:\n")
+		for _, problem := range problems {
+			builder.WriteString(problem + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// chooseBundleFile asks the user to choose the bundle file to export to or
+// import from, depending on action. If the user cancels, ok is false.
+func (app *Application) chooseBundleFile(action gtk.FileChooserAction) (
+	path string, ok bool) {
+	title, accept := "Import Settings", "Open"
+	if action == gtk.FILE_CHOOSER_ACTION_SAVE {
+		title, accept = "Export Settings", "Save"
+	}
+
+	dialog, err := gtk.FileChooserDialogNewWith2Buttons(title,
+		app.Window.Window, action, "Cancel", gtk.RESPONSE_CANCEL, accept,
+		gtk.RESPONSE_ACCEPT)
+	if err != nil {
+		util.LogError("Unable to create file chooser", err)
+		return "", false
+	}
+	defer dialog.Destroy()
+
+	filters := []struct {
+		name     string
+		patterns []string
+	}{
+		{"Bundles (*.json, *.toml)", []string{"*.json", "*.toml"}},
+		{"JSON (*.json)", []string{"*.json"}},
+		{"TOML (*.toml)", []string{"*.toml"}},
+	}
+	for _, filter := range filters {
+		fileFilter, err := gtk.FileFilterNew()
+		if err != nil {
+			continue
+		}
+		fileFilter.SetName(filter.name)
+		for _, pattern := range filter.patterns {
+			fileFilter.AddPattern(pattern)
+		}
+		dialog.AddFilter(fileFilter)
+	}
+
+	if action == gtk.FILE_CHOOSER_ACTION_SAVE {
+		dialog.SetDoOverwriteConfirmation(true)
+		dialog.SetCurrentName(BundleFile)
+	}
+
+	if dialog.Run() != gtk.RESPONSE_ACCEPT {
+		return "", false
+	}
+	return dialog.GetFilename(), true
+}
@@ -1,14 +1,53 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"github.com/gotk3/gotk3/gtk"
 	"io/ioutil"
 	"main/util"
+	"main/whitelist"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 )
 
+// configMutex serialises writes to the config file.
+var configMutex sync.Mutex
+
+// Config is the user's configuration. The settings in the embedded Profile
+// are those currently in use, and are copied to the active profile, if any,
+// whenever the config is saved.
 type Config struct {
+	// Version is the schema version the config was written with.
+	Version int
+	Profile
+	// ActiveProfile is the name of the profile in use, or empty if no profile
+	// has been selected.
+	ActiveProfile string
+	// Profiles are the saved profiles, by name.
+	Profiles map[string]*Profile
+
+	// savedData is the content of the config file as it was last read or
+	// written, and savedState the config as it was then.
+	savedData  []byte
+	savedState []byte
+	// policy is the system policy enforced on the config, and locked contains
+	// the fields it enforces. defaults are the system defaults given to the
+	// fields missing from the config file.
+	policy   map[string]interface{}
+	locked   map[string]bool
+	defaults map[string]interface{}
+	// overridden maps the fields overridden for this run to the values they
+	// had beforehand.
+	overridden map[string]interface{}
+}
+
+// Profile is a set of settings which may be saved under a name and switched
+// between, such as "office" or "travel".
+type Profile struct {
 	Connect              *Connect
 	AutoConnectEnabled   bool
 	AutoConnectServerTag string
@@ -33,36 +72,245 @@ type Connect struct {
 
 type WhiteList struct {
 	Subnets  []string
-	UDPPorts []uint32
-	TCPPorts []uint32
+	UDPPorts []whitelist.PortRange
+	TCPPorts []whitelist.PortRange
+	// Presets are the names of the enabled presets, which are looked up in
+	// the preset catalogue whenever the whitelist is applied.
+	Presets []string
+	// Hostnames are whitelisted by the addresses to which they resolve.
+	Hostnames []string
+	// ResolvedHosts maps each whitelisted hostname to the subnets containing
+	// only its addresses, as of when it was last resolved.
+	ResolvedHosts map[string][]string
+	// Temporary are the entries which are removed once they expire.
+	Temporary []TemporaryEntry
 }
 
-func LoadConfig() *Config {
-	userConfigDir, err := os.UserConfigDir()
-	if err != nil {
-		util.LogWarning("Unable to determine user config directory", err)
-		return NewConfig()
+// Normalise canonicalises the whitelisted subnets, removing those which are
+// invalid or redundant, and merges overlapping port ranges. The issues which
+// were resolved are returned.
+func (whiteList *WhiteList) Normalise() []whitelist.Issue {
+	var issues []whitelist.Issue
+	whiteList.Subnets, issues = whitelist.NormaliseSubnets(whiteList.Subnets)
+	whiteList.UDPPorts = whitelist.MergePortRanges(whiteList.UDPPorts)
+	whiteList.TCPPorts = whitelist.MergePortRanges(whiteList.TCPPorts)
+	return issues
+}
+
+// LoadConfig loads the config file at path, migrating it to the current
+// schema version if necessary. A migrated config is written back to the file,
+// after backing up the original. If the file cannot be read, or path is
+// empty, the default config is used. Any problems found with the file are
+// returned, so that they can be reported to the user.
+func LoadConfig(path string) (*Config, []string) {
+	system, problems := LoadSystemConfig(SystemConfigDir)
+	for _, problem := range problems {
+		util.LogWarning("Invalid system config: "+problem, nil)
 	}
 
-	userConfigPath := filepath.Join(userConfigDir, ConfigDir, ConfigFile)
-	configFile, err := os.Open(userConfigPath)
-	if err != nil {
+	if path == "" {
+		return defaultConfig(system, problems)
+	}
+
+	config, version, fileProblems, err := ReadConfig(path, system)
+	var pathErr *os.PathError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		util.LogInfo("No user config file, using the defaults")
+		return defaultConfig(system, problems)
+	case errors.As(err, &pathErr):
 		util.LogWarning("Unable to open config file", err)
-		return NewConfig()
+		return defaultConfig(system, append(problems, "unable to read "+
+			path+": "+err.Error()))
+	case err != nil:
+		util.LogWarning("Unable to parse config file", err)
+		problems = append(problems, "unable to parse "+path+", using the "+
+			"defaults: "+err.Error())
+		// The file is moved aside, as it would otherwise be replaced when
+		// the config is next saved
+		if backup, err := backupConfig(path, "invalid"); err != nil {
+			util.LogError("Unable to back up config file", err)
+		} else {
+			problems = append(problems, "the unreadable config has been "+
+				"moved to "+backup)
+		}
+		return defaultConfig(system, problems)
 	}
 
-	var config Config
-	bytes, _ := ioutil.ReadAll(configFile)
-	json.Unmarshal(bytes, &config)
+	for _, problem := range fileProblems {
+		util.LogWarning("Invalid config: "+problem, nil)
+	}
+	problems = append(problems, fileProblems...)
 	util.LogInfo("Loaded user config file")
 
-	configFile.Close()
+	if version < ConfigVersion {
+		util.LogInfo("Migrating config from version " +
+			strconv.Itoa(version) + " to " + strconv.Itoa(ConfigVersion))
+		if err := migrateConfigFile(path, config, version); err != nil {
+			util.LogError("Unable to save migrated config", err)
+			problems = append(problems, "unable to save the migrated config: "+
+				err.Error())
+		}
+	}
+
+	return config, problems
+}
+
+// defaultConfig returns the default config for LoadConfig, along with the
+// given problems and those found with the system defaults.
+func defaultConfig(system *SystemConfig, problems []string) (*Config,
+	[]string) {
+	config, defaultProblems := DefaultConfig(system)
+	for _, problem := range defaultProblems {
+		util.LogWarning("Invalid system defaults: "+problem, nil)
+	}
+	return config, append(problems, defaultProblems...)
+}
+
+// ReadConfig reads and validates the config file at path, migrating it to the
+// current schema version and applying the system config. The file itself is
+// not modified. The version the file was written with, and the problems found
+// by Validate, are returned.
+func ReadConfig(path string, system *SystemConfig) (*Config, int, []string,
+	error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	config, version, err := ParseConfig(data, system)
+	if err != nil {
+		return nil, version, nil, err
+	}
+
+	problems := config.Validate()
+	config.savedData = data
+	config.savedState = config.state()
+	return config, version, problems, nil
+}
+
+// Modified reports whether the config has been changed since it was last read
+// or written.
+func (config *Config) Modified() bool {
+	return !bytes.Equal(config.state(), config.savedState)
+}
+
+// state returns the config as it is written to the config file: without
+// its overrides, and with the settings in use copied to the active profile.
+// The values the system config gave the settings are replaced with those in
+// the user's own file, as described by restoreUserFields.
+func (config *Config) state() []byte {
+	saved := *config.withoutOverrides()
+	if saved.ActiveProfile != "" {
+		profiles := make(map[string]*Profile, len(saved.Profiles)+1)
+		for name, profile := range saved.Profiles {
+			profiles[name] = profile
+		}
+		profiles[saved.ActiveProfile] = &saved.Profile
+		saved.Profiles = profiles
+	}
+
+	if len(saved.locked) == 0 && len(saved.defaults) == 0 {
+		data, _ := json.MarshalIndent(saved, "", "  ")
+		return data
+	}
+	fields := saved.fields()
+	saved.restoreUserFields(fields)
+	data, _ := json.MarshalIndent(fields, "", "  ")
+	return data
+}
+
+// migrateConfigFile replaces the config file at path with the migrated
+// config, after copying the original to a backup named after its version. The
+// original stays in place until the migrated config has replaced it, so an
+// interrupted migration leaves the user with a readable config.
+func migrateConfigFile(path string, config *Config, version int) error {
+	backup := backupPath(path, "v"+strconv.Itoa(version))
+	if err := copyConfig(path, backup); err != nil {
+		return err
+	}
+	return writeConfig(path, config)
+}
+
+// backupConfig moves the config file at path to a backup with the given
+// suffix, returning the path of the backup.
+func backupConfig(path string, suffix string) (string, error) {
+	backup := backupPath(path, suffix)
+	return backup, os.Rename(path, backup)
+}
+
+// backupPath returns the path of the backup of the config file at path with
+// the given suffix.
+func backupPath(path string, suffix string) string {
+	return path + "." + suffix + ".bak"
+}
+
+// copyConfig copies the config file at path to dest, which is flushed to disk
+// before returning.
+func copyConfig(path string, dest string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// DefaultConfigPath returns the path of the user's config file, used unless
+// another is given on the command line.
+func DefaultConfigPath() (string, error) {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userConfigDir, ConfigDir, ConfigFile), nil
+}
 
-	return &config
+// clone returns a deep copy of the config, without its overrides.
+func (config *Config) clone() (*Config, error) {
+	return config.cloneFields(config.fields())
+}
+
+// cloneFields returns a config decoded from the given fields, which share the
+// config's saved state and system policy, but not its overrides.
+func (config *Config) cloneFields(fields map[string]interface{}) (*Config,
+	error) {
+	copied, err := buildConfig(fields)
+	if err != nil {
+		return nil, err
+	}
+	copied.savedData = config.savedData
+	copied.savedState = config.savedState
+	copied.policy = config.policy
+	copied.locked = config.locked
+	copied.defaults = config.defaults
+	return copied, nil
 }
 
 func NewConfig() *Config {
-	return &Config{
+	config := &Config{
+		Version:  ConfigVersion,
+		Profile:  *NewProfile(),
+		Profiles: map[string]*Profile{},
+	}
+	config.savedState = config.state()
+	return config
+}
+
+// NewProfile creates a profile with the default settings.
+func NewProfile() *Profile {
+	return &Profile{
 		Connect: &Connect{
 			Country: "",
 			City:    "",
@@ -82,31 +330,149 @@ func NewConfig() *Config {
 		Technology:           "",
 		WhiteList: &WhiteList{
 			Subnets:  []string{},
-			UDPPorts: []uint32{},
-			TCPPorts: []uint32{},
+			UDPPorts: []whitelist.PortRange{},
+			TCPPorts: []whitelist.PortRange{},
+			Presets:  []string{},
 		},
 	}
 }
 
+// SaveConfig saves the config to the user's config file. The settings in use
+// are first copied to the active profile. Overridden settings are saved with
+// the values they had before they were overridden.
 func SaveConfig(app *Application) error {
-	userConfigDir, err := os.UserConfigDir()
+	if app.ConfigPath == "" {
+		return errors.New("unable to determine user config directory")
+	}
+
+	app.Config.storeActiveProfile()
+	return writeConfig(app.ConfigPath, app.Config)
+}
+
+// saveWhiteListChange makes change to the whitelist in the config file, which
+// is the whitelist as it was last saved. Any other changes made to the config
+// in use since then remain unsaved. The file is only written if change
+// reports that it changed the whitelist.
+func saveWhiteListChange(app *Application,
+	change func(whiteList *WhiteList) bool) error {
+	if app.ConfigPath == "" {
+		return errors.New("unable to determine user config directory")
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(app.Config.savedState, &fields); err != nil {
+		return err
+	}
+	// The file leaves out the system defaults, and holds the user's own
+	// values for the locked settings
+	merged := map[string]interface{}{}
+	mergeConfigFields(merged, app.Config.defaults)
+	mergeConfigFields(merged, fields)
+	saved, err := app.Config.cloneFields(merged)
+	if err != nil {
+		return err
+	}
+	if err := saved.enforcePolicy(app.Config.policy); err != nil {
+		return err
+	}
+
+	if !change(saved.WhiteList) {
+		return nil
+	}
+	if err := writeConfig(app.ConfigPath, saved); err != nil {
+		return err
+	}
+	app.Config.savedData = saved.savedData
+	app.Config.savedState = saved.savedState
+	return nil
+}
+
+// DisplaySaveError logs an error returned by SaveConfig and displays it in the
+// info bar.
+func (app *Application) DisplaySaveError(err error) {
+	util.LogError("Unable to save config", err)
+	app.Window.InfoBar.DisplayMessage("Unable to save config: "+err.Error(),
+		gtk.MESSAGE_ERROR)
+}
+
+// writeConfig writes the config to the file at path at the current schema
+// version. The config is written to a temporary file which replaces the
+// config file once it is complete, so that the config file is never left
+// partially written. The previous ConfigBackups versions of the file are
+// kept. Concurrent writes are serialised.
+func writeConfig(path string, config *Config) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	config.Version = ConfigVersion
+	data := config.state()
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	// The temporary file is created with mode 0600, as the config may
+	// describe the user's network
+	temp, err := ioutil.TempFile(dir, filepath.Base(path)+".*.tmp")
 	if err != nil {
-		util.LogError("Unable to determine user config directory", err)
 		return err
 	}
-	userConfigPath := filepath.Join(userConfigDir, ConfigDir)
-	err = os.MkdirAll(userConfigPath, 0o700)
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := rotateConfigBackups(path); err != nil {
+		util.LogWarning("Unable to back up config file", err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+	config.savedData = data
+	config.savedState = data
+
+	return syncDir(dir)
+}
+
+// rotateConfigBackups copies the config file at path to path.bak.1, after
+// renaming each existing backup path.bak.N to path.bak.N+1. The oldest backup
+// is discarded once there are ConfigBackups of them.
+func rotateConfigBackups(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
-		util.LogError("Unable to create directory", err)
+		return err
+	}
+
+	backup := func(n int) string { return path + ".bak." + strconv.Itoa(n) }
+	for n := ConfigBackups - 1; n >= 1; n-- {
+		err := os.Rename(backup(n), backup(n+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 	}
 
-	configFile, err := os.OpenFile(filepath.Join(userConfigPath, ConfigFile),
-		os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0700)
+	return ioutil.WriteFile(backup(1), data, 0o600)
+}
+
+// syncDir flushes the directory entries of dir to disk, so that a rename
+// within it survives a crash.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
 	if err != nil {
-		util.LogError("err", err)
+		return err
 	}
-	bytes, _ := json.MarshalIndent(app.Config, "", "  ")
-	configFile.Write(bytes)
-	configFile.Close()
-	return nil
+	defer file.Close()
+	return file.Sync()
 }
@@ -0,0 +1,378 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"main/toml"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// BundleFormat identifies a file as a configuration bundle.
+const BundleFormat = "nordvpn-gtk-bundle"
+
+// BundleVersion is the version of the bundle format written by this version
+// of the application.
+const BundleVersion = 1
+
+// Bundle is a portable copy of the user's settings, which may be exported
+// from one installation and imported into another. Only the fields listed
+// here are exported, so nothing identifying the user's account is ever
+// included. Temporary whitelist entries and the addresses of whitelisted
+// hostnames are specific to this installation, so are left out too.
+type Bundle struct {
+	Format  string
+	Version int
+	// Settings are the settings in use, including the DNS servers, the
+	// whitelist and the connection saved on the 'Connect' tab.
+	Settings *Profile
+	// ActiveProfile is the name of the profile in use, if any.
+	ActiveProfile string
+	// Profiles are the saved profiles, by name.
+	Profiles map[string]*Profile
+}
+
+// ImportMode selects how an imported bundle is combined with the config.
+type ImportMode int
+
+const (
+	// ImportMerge adds the bundle's profiles, replacing those of the same
+	// name, and adds the entries of the bundle's whitelist to the whitelist
+	// in use. The other settings in use are kept.
+	ImportMerge ImportMode = iota
+	// ImportReplace replaces the settings in use and the profiles with those
+	// in the bundle.
+	ImportReplace
+)
+
+// ExportBundle returns the bundle of the config's settings and profiles.
+// Overridden settings are exported with their saved values.
+func (config *Config) ExportBundle() *Bundle {
+	saved := config.withoutOverrides()
+	bundle := &Bundle{
+		Format:        BundleFormat,
+		Version:       BundleVersion,
+		Settings:      portableProfile(&saved.Profile),
+		ActiveProfile: saved.ActiveProfile,
+		Profiles:      make(map[string]*Profile, len(saved.Profiles)),
+	}
+	for name, profile := range saved.Profiles {
+		bundle.Profiles[name] = portableProfile(profile)
+	}
+	// The active profile is only updated with the settings in use when the
+	// config is saved
+	if saved.ActiveProfile != "" {
+		bundle.Profiles[saved.ActiveProfile] = portableProfile(&saved.Profile)
+	}
+	return bundle
+}
+
+// EncodeBundle encodes the bundle for the file at path, as TOML if its name
+// ends in .toml, or as JSON otherwise.
+func EncodeBundle(bundle *Bundle, path string) ([]byte, error) {
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil || !isTOMLPath(path) {
+		return data, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return toml.Marshal(fields)
+}
+
+// DecodeBundle decodes the bundle read from the file at path, as TOML if its
+// name ends in .toml, or as JSON otherwise. Invalid settings are removed from
+// the bundle, and a description of each is returned.
+func DecodeBundle(data []byte, path string) (*Bundle, []string, error) {
+	var fields map[string]interface{}
+	var err error
+	if isTOMLPath(path) {
+		fields, err = toml.Unmarshal(data)
+	} else {
+		err = json.Unmarshal(data, &fields)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if fields["Format"] != BundleFormat {
+		return nil, nil, fmt.Errorf("not a %s configuration bundle", AppName)
+	}
+
+	// The fields are decoded again to check their types
+	if data, err = json.Marshal(fields); err != nil {
+		return nil, nil, err
+	}
+	bundle := &Bundle{}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return nil, nil, err
+	}
+	if bundle.Version > BundleVersion {
+		return nil, nil, fmt.Errorf("bundle version %d is newer than the "+
+			"supported version %d", bundle.Version, BundleVersion)
+	}
+
+	return bundle, bundle.validate(), nil
+}
+
+// validate removes the invalid settings and profiles from the bundle, along
+// with anything specific to the installation it was exported from, and
+// returns a description of each problem.
+func (bundle *Bundle) validate() []string {
+	var problems []string
+
+	if bundle.Settings != nil {
+		bundle.Settings = portableProfile(bundle.Settings)
+		for _, problem := range bundle.Settings.validate() {
+			problems = append(problems, "settings: "+problem)
+		}
+	}
+
+	for name, profile := range bundle.Profiles {
+		if profile == nil {
+			delete(bundle.Profiles, name)
+			problems = append(problems, "profile "+name+" is empty")
+			continue
+		}
+		bundle.Profiles[name] = portableProfile(profile)
+		for _, problem := range bundle.Profiles[name].validate() {
+			problems = append(problems, "profile "+name+": "+problem)
+		}
+	}
+
+	if _, ok := bundle.Profiles[bundle.ActiveProfile]; !ok &&
+		bundle.ActiveProfile != "" {
+		problems = append(problems, fmt.Sprintf("the active profile %q "+
+			"does not exist", bundle.ActiveProfile))
+		bundle.ActiveProfile = ""
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// ImportBundle returns a copy of the config with the bundle imported in the
+// given mode. The config itself is not modified. The copy has no overrides,
+// and settings locked by the system policy keep their enforced values. A
+// description of each setting which could not be imported is returned.
+func (config *Config) ImportBundle(bundle *Bundle, mode ImportMode) (*Config,
+	[]string, error) {
+	current := config.withoutOverrides()
+	imported, err := current.clone()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if imported.Profiles == nil || mode == ImportReplace {
+		imported.Profiles = map[string]*Profile{}
+	}
+	if mode == ImportReplace {
+		imported.ActiveProfile = bundle.ActiveProfile
+		if bundle.Settings != nil {
+			imported.Profile = *bundle.Settings.Clone()
+		} else if profile, ok := bundle.Profiles[bundle.ActiveProfile]; ok {
+			imported.Profile = *profile.Clone()
+		}
+	}
+
+	for name, profile := range bundle.Profiles {
+		imported.Profiles[name] = profile.Clone()
+	}
+
+	if mode == ImportMerge {
+		// The settings in use would otherwise replace the imported profile
+		// when the config is saved
+		if profile, ok := bundle.Profiles[imported.ActiveProfile]; ok {
+			imported.Profile = *profile.Clone()
+		}
+		if bundle.Settings != nil {
+			imported.WhiteList.merge(bundle.Settings.WhiteList)
+		}
+	}
+
+	// Keep the parts of the whitelist specific to this installation
+	imported.WhiteList.Temporary = current.WhiteList.Temporary
+	imported.WhiteList.ResolvedHosts = map[string][]string{}
+	for hostname, subnets := range current.WhiteList.ResolvedHosts {
+		imported.WhiteList.ResolvedHosts[hostname] = subnets
+	}
+	imported.WhiteList.forgetUnusedHosts()
+
+	problems := imported.enforceImportPolicy(config.policy)
+	return imported, append(problems, imported.Validate()...), nil
+}
+
+// enforceImportPolicy enforces the system policy on an imported config,
+// returning a description of each locked setting whose imported value was
+// replaced.
+func (config *Config) enforceImportPolicy(
+	policy map[string]interface{}) []string {
+	before := config.fields()
+	if err := config.enforcePolicy(policy); err != nil {
+		return []string{"unable to apply system policy: " + err.Error()}
+	}
+	after := config.fields()
+
+	var problems []string
+	for _, field := range sortedLockedFields(config.locked) {
+		parts := strings.Split(field, ".")
+		changed := !reflect.DeepEqual(fieldValue(before, parts...),
+			fieldValue(after, parts...))
+		for _, name := range config.ProfileNames() {
+			path := append([]string{"Profiles", name}, parts...)
+			changed = changed || !reflect.DeepEqual(
+				fieldValue(before, path...), fieldValue(after, path...))
+		}
+		if changed {
+			problems = append(problems, "not importing "+field+
+				": it is managed by your organisation")
+		}
+	}
+	return problems
+}
+
+// merge adds the subnets, ports, presets and hostnames of other which are not
+// already in the whitelist.
+func (whiteList *WhiteList) merge(other *WhiteList) {
+	if other == nil {
+		return
+	}
+
+	addStrings := func(values []string, others []string) []string {
+		for _, value := range others {
+			if !containsString(values, value) {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+	whiteList.Subnets = addStrings(whiteList.Subnets, other.Subnets)
+	whiteList.Presets = addStrings(whiteList.Presets, other.Presets)
+	whiteList.Hostnames = addStrings(whiteList.Hostnames, other.Hostnames)
+	whiteList.UDPPorts = append(whiteList.UDPPorts, other.UDPPorts...)
+	whiteList.TCPPorts = append(whiteList.TCPPorts, other.TCPPorts...)
+	whiteList.Normalise()
+}
+
+// DiffConfigs returns a description of each difference between the saved
+// forms of the configs, in the order of the config file.
+func DiffConfigs(old *Config, new *Config) []string {
+	var oldFields, newFields map[string]interface{}
+	_ = json.Unmarshal(old.state(), &oldFields)
+	_ = json.Unmarshal(new.state(), &newFields)
+	delete(oldFields, "Version")
+	delete(newFields, "Version")
+
+	var differences []string
+	diffFields(&differences, "", oldFields, newFields)
+	return differences
+}
+
+// diffFields appends a description of each difference between the values
+// old and new of the field at path to differences. Objects are compared
+// field by field.
+func diffFields(differences *[]string, path string, old interface{},
+	new interface{}) {
+	oldObject, oldIsObject := old.(map[string]interface{})
+	newObject, newIsObject := new.(map[string]interface{})
+	if !oldIsObject || !newIsObject {
+		if !reflect.DeepEqual(old, new) &&
+			!(isEmptyField(old) && isEmptyField(new)) {
+			*differences = append(*differences, path+": "+
+				describeField(old)+" → "+describeField(new))
+		}
+		return
+	}
+
+	keys := map[string]interface{}{}
+	for key := range oldObject {
+		keys[key] = nil
+	}
+	for key := range newObject {
+		keys[key] = nil
+	}
+
+	for _, key := range sortedKeys(keys) {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		oldValue, inOld := oldObject[key]
+		newValue, inNew := newObject[key]
+		switch {
+		case !inOld:
+			*differences = append(*differences, keyPath+": added")
+		case !inNew:
+			*differences = append(*differences, keyPath+": removed")
+		default:
+			diffFields(differences, keyPath, oldValue, newValue)
+		}
+	}
+}
+
+// isEmptyField reports whether a field's value is null, or an empty list or
+// object, all of which the application treats alike.
+func isEmptyField(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	}
+	return false
+}
+
+// describeField returns the value of a field as it appears in the config
+// file, abbreviated if it is long.
+func describeField(value interface{}) string {
+	data, _ := json.Marshal(value)
+	text := []rune(string(data))
+	if len(text) > 60 {
+		return string(text[:57]) + "..."
+	}
+	return string(text)
+}
+
+// fieldValue returns the value at path within fields, or nil if there is
+// none.
+func fieldValue(fields map[string]interface{}, path ...string) interface{} {
+	var value interface{} = fields
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// sortedLockedFields returns the locked fields in alphabetical order.
+func sortedLockedFields(locked map[string]bool) []string {
+	fields := make([]string, 0, len(locked))
+	for field := range locked {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// portableProfile returns a copy of the profile without the parts of its
+// whitelist which are specific to this installation.
+func portableProfile(profile *Profile) *Profile {
+	portable := profile.Clone()
+	portable.WhiteList.ResolvedHosts = nil
+	portable.WhiteList.Temporary = nil
+	return portable
+}
+
+// isTOMLPath reports whether the file at path holds TOML rather than JSON.
+func isTOMLPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".toml")
+}
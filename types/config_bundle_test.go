@@ -0,0 +1,322 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bundleTestConfig returns a config whose settings in use and saved profile
+// both have whitelist entries specific to this installation: the addresses
+// of a whitelisted hostname, and a temporary entry.
+func bundleTestConfig() *Config {
+	expires := time.Now().Add(time.Hour)
+
+	config := NewConfig()
+	config.Protocol = "UDP"
+	config.KillSwitchEnabled = true
+	config.DNSServers = []string{"1.1.1.1"}
+	config.WhiteList.Subnets = []string{"10.0.0.0/8"}
+	config.WhiteList.Hostnames = []string{"nas.local"}
+	config.WhiteList.ResolvedHosts = map[string][]string{
+		"nas.local": {"192.0.2.10/32"},
+	}
+	config.WhiteList.Temporary = []TemporaryEntry{
+		{Kind: EntrySubnet, Value: "198.51.100.0/24", Expires: expires},
+	}
+
+	home := NewProfile()
+	home.Protocol = "TCP"
+	home.WhiteList.Hostnames = []string{"printer.local"}
+	home.WhiteList.ResolvedHosts = map[string][]string{
+		"printer.local": {"192.0.2.20/32"},
+	}
+	home.WhiteList.Temporary = []TemporaryEntry{
+		{Kind: EntryUDP, Value: "51820", Expires: expires},
+	}
+	config.Profiles = map[string]*Profile{"home": home}
+	return config
+}
+
+func TestExportBundle(t *testing.T) {
+	config := bundleTestConfig()
+	config.ActiveProfile = "home"
+
+	bundle := config.ExportBundle()
+	if bundle.Format != BundleFormat || bundle.Version != BundleVersion {
+		t.Errorf("got format %q version %d, want %q version %d",
+			bundle.Format, bundle.Version, BundleFormat, BundleVersion)
+	}
+	if bundle.ActiveProfile != "home" {
+		t.Errorf("got active profile %q, want home", bundle.ActiveProfile)
+	}
+	if bundle.Settings.Protocol != "UDP" ||
+		!reflect.DeepEqual(bundle.Settings.WhiteList.Hostnames,
+			[]string{"nas.local"}) {
+		t.Errorf("got settings %+v, want those in use", bundle.Settings)
+	}
+	// The active profile is exported with the settings in use
+	if home := bundle.Profiles["home"]; home == nil ||
+		home.Protocol != "UDP" {
+		t.Errorf("got home profile %+v, want the settings in use", home)
+	}
+
+	profiles := []*Profile{bundle.Settings}
+	for _, profile := range bundle.Profiles {
+		profiles = append(profiles, profile)
+	}
+	for _, profile := range profiles {
+		if profile.WhiteList.ResolvedHosts != nil ||
+			profile.WhiteList.Temporary != nil {
+			t.Errorf("got resolved hosts %v and temporary entries %v, "+
+				"want none", profile.WhiteList.ResolvedHosts,
+				profile.WhiteList.Temporary)
+		}
+	}
+
+	// Exporting leaves the config alone
+	if len(config.WhiteList.ResolvedHosts) != 1 ||
+		len(config.WhiteList.Temporary) != 1 ||
+		len(config.Profiles["home"].WhiteList.Temporary) != 1 {
+		t.Errorf("got whitelist %+v after exporting, want it unchanged",
+			config.WhiteList)
+	}
+}
+
+func TestEncodeBundle(t *testing.T) {
+	config := bundleTestConfig()
+	bundle := config.ExportBundle()
+
+	for _, path := range []string{"bundle.json", "bundle.toml"} {
+		t.Run(path, func(t *testing.T) {
+			data, err := EncodeBundle(bundle, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, private := range []string{
+				"192.0.2.10", "192.0.2.20", "198.51.100.0", "51820",
+			} {
+				if strings.Contains(string(data), private) {
+					t.Errorf("%s was exported in\n%s", private, data)
+				}
+			}
+
+			decoded, problems, err := DecodeBundle(data, path)
+			if err != nil {
+				t.Fatalf("%v in\n%s", err, data)
+			}
+			if len(problems) > 0 {
+				t.Errorf("got problems %v", problems)
+			}
+			if decoded.Settings.Protocol != "UDP" ||
+				!decoded.Settings.KillSwitchEnabled ||
+				!reflect.DeepEqual(decoded.Settings.WhiteList.Subnets,
+					[]string{"10.0.0.0/8"}) {
+				t.Errorf("got settings %+v, want those exported",
+					decoded.Settings)
+			}
+			if home := decoded.Profiles["home"]; home == nil ||
+				home.Protocol != "TCP" {
+				t.Errorf("got home profile %+v, want the one exported", home)
+			}
+		})
+	}
+
+	// Only the settings and profiles are exported
+	data, err := EncodeBundle(bundle, "bundle.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	want := []string{"ActiveProfile", "Format", "Profiles", "Settings",
+		"Version"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("got fields %v, want %v", keys, want)
+	}
+}
+
+func TestDecodeBundleRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not a bundle", `{"Protocol": "UDP"}`},
+		{"newer version", `{"Format": "nordvpn-gtk-bundle", "Version": 2}`},
+		{"invalid type", `{"Format": "nordvpn-gtk-bundle", "Version": 1,
+			"Settings": {"Protocol": 1}}`},
+		{"invalid JSON", `{"Format": `},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if bundle, _, err := DecodeBundle([]byte(test.data),
+				"bundle.json"); err == nil {
+				t.Errorf("got %+v, want an error", bundle)
+			}
+		})
+	}
+}
+
+// importTestBundle returns a bundle whose whitelist has a subnet in common
+// with bundleTestConfig, and which replaces its home profile.
+func importTestBundle() *Bundle {
+	settings := NewProfile()
+	settings.Protocol = "TCP"
+	settings.WhiteList.Subnets = []string{"10.0.0.0/8", "192.168.0.0/16"}
+
+	home := NewProfile()
+	home.Protocol = "UDP"
+	home.ObfuscationEnabled = true
+	travel := NewProfile()
+	travel.KillSwitchEnabled = true
+
+	return &Bundle{
+		Format:        BundleFormat,
+		Version:       BundleVersion,
+		Settings:      settings,
+		ActiveProfile: "travel",
+		Profiles:      map[string]*Profile{"home": home, "travel": travel},
+	}
+}
+
+func TestImportBundleMerge(t *testing.T) {
+	config := bundleTestConfig()
+	imported, problems, err := config.ImportBundle(importTestBundle(),
+		ImportMerge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("got problems %v", problems)
+	}
+
+	// The settings in use are kept, and the whitelists merged
+	if imported.Protocol != "UDP" || !imported.KillSwitchEnabled ||
+		imported.ActiveProfile != "" {
+		t.Errorf("got protocol %q, kill switch %v and active profile %q, "+
+			"want the settings in use", imported.Protocol,
+			imported.KillSwitchEnabled, imported.ActiveProfile)
+	}
+	subnets := []string{"10.0.0.0/8", "192.168.0.0/16"}
+	if !reflect.DeepEqual(imported.WhiteList.Subnets, subnets) {
+		t.Errorf("got subnets %v, want %v", imported.WhiteList.Subnets,
+			subnets)
+	}
+
+	// Profiles of the same name are replaced
+	if names := imported.ProfileNames(); !reflect.DeepEqual(names,
+		[]string{"home", "travel"}) {
+		t.Errorf("got profiles %v, want home and travel", names)
+	}
+	if home := imported.Profiles["home"]; !home.ObfuscationEnabled ||
+		home.Protocol != "UDP" {
+		t.Errorf("got home profile %+v, want the imported one", home)
+	}
+
+	// The entries specific to this installation are kept
+	if !reflect.DeepEqual(imported.WhiteList.ResolvedHosts,
+		config.WhiteList.ResolvedHosts) ||
+		!reflect.DeepEqual(imported.WhiteList.Temporary,
+			config.WhiteList.Temporary) {
+		t.Errorf("got resolved hosts %v and temporary entries %v, want "+
+			"those of the config", imported.WhiteList.ResolvedHosts,
+			imported.WhiteList.Temporary)
+	}
+
+	// The config itself is not modified
+	if config.Protocol != "UDP" || len(config.WhiteList.Subnets) != 1 ||
+		config.Profiles["home"].Protocol != "TCP" {
+		t.Errorf("got config %+v after importing, want it unchanged",
+			config.Profile)
+	}
+}
+
+func TestImportBundleReplace(t *testing.T) {
+	config := bundleTestConfig()
+	imported, problems, err := config.ImportBundle(importTestBundle(),
+		ImportReplace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("got problems %v", problems)
+	}
+
+	// The settings in use and the profiles are replaced
+	if imported.Protocol != "TCP" || imported.KillSwitchEnabled ||
+		imported.ActiveProfile != "travel" {
+		t.Errorf("got protocol %q, kill switch %v and active profile %q, "+
+			"want those imported", imported.Protocol,
+			imported.KillSwitchEnabled, imported.ActiveProfile)
+	}
+	subnets := []string{"10.0.0.0/8", "192.168.0.0/16"}
+	if !reflect.DeepEqual(imported.WhiteList.Subnets, subnets) ||
+		len(imported.WhiteList.Hostnames) > 0 {
+		t.Errorf("got subnets %v and hostnames %v, want subnets %v",
+			imported.WhiteList.Subnets, imported.WhiteList.Hostnames,
+			subnets)
+	}
+	if names := imported.ProfileNames(); !reflect.DeepEqual(names,
+		[]string{"home", "travel"}) {
+		t.Errorf("got profiles %v, want home and travel", names)
+	}
+
+	// Temporary entries are kept, but the addresses of hostnames which are
+	// no longer whitelisted are forgotten
+	if !reflect.DeepEqual(imported.WhiteList.Temporary,
+		config.WhiteList.Temporary) {
+		t.Errorf("got temporary entries %v, want %v",
+			imported.WhiteList.Temporary, config.WhiteList.Temporary)
+	}
+	if len(imported.WhiteList.ResolvedHosts) > 0 {
+		t.Errorf("got resolved hosts %v, want none",
+			imported.WhiteList.ResolvedHosts)
+	}
+
+	if config.Protocol != "UDP" || config.ActiveProfile != "" {
+		t.Errorf("got config %+v after importing, want it unchanged",
+			config.Profile)
+	}
+}
+
+func TestImportBundleKeepsLockedSettings(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, PolicyFile, `{"KillSwitchEnabled": true}`)
+	system, problems := LoadSystemConfig(dir)
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	path := writeFile(t, dir, "user.conf", `{"Version": 1}`)
+	config, _, _, err := ReadConfig(path, system)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := importTestBundle()
+	imported, problems, err := config.ImportBundle(bundle, ImportReplace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !imported.KillSwitchEnabled {
+		t.Error("got the kill switch disabled, want the locked value")
+	}
+	if imported.Protocol != "TCP" {
+		t.Errorf("got protocol %q, want TCP", imported.Protocol)
+	}
+	want := []string{"not importing KillSwitchEnabled: it is managed by " +
+		"your organisation"}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("got problems %v, want %v", problems, want)
+	}
+}
@@ -0,0 +1,266 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"main/util"
+	"main/whitelist"
+	"net"
+	"strings"
+)
+
+// ConfigVersion is the version of the config schema written by this version
+// of the application. It is incremented whenever a migration is added to
+// configMigrations.
+const ConfigVersion = 1
+
+// configMigration upgrades a decoded config file by one schema version.
+type configMigration func(fields map[string]interface{}) error
+
+// configMigrations contains the migrations between each schema version. The
+// migration at index i upgrades a config from version i to version i + 1.
+var configMigrations = []configMigration{
+	migrateConfigV0,
+}
+
+// ParseConfig decodes a config file, migrating it to the current schema
+// version. Fields missing from the file are given the system defaults, or
+// their default values otherwise, and the system policy is then enforced. The
+// version the file was written with is returned, so that the caller can tell
+// whether it was migrated.
+func ParseConfig(data []byte, system *SystemConfig) (*Config, int, error) {
+	fields, version, err := decodeConfigFields(data)
+	if err != nil {
+		return nil, version, err
+	}
+
+	merged := map[string]interface{}{}
+	mergeConfigFields(merged, system.Defaults)
+	mergeConfigFields(merged, fields)
+
+	config, err := buildConfig(merged)
+	if err != nil {
+		return nil, version, err
+	}
+	config.defaults = system.Defaults
+	if err := config.enforcePolicy(system.Policy); err != nil {
+		return nil, version, err
+	}
+	return config, version, nil
+}
+
+// DefaultConfig returns the config used when the user has not saved one: the
+// default config with the system defaults applied and the system policy
+// enforced. The problems found by Validate are returned.
+func DefaultConfig(system *SystemConfig) (*Config, []string) {
+	config, _, err := ParseConfig([]byte("{}"), system)
+	if err != nil {
+		util.LogWarning("Unable to apply system config", err)
+		return NewConfig(), nil
+	}
+
+	problems := config.Validate()
+	config.savedState = config.state()
+	return config, problems
+}
+
+// decodeConfigFields decodes the fields of a config file, migrating them to
+// the current schema version. The version the file was written with is
+// returned.
+func decodeConfigFields(data []byte) (map[string]interface{}, int, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, 0, err
+	}
+	if fields == nil {
+		return nil, 0, fmt.Errorf("config is not a JSON object")
+	}
+
+	version := 0
+	if value, ok := fields["Version"]; ok {
+		number, ok := value.(float64)
+		if !ok || number != float64(int(number)) || number < 0 {
+			return nil, 0, fmt.Errorf("invalid config version %v", value)
+		}
+		version = int(number)
+	}
+	if version > ConfigVersion {
+		return nil, version, fmt.Errorf("config version %d is newer than "+
+			"the supported version %d", version, ConfigVersion)
+	}
+
+	for v := version; v < ConfigVersion; v++ {
+		if err := configMigrations[v](fields); err != nil {
+			return nil, version, fmt.Errorf(
+				"unable to migrate config from version %d: %w", v, err)
+		}
+	}
+	fields["Version"] = ConfigVersion
+
+	return fields, version, nil
+}
+
+// buildConfig decodes the fields of a config at the current schema version.
+func buildConfig(fields map[string]interface{}) (*Config, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	config := NewConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	config.fillDefaults()
+	return config, nil
+}
+
+// mergeConfigFields copies the fields of src into dst. Objects, such as the
+// whitelist, are merged field by field; any other value in src replaces the
+// value in dst.
+func mergeConfigFields(dst map[string]interface{},
+	src map[string]interface{}) {
+	for key, value := range src {
+		srcObject, srcIsObject := value.(map[string]interface{})
+		dstObject, dstIsObject := dst[key].(map[string]interface{})
+		if srcIsObject && dstIsObject {
+			mergeConfigFields(dstObject, srcObject)
+			continue
+		}
+		if srcIsObject {
+			copied := map[string]interface{}{}
+			mergeConfigFields(copied, srcObject)
+			value = copied
+		}
+		dst[key] = value
+	}
+}
+
+// migrateConfigV0 upgrades the unversioned config written by the earliest
+// releases. These split the DNS servers entered on the 'Configure' tab on
+// commas without trimming them, so empty and padded entries are cleaned up.
+func migrateConfigV0(fields map[string]interface{}) error {
+	value, ok := fields["DNSServers"]
+	if !ok || value == nil {
+		return nil
+	}
+
+	servers, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("DNSServers is not a list")
+	}
+
+	texts := make([]string, 0, len(servers))
+	for _, server := range servers {
+		text, ok := server.(string)
+		if !ok {
+			return fmt.Errorf("DNSServers contains %v, which is not a string",
+				server)
+		}
+		texts = append(texts, text)
+	}
+
+	fields["DNSServers"] = ParseDNS(strings.Join(texts, ","))
+	return nil
+}
+
+// Validate checks the values of the settings in use and of each saved
+// profile. Invalid values are replaced with their defaults, and a description
+// of each problem is returned.
+func (config *Config) Validate() []string {
+	problems := config.Profile.validate()
+
+	for _, name := range config.ProfileNames() {
+		profile := config.Profiles[name]
+		if profile == nil {
+			delete(config.Profiles, name)
+			problems = append(problems, "profile "+name+" is empty, and "+
+				"has been removed")
+			continue
+		}
+		profile.fillDefaults()
+		for _, problem := range profile.validate() {
+			problems = append(problems, "profile "+name+": "+problem)
+		}
+	}
+
+	if _, ok := config.Profiles[config.ActiveProfile]; !ok &&
+		config.ActiveProfile != "" {
+		problems = append(problems, fmt.Sprintf("the active profile %q "+
+			"does not exist", config.ActiveProfile))
+		config.ActiveProfile = ""
+	}
+
+	return problems
+}
+
+// validate checks the values of the profile's settings, replacing invalid
+// values with their defaults, and returns a description of each problem.
+func (profile *Profile) validate() []string {
+	var problems []string
+
+	switch strings.ToUpper(profile.Protocol) {
+	case "", "UDP", "TCP":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown protocol %q",
+			profile.Protocol))
+		profile.Protocol = ""
+	}
+
+	switch strings.ToUpper(profile.Technology) {
+	case "", "OPENVPN", "NORDLYNX":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown technology %q",
+			profile.Technology))
+		profile.Technology = ""
+	}
+
+	var servers []string
+	for _, server := range profile.DNSServers {
+		if net.ParseIP(server) == nil {
+			problems = append(problems, fmt.Sprintf(
+				"DNS server %q is not an IP address", server))
+			continue
+		}
+		servers = append(servers, server)
+	}
+	profile.DNSServers = servers
+
+	return append(problems, profile.WhiteList.validate()...)
+}
+
+// validate removes the invalid entries from the whitelist, returning a
+// description of each. The remaining subnets and ports are normalised.
+func (whiteList *WhiteList) validate() []string {
+	var problems []string
+
+	for _, issue := range whiteList.Normalise() {
+		if issue.Kind == whitelist.IssueInvalid {
+			problems = append(problems, "whitelist: "+issue.String())
+			continue
+		}
+		util.LogWarning("Simplified whitelist: "+issue.String(), nil)
+	}
+
+	var hostnames []string
+	for _, hostname := range whiteList.Hostnames {
+		if _, err := whitelist.ParseHostname(hostname); err != nil {
+			problems = append(problems, "whitelist: "+err.Error())
+			continue
+		}
+		hostnames = append(hostnames, hostname)
+	}
+	whiteList.Hostnames = hostnames
+
+	var temporary []TemporaryEntry
+	for _, entry := range whiteList.Temporary {
+		if err := entry.validate(); err != nil {
+			problems = append(problems, "whitelist: "+err.Error())
+			continue
+		}
+		temporary = append(temporary, entry)
+	}
+	whiteList.Temporary = temporary
+
+	return problems
+}
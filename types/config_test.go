@@ -0,0 +1,265 @@
+package types
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestMigrateConfigV0(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers interface{}
+		want    interface{}
+	}{
+		{
+			name:    "clean",
+			servers: []interface{}{"1.1.1.1", "8.8.8.8"},
+			want:    []string{"1.1.1.1", "8.8.8.8"},
+		},
+		{
+			name:    "padded",
+			servers: []interface{}{"1.1.1.1", " 8.8.8.8 "},
+			want:    []string{"1.1.1.1", "8.8.8.8"},
+		},
+		{
+			name:    "empty entries",
+			servers: []interface{}{"", "1.1.1.1", " ", ""},
+			want:    []string{"1.1.1.1"},
+		},
+		{
+			name:    "unsplit",
+			servers: []interface{}{"1.1.1.1, 8.8.8.8"},
+			want:    []string{"1.1.1.1", "8.8.8.8"},
+		},
+		{
+			name:    "only empty entries",
+			servers: []interface{}{""},
+			want:    []string(nil),
+		},
+		{
+			name:    "null",
+			servers: nil,
+			want:    nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields := map[string]interface{}{
+				"DNSServers": test.servers,
+				"Protocol":   "TCP",
+			}
+			if err := migrateConfigV0(fields); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fields["DNSServers"], test.want) {
+				t.Errorf("got %#v, want %#v", fields["DNSServers"], test.want)
+			}
+			if fields["Protocol"] != "TCP" {
+				t.Errorf("got protocol %v, want TCP", fields["Protocol"])
+			}
+		})
+	}
+
+	// A config without DNS servers is left alone
+	fields := map[string]interface{}{"Protocol": "TCP"}
+	if err := migrateConfigV0(fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["DNSServers"]; ok {
+		t.Errorf("got DNS servers %v, want none", fields["DNSServers"])
+	}
+}
+
+func TestMigrateConfigV0Rejects(t *testing.T) {
+	for _, servers := range []interface{}{
+		"1.1.1.1",
+		[]interface{}{"1.1.1.1", 8},
+	} {
+		fields := map[string]interface{}{"DNSServers": servers}
+		if err := migrateConfigV0(fields); err == nil {
+			t.Errorf("%v was migrated, want an error", servers)
+		}
+	}
+}
+
+func TestDecodeConfigFieldsVersions(t *testing.T) {
+	tests := []struct {
+		data    string
+		version int
+		ok      bool
+	}{
+		{`{}`, 0, true},
+		{`{"Version": 0}`, 0, true},
+		{`{"Version": 1}`, 1, true},
+		{`{"Version": 2}`, 2, false},
+		{`{"Version": -1}`, 0, false},
+		{`{"Version": 0.5}`, 0, false},
+		{`{"Version": "1"}`, 0, false},
+		{`{"DNSServers": "1.1.1.1"}`, 0, false},
+		{`[]`, 0, false},
+		{`null`, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+			fields, version, err := decodeConfigFields([]byte(test.data))
+			if version != test.version {
+				t.Errorf("got version %d, want %d", version, test.version)
+			}
+			if !test.ok {
+				if err == nil {
+					t.Errorf("got %v, want an error", fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fields["Version"] != ConfigVersion {
+				t.Errorf("got version %v after migrating, want %d",
+					fields["Version"], ConfigVersion)
+			}
+		})
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	original := `{"DNSServers": ["1.1.1.1", " 8.8.8.8", ""],
+		"KillSwitchEnabled": true}`
+	path := writeFile(t, dir, "config.json", original)
+
+	config, version, problems, err := ReadConfig(path, &SystemConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	if version != 0 {
+		t.Fatalf("got version %d, want 0", version)
+	}
+	want := []string{"1.1.1.1", "8.8.8.8"}
+	if !reflect.DeepEqual(config.DNSServers, want) {
+		t.Errorf("got DNS servers %v, want %v", config.DNSServers, want)
+	}
+
+	if err := migrateConfigFile(path, config, version); err != nil {
+		t.Fatal(err)
+	}
+
+	// The original is kept in a backup named after its version
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json.v0.bak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Errorf("got backup %s, want the original config", data)
+	}
+
+	fields := readFields(t, path)
+	if fields["Version"] != float64(ConfigVersion) {
+		t.Errorf("got version %v, want %d", fields["Version"], ConfigVersion)
+	}
+	servers, _ := fields["DNSServers"].([]interface{})
+	if len(servers) != 2 || servers[0] != "1.1.1.1" ||
+		servers[1] != "8.8.8.8" {
+		t.Errorf("got DNS servers %v, want %v", fields["DNSServers"], want)
+	}
+	if fields["KillSwitchEnabled"] != true {
+		t.Errorf("got kill switch %v, want true",
+			fields["KillSwitchEnabled"])
+	}
+
+	// The migrated config is read without migrating it again
+	migrated, version, _, err := ReadConfig(path, &SystemConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != ConfigVersion {
+		t.Errorf("got version %d, want %d", version, ConfigVersion)
+	}
+	if !reflect.DeepEqual(migrated.DNSServers, want) {
+		t.Errorf("got DNS servers %v, want %v", migrated.DNSServers, want)
+	}
+}
+
+func TestRotateConfigBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	// Nothing is backed up before the config has been written
+	if err := rotateConfigBackups(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bak.1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v, want no backup", err)
+	}
+
+	// Each save is numbered, so that the backups show which one they hold
+	saves := ConfigBackups + 3
+	for save := 1; save <= saves; save++ {
+		if err := rotateConfigBackups(path); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, dir, "config.json", strconv.Itoa(save))
+	}
+
+	for n := 1; n <= ConfigBackups; n++ {
+		data, err := ioutil.ReadFile(path + ".bak." + strconv.Itoa(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strconv.Itoa(saves - n); string(data) != want {
+			t.Errorf("backup %d: got save %s, want %s", n, data, want)
+		}
+	}
+	_, err := os.Stat(path + ".bak." + strconv.Itoa(ConfigBackups+1))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want only %d backups", err, ConfigBackups)
+	}
+}
+
+func TestWriteConfigRotatesBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config", "config.json")
+	config := NewConfig()
+
+	for _, protocol := range []string{"UDP", "TCP"} {
+		config.Protocol = protocol
+		if err := writeConfig(path, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if protocol := readFields(t, path)["Protocol"]; protocol != "TCP" {
+		t.Errorf("got protocol %v, want TCP", protocol)
+	}
+	if protocol := readFields(t, path+".bak.1")["Protocol"]; protocol !=
+		"UDP" {
+		t.Errorf("got protocol %v in the backup, want UDP", protocol)
+	}
+	if config.Modified() {
+		t.Error("config is modified after writing it")
+	}
+
+	// No temporary files are left behind
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"config.json", "config.json.bak.1"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got files %v, want %v", names, want)
+	}
+}
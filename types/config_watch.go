@@ -0,0 +1,121 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"main/filewatch"
+	"main/util"
+	"os"
+	"path/filepath"
+)
+
+// configReloadMessageID identifies the info bar message offering to reload
+// the config file, discarding unsaved changes.
+const configReloadMessageID = "config-reload"
+
+// StartConfigWatcher reloads the config whenever the config file is changed
+// by another program, such as a text editor or dotfile manager.
+func (app *Application) StartConfigWatcher() {
+	path := app.ConfigPath
+	if path == "" {
+		return
+	}
+
+	// The directory containing the config file is watched, so it must exist
+	// even if the config has never been saved
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		util.LogWarning("Unable to create directory", err)
+		return
+	}
+
+	watcher, err := filewatch.Watch(path, ConfigReloadDelay, func() {
+		glib.IdleAdd(func() { app.ReloadConfig(false) })
+	})
+	if err != nil {
+		util.LogWarning("Unable to watch config file for changes", err)
+		return
+	}
+	app.configWatcher = watcher
+}
+
+// StopConfigWatcher stops watching the config file for changes.
+func (app *Application) StopConfigWatcher() {
+	if app.configWatcher == nil {
+		return
+	}
+	if err := app.configWatcher.Close(); err != nil {
+		util.LogWarning("Unable to stop watching config file", err)
+	}
+	app.configWatcher = nil
+}
+
+// ReloadConfig reads the config file again, replacing the config in use if
+// the file has changed since it was last read or written. If the config in
+// use has unsaved changes, the info bar instead offers to reload the file,
+// unless discardChanges is set. The overrides given for this run are applied
+// to the new config, and the controls are then populated from it without
+// sending its settings to the daemon.
+func (app *Application) ReloadConfig(discardChanges bool) {
+	path := app.ConfigPath
+	if path == "" {
+		return
+	}
+
+	// The system config is read again too, in case it has also changed
+	system, problems := LoadSystemConfig(SystemConfigDir)
+	config, _, fileProblems, err := ReadConfig(path, system)
+	if errors.Is(err, os.ErrNotExist) {
+		// The config in use is kept, and written again when next saved
+		return
+	}
+	if err != nil {
+		util.LogWarning("Unable to reload config file", err)
+		app.ReportConfigProblems([]string{"unable to reload " + path +
+			", keeping the current config: " + err.Error()})
+		return
+	}
+
+	// The config was written by this application, or rewritten unchanged
+	if bytes.Equal(config.savedData, app.Config.savedData) {
+		return
+	}
+
+	problems = append(problems, fileProblems...)
+
+	if app.Config.Modified() && !discardChanges {
+		app.Window.InfoBar.Post(Message{
+			ID: configReloadMessageID,
+			Text: "Your config file was changed by another program, " +
+				"but you have unsaved changes",
+			Type:        gtk.MESSAGE_WARNING,
+			ActionLabel: "Reload",
+			Action:      func() { app.ReloadConfig(true) },
+		})
+		return
+	}
+
+	problems = append(problems, config.ApplyOverrides(app.Overrides)...)
+	for _, problem := range problems {
+		util.LogWarning("Invalid config: "+problem, nil)
+	}
+	util.LogInfo("Reloaded user config file")
+	app.Window.InfoBar.Withdraw(configReloadMessageID)
+
+	app.Config = config
+	app.populating = true
+	app.PopulateFromConfig()
+	app.populating = false
+	app.PopulateProfiles()
+	if app.Client != nil {
+		app.PopulateGroups()
+	}
+
+	if len(problems) > 0 {
+		app.ReportConfigProblems(problems)
+		return
+	}
+	app.Window.InfoBar.DisplayMessage("Reloaded config file",
+		gtk.MESSAGE_INFO)
+}
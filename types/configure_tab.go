@@ -1,11 +1,11 @@
 package types
 
 import (
+	"context"
 	"github.com/adamdb5/opennord/pb"
 	"github.com/gotk3/gotk3/gtk"
-	"log"
+	"main/daemon"
 	"main/util"
-	"strings"
 )
 
 type ConfigureTab struct {
@@ -23,10 +23,14 @@ type ConfigureTab struct {
 	ProtocolComboText      *gtk.ComboBoxText
 	TechnologyComboText    *gtk.ComboBoxText
 	SaveButton             *gtk.Button
+	ExportButton           *gtk.Button
+	ImportButton           *gtk.Button
+
+	locks settingLocks
 }
 
 func BuildConfigureTab(builder *gtk.Builder) *ConfigureTab {
-	return &ConfigureTab{
+	configureTab := &ConfigureTab{
 		AutoConnectSwitch: util.BuilderGetSwitch(builder,
 			"configure_autoconnect_switch"),
 		AutoConnectServerEntry: util.BuilderGetEntry(builder,
@@ -52,39 +56,76 @@ func BuildConfigureTab(builder *gtk.Builder) *ConfigureTab {
 		TechnologyComboText: util.BuilderGetComboBoxText(builder,
 			"configure_technology_combo_text"),
 		SaveButton: util.BuilderGetButton(builder, "configure_save_button"),
+		ExportButton: util.BuilderGetButton(builder,
+			"configure_export_button"),
+		ImportButton: util.BuilderGetButton(builder,
+			"configure_import_button"),
 	}
+
+	locks := &configureTab.locks
+	locks.add("AutoConnectEnabled", configureTab.AutoConnectSwitch)
+	locks.add("AutoConnectServerTag", configureTab.AutoConnectServerEntry)
+	locks.add("CyberSecEnabled", configureTab.CyberSecSwitch)
+	locks.add("DNSServers", configureTab.DNSEntry, configureTab.DnsButton)
+	locks.add("FirewallEnabled", configureTab.FirewallSwitch)
+	locks.add("IPv6Enabled", configureTab.IPv6Switch)
+	locks.add("KillSwitchEnabled", configureTab.KillSwitchSwitch)
+	locks.add("NotificationsEnabled", configureTab.NotifySwitch)
+	locks.add("ObfuscationEnabled", configureTab.ObfuscationSwitch)
+	locks.add("Protocol", configureTab.ProtocolComboText)
+	locks.add("Technology", configureTab.TechnologyComboText)
+
+	return configureTab
+}
+
+// UpdateControls disables the settings which affect the tunnel while the
+// connection state is changing. Settings locked by the system policy remain
+// disabled.
+func (configureTab *ConfigureTab) UpdateControls(
+	state daemon.ConnectionState) {
+	idle := !state.Transitioning()
+	locks := configureTab.locks
+	configureTab.AutoConnectButton.SetSensitive(idle)
+	configureTab.DnsButton.SetSensitive(idle && !locks.Locked("DNSServers"))
+	configureTab.ObfuscationSwitch.SetSensitive(idle &&
+		!locks.Locked("ObfuscationEnabled"))
+	configureTab.ProtocolComboText.SetSensitive(idle &&
+		!locks.Locked("Protocol"))
+	configureTab.TechnologyComboText.SetSensitive(idle &&
+		!locks.Locked("Technology"))
 }
 
 func AutoConnectClicked(app *Application) error {
+	if app.refuseLocked("AutoConnectEnabled", "Auto-connect") ||
+		app.refuseLocked("AutoConnectServerTag", "The auto-connect server") {
+		return errSettingLocked
+	}
+
 	configureTab := app.Window.ConfigureTab
 	serverTag, _ := configureTab.AutoConnectServerEntry.GetText()
-	protocol := pb.ProtocolEnum_UDP
 	dnsText, _ := configureTab.DNSEntry.GetText()
-	dns := strings.Split(dnsText, ",")
-
-	if configureTab.ProtocolComboText.GetActiveText() == "TCP" {
-		protocol = pb.ProtocolEnum_TCP
-	}
 
-	_, err := app.Client.SetAutoConnect(&pb.SetAutoConnectRequest{
-		ServerTag:   serverTag,
-		Protocol:    protocol,
+	req := &pb.SetAutoConnectRequest{
+		ServerTag: serverTag,
+		Protocol: ParseProtocol(
+			configureTab.ProtocolComboText.GetActiveText()),
 		CyberSec:    configureTab.CyberSecSwitch.GetActive(),
 		Obfuscate:   configureTab.ObfuscationSwitch.GetActive(),
 		AutoConnect: configureTab.AutoConnectSwitch.GetActive(),
-		Dns:         dns,
-		Whitelist:   nil,
-	})
+		Dns:         ParseDNS(dnsText),
+		Whitelist:   app.Config.WhiteList.Proto(app.Presets),
+	}
+	client := app.Client
 
-	if err != nil {
-		util.LogError("Unable to set Auto-connect configuration", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set Auto-connect configuration: "+
-			err.Error(), gtk.MESSAGE_ERROR)
+	app.RunOperation("Setting Auto-connect...", func(context.Context) error {
+		_, err := client.SetAutoConnect(req)
 		return err
-	}
+	}, func(err error) {
+		if err != nil {
+			app.DisplayError("Unable to set Auto-connect configuration",
+				err, func() { _ = AutoConnectClicked(app) })
+		}
+	})
 
 	return nil
 }
@@ -93,7 +134,7 @@ func ConfigureSaveClicked(app *Application) error {
 	configureTab := app.Window.ConfigureTab
 	serverTag, _ := configureTab.AutoConnectServerEntry.GetText()
 	dnsText, _ := configureTab.DNSEntry.GetText()
-	dns := strings.Split(dnsText, ",")
+	dns := ParseDNS(dnsText)
 
 	app.Config.AutoConnectEnabled = configureTab.AutoConnectSwitch.GetActive()
 	app.Config.AutoConnectServerTag = serverTag
@@ -106,199 +147,210 @@ func ConfigureSaveClicked(app *Application) error {
 	app.Config.ObfuscationEnabled = configureTab.ObfuscationSwitch.GetActive()
 	app.Config.Protocol = configureTab.ProtocolComboText.GetActiveText()
 	app.Config.Technology = configureTab.TechnologyComboText.GetActiveText()
+	app.Config.SettingsChanged("AutoConnectEnabled", "AutoConnectServerTag",
+		"DNSServers", "CyberSecEnabled", "FirewallEnabled", "IPv6Enabled",
+		"KillSwitchEnabled", "NotificationsEnabled", "ObfuscationEnabled",
+		"Protocol", "Technology")
 
-	return SaveConfig(app)
+	if err := SaveConfig(app); err != nil {
+		app.DisplaySaveError(err)
+		return err
+	}
+	return nil
 }
 
 func DNSButtonClicked(app *Application) error {
+	if app.refuseLocked("DNSServers", "DNS") {
+		return errSettingLocked
+	}
+
 	configureTab := app.Window.ConfigureTab
 	dnsText, _ := configureTab.DNSEntry.GetText()
-	dns := strings.Split(dnsText, ",")
-
-	err := app.Client.SetDns(&pb.SetDNSRequest{
-		Dns:      dns,
-		CyberSec: true,
+	dns := ParseDNS(dnsText)
+	client := app.Client
+
+	app.RunOperation("Setting DNS...", func(context.Context) error {
+		return client.SetDns(&pb.SetDNSRequest{
+			Dns:      dns,
+			CyberSec: true,
+		})
+	}, func(err error) {
+		if err != nil {
+			app.DisplayError("Unable to set DNS", err,
+				func() { _ = DNSButtonClicked(app) })
+			return
+		}
+
+		app.Config.DNSServers = dns
+		app.Config.SettingsChanged("DNSServers")
 	})
 
-	log.Printf("here")
-
-	if err != nil {
-		util.LogError("Unable to set DNS", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set DNS: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
-	}
-
 	return nil
 }
 
 func CyberSecSwitchToggled(app *Application) error {
-	err := app.Client.SetCyberSec(app.Window.ConfigureTab.CyberSecSwitch.
-		GetActive())
-
-	if err != nil {
-		util.LogError("Unable to set CyberSec", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set CyberSec: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
+	if app.refuseLocked("CyberSecEnabled", "CyberSec") {
+		return errSettingLocked
 	}
 
-	app.Config.CyberSecEnabled = app.Window.ConfigureTab.CyberSecSwitch.
-		GetActive()
+	enabled := app.Window.ConfigureTab.CyberSecSwitch.GetActive()
+	client := app.Client
+
+	runSetting(app, "CyberSec", func() error {
+		return client.SetCyberSec(enabled)
+	}, func() {
+		app.Config.CyberSecEnabled = enabled
+		app.Config.SettingsChanged("CyberSecEnabled")
+	})
 
 	return nil
 }
 
 func FirewallSwitchToggled(app *Application) error {
-	err := app.Client.SetFirewall(app.Window.ConfigureTab.FirewallSwitch.
-		GetActive())
-
-	if err != nil {
-		util.LogError("Unable to set Firewall", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set Firewall: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
+	if app.refuseLocked("FirewallEnabled", "Firewall") {
+		return errSettingLocked
 	}
 
-	app.Config.FirewallEnabled = app.Window.ConfigureTab.FirewallSwitch.
-		GetActive()
+	enabled := app.Window.ConfigureTab.FirewallSwitch.GetActive()
+	client := app.Client
+
+	runSetting(app, "Firewall", func() error {
+		return client.SetFirewall(enabled)
+	}, func() {
+		app.Config.FirewallEnabled = enabled
+		app.Config.SettingsChanged("FirewallEnabled")
+	})
 
 	return nil
 }
 
 func IPv6SwitchToggled(app *Application) error {
-	err := app.Client.SetIpv6(app.Window.ConfigureTab.IPv6Switch.
-		GetActive())
-
-	if err != nil {
-		util.LogError("Unable to set IPv6", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set IPv6: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
+	if app.refuseLocked("IPv6Enabled", "IPv6") {
+		return errSettingLocked
 	}
 
-	app.Config.IPv6Enabled = app.Window.ConfigureTab.IPv6Switch.
-		GetActive()
+	enabled := app.Window.ConfigureTab.IPv6Switch.GetActive()
+	client := app.Client
+
+	runSetting(app, "IPv6", func() error {
+		return client.SetIpv6(enabled)
+	}, func() {
+		app.Config.IPv6Enabled = enabled
+		app.Config.SettingsChanged("IPv6Enabled")
+	})
 
 	return nil
 }
 
 func KillSwitchSwitchToggled(app *Application) error {
-	err := app.Client.SetKillSwitch(app.Window.ConfigureTab.KillSwitchSwitch.
-		GetActive())
-
-	if err != nil {
-		util.LogError("Unable to set Kill Switch", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set Kill Switch: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
+	if app.refuseLocked("KillSwitchEnabled", "Kill Switch") {
+		return errSettingLocked
 	}
 
-	app.Config.KillSwitchEnabled = app.Window.ConfigureTab.KillSwitchSwitch.
-		GetActive()
+	enabled := app.Window.ConfigureTab.KillSwitchSwitch.GetActive()
+	client := app.Client
+
+	runSetting(app, "Kill Switch", func() error {
+		return client.SetKillSwitch(enabled)
+	}, func() {
+		app.Config.KillSwitchEnabled = enabled
+		app.Config.SettingsChanged("KillSwitchEnabled")
+	})
 
 	return nil
 }
 
 func NotificationsSwitchToggled(app *Application) error {
-	err := app.Client.SetNotify(app.Window.ConfigureTab.NotifySwitch.
-		GetActive())
-
-	if err != nil {
-		util.LogError("Unable to set Notifications", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set Notifications: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
+	if app.refuseLocked("NotificationsEnabled", "Notifications") {
+		return errSettingLocked
 	}
 
-	app.Config.NotificationsEnabled = app.Window.ConfigureTab.NotifySwitch.
-		GetActive()
+	enabled := app.Window.ConfigureTab.NotifySwitch.GetActive()
+	client := app.Client
+
+	runSetting(app, "Notifications", func() error {
+		return client.SetNotify(enabled)
+	}, func() {
+		app.Config.NotificationsEnabled = enabled
+		app.Config.SettingsChanged("NotificationsEnabled")
+	})
 
 	return nil
 }
 
 func ObfuscationSwitchToggled(app *Application) error {
-	err := app.Client.SetObfuscate(app.Window.ConfigureTab.ObfuscationSwitch.
-		GetActive())
-
-	if err != nil {
-		util.LogError("Unable to set Obfuscation", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set Obfuscation: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
+	if app.refuseLocked("ObfuscationEnabled", "Obfuscation") {
+		return errSettingLocked
 	}
 
-	app.Config.ObfuscationEnabled = app.Window.ConfigureTab.ObfuscationSwitch.
-		GetActive()
+	enabled := app.Window.ConfigureTab.ObfuscationSwitch.GetActive()
+	client := app.Client
+
+	runSetting(app, "Obfuscation", func() error {
+		return client.SetObfuscate(enabled)
+	}, func() {
+		app.Config.ObfuscationEnabled = enabled
+		app.Config.SettingsChanged("ObfuscationEnabled")
+		app.PopulateGroups()
+	})
 
 	return nil
 }
 
 func ProtocolComboTextChanged(app *Application) error {
-	configureTab := app.Window.ConfigureTab
-	protocol := pb.ProtocolEnum_UDP
-
-	if configureTab.ProtocolComboText.GetActiveText() == "TCP" {
-		protocol = pb.ProtocolEnum_TCP
+	if app.refuseLocked("Protocol", "Protocol") {
+		return errSettingLocked
 	}
 
-	err := app.Client.SetProtocol(protocol)
-	if err != nil {
-		util.LogError("Unable to set Protocol", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set Protocol: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
-	}
+	protocolText := app.Window.ConfigureTab.ProtocolComboText.GetActiveText()
+	protocol := ParseProtocol(protocolText)
+	client := app.Client
 
-	app.Config.Protocol = configureTab.ProtocolComboText.GetActiveText()
+	runSetting(app, "Protocol", func() error {
+		return client.SetProtocol(protocol)
+	}, func() {
+		app.Config.Protocol = protocolText
+		app.Config.SettingsChanged("Protocol")
+		app.PopulateGroups()
+	})
 
 	return nil
 }
 
 func TechnologyComboTextChanged(app *Application) error {
-	configureTab := app.Window.ConfigureTab
-	technology := pb.TechnologyEnum_OPENVPN
-
-	if configureTab.TechnologyComboText.GetActiveText() == "NORDLYNX" {
-		technology = pb.TechnologyEnum_NORDLYNX
+	if app.refuseLocked("Technology", "Technology") {
+		return errSettingLocked
 	}
 
-	err := app.Client.SetTechnology(technology)
-	if err != nil {
-		util.LogError("Unable to set Technology", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to set Technology: "+
-			err.Error(), gtk.MESSAGE_ERROR)
-		return err
-	}
+	technologyText := app.Window.ConfigureTab.TechnologyComboText.
+		GetActiveText()
+	technology := ParseTechnology(technologyText)
+	client := app.Client
 
-	app.Config.Technology = configureTab.TechnologyComboText.GetActiveText()
+	runSetting(app, "Technology", func() error {
+		return client.SetTechnology(technology)
+	}, func() {
+		app.Config.Technology = technologyText
+		app.Config.SettingsChanged("Technology")
+	})
 
 	return nil
 }
+
+// runSetting performs a settings RPC in the background. If the RPC succeeds,
+// applied is invoked on the GTK main loop, otherwise the error is displayed
+// in the info bar, offering to retry the RPC if appropriate.
+func runSetting(app *Application, name string, set func() error,
+	applied func()) {
+	app.RunOperation("Setting "+name+"...", func(context.Context) error {
+		return set()
+	}, func(err error) {
+		if err != nil {
+			app.DisplayError("Unable to set "+name, err,
+				func() { runSetting(app, name, set, applied) })
+			return
+		}
+
+		applied()
+	})
+}
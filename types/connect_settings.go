@@ -0,0 +1,143 @@
+package types
+
+import (
+	"github.com/adamdb5/opennord/pb"
+	"main/util"
+	"main/whitelist"
+	"strings"
+	"time"
+)
+
+// ConnectSettings are the settings sent to the daemon along with a connect
+// request, which also determine the groups available to connect to.
+type ConnectSettings struct {
+	Protocol  pb.ProtocolEnum
+	Obfuscate bool
+	CyberSec  bool
+	DNS       []string
+	WhiteList *pb.Whitelist
+}
+
+// ConnectSettings returns the connect settings saved in the config. Whitelist
+// presets are resolved using the given catalogue.
+func (config *Config) ConnectSettings(
+	presets *whitelist.Catalogue) ConnectSettings {
+	return ConnectSettings{
+		Protocol:  ParseProtocol(config.Protocol),
+		Obfuscate: config.ObfuscationEnabled,
+		CyberSec:  config.CyberSecEnabled,
+		DNS:       ParseDNS(strings.Join(config.DNSServers, ",")),
+		WhiteList: config.WhiteList.Proto(presets),
+	}
+}
+
+// ConnectRequest builds a request to connect to the server specified by the
+// given tag using these settings.
+func (settings ConnectSettings) ConnectRequest(tag string) *pb.ConnectRequest {
+	return &pb.ConnectRequest{
+		ServerTag: tag,
+		Protocol:  settings.Protocol,
+		Obfuscate: settings.Obfuscate,
+		CyberSec:  settings.CyberSec,
+		Dns:       settings.DNS,
+		WhiteList: settings.WhiteList,
+	}
+}
+
+// GroupsRequest builds a request for the groups which can be connected to
+// using these settings.
+func (settings ConnectSettings) GroupsRequest() *pb.GroupsRequest {
+	return &pb.GroupsRequest{
+		Protocol:  settings.Protocol,
+		Obfuscate: settings.Obfuscate,
+	}
+}
+
+// Proto converts the whitelist into the form expected by the daemon. The
+// subnets and ports of the enabled presets are looked up in the given
+// catalogue and included, as are the temporary entries which have not yet
+// expired. Subnets are normalised and port ranges are expanded
+// into individual ports. A nil whitelist is converted to nil.
+func (whiteList *WhiteList) Proto(presets *whitelist.Catalogue) *pb.Whitelist {
+	if whiteList == nil {
+		return nil
+	}
+	whiteList = whiteList.Resolve(presets, time.Now())
+
+	ports := &pb.Ports{
+		Udp: whitelist.ExpandPorts(whiteList.UDPPorts),
+		Tcp: whitelist.ExpandPorts(whiteList.TCPPorts),
+	}
+
+	// The daemon is always sent the normalised subnets, even if the user has
+	// not yet simplified the whitelist.
+	subnets, _ := whitelist.NormaliseSubnets(whiteList.Subnets)
+
+	return &pb.Whitelist{
+		Ports:   ports,
+		Subnets: subnets,
+	}
+}
+
+// Resolve returns a copy of the whitelist which also contains the subnets and
+// ports of its enabled presets, and its temporary entries which have not
+// expired by now. Presets which are not in the catalogue are skipped.
+// Hostnames are replaced by the subnets of their resolved addresses.
+func (whiteList *WhiteList) Resolve(presets *whitelist.Catalogue,
+	now time.Time) *WhiteList {
+	combined := &WhiteList{
+		Subnets:   append([]string(nil), whiteList.Subnets...),
+		Hostnames: append([]string(nil), whiteList.Hostnames...),
+		UDPPorts:  append([]whitelist.PortRange(nil), whiteList.UDPPorts...),
+		TCPPorts:  append([]whitelist.PortRange(nil), whiteList.TCPPorts...),
+	}
+
+	for _, name := range whiteList.Presets {
+		preset, ok := presets.Lookup(name)
+		if !ok {
+			util.LogWarning("Unknown whitelist preset "+name, nil)
+			continue
+		}
+		combined.Subnets = append(combined.Subnets, preset.Subnets...)
+		combined.UDPPorts = append(combined.UDPPorts, preset.UDPPorts...)
+		combined.TCPPorts = append(combined.TCPPorts, preset.TCPPorts...)
+	}
+
+	for _, entry := range whiteList.Temporary {
+		if entry.Expired(now) {
+			continue
+		}
+		combined.add(entry.Kind, entry.Value)
+	}
+
+	// Hostnames are whitelisted by their most recently resolved addresses
+	for _, hostname := range combined.Hostnames {
+		combined.Subnets = append(combined.Subnets,
+			whiteList.ResolvedHosts[hostname]...)
+	}
+	combined.Hostnames = nil
+	return combined
+}
+
+// ParseProtocol converts the name of a protocol, as listed by the daemon,
+// into a pb.ProtocolEnum. Unrecognised names are treated as UDP, which is the
+// daemon's default.
+func ParseProtocol(text string) pb.ProtocolEnum {
+	if strings.EqualFold(text, "TCP") {
+		return pb.ProtocolEnum_TCP
+	}
+	return pb.ProtocolEnum_UDP
+}
+
+// ParseDNS splits a comma separated list of DNS servers, discarding any
+// empty entries. If there are no servers, nil is returned so that the daemon
+// uses its default servers.
+func ParseDNS(text string) []string {
+	var servers []string
+	for _, server := range strings.Split(text, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
@@ -1,8 +1,11 @@
 package types
 
 import (
+	"context"
 	"errors"
+	"github.com/adamdb5/opennord/pb"
 	"github.com/gotk3/gotk3/gtk"
+	"main/daemon"
 	"main/util"
 )
 
@@ -20,12 +23,31 @@ type ConnectTab struct {
 	ServerConnectButton   *gtk.Button
 	BestConnectButton     *gtk.Button
 	SaveButton            *gtk.Button
+	BusyBox               *gtk.Box
+	BusySpinner           *gtk.Spinner
+	BusyLabel             *gtk.Label
+	CancelButton          *gtk.Button
+
+	OverrideCheckButton       *gtk.CheckButton
+	OverrideGrid              *gtk.Grid
+	OverrideProtocolComboText *gtk.ComboBoxText
+	OverrideObfuscationSwitch *gtk.Switch
+	OverrideDNSEntry          *gtk.Entry
+
+	// initialisingOverrides is set while the override controls are being
+	// initialised from the saved settings.
+	initialisingOverrides bool
+
+	// operations contains the cancel functions of the running operations,
+	// keyed by the ID returned from BeginOperation.
+	operations    map[int]context.CancelFunc
+	nextOperation int
 }
 
 // BuildConnectTab constructs the GTKNotebook page for the 'Connect' tab from
 // the provided builder.
 func BuildConnectTab(builder *gtk.Builder) *ConnectTab {
-	return &ConnectTab{
+	connectTab := &ConnectTab{
 		StatusLabel: util.BuilderGetLabel(builder,
 			"connect_status_label"),
 		CountriesComboBoxText: util.BuilderGetComboBoxText(builder,
@@ -50,7 +72,102 @@ func BuildConnectTab(builder *gtk.Builder) *ConnectTab {
 			"connect_best_connect_button"),
 		SaveButton: util.BuilderGetButton(builder,
 			"connect_save_button"),
+		BusyBox: util.BuilderGetBox(builder,
+			"connect_busy_box"),
+		BusySpinner: util.BuilderGetSpinner(builder,
+			"connect_busy_spinner"),
+		BusyLabel: util.BuilderGetLabel(builder,
+			"connect_busy_label"),
+		CancelButton: util.BuilderGetButton(builder,
+			"connect_cancel_button"),
+		OverrideCheckButton: util.BuilderGetCheckButton(builder,
+			"connect_override_check_button"),
+		OverrideGrid: util.BuilderGetGrid(builder,
+			"connect_override_grid"),
+		OverrideProtocolComboText: util.BuilderGetComboBoxText(builder,
+			"connect_override_protocol_combo_text"),
+		OverrideObfuscationSwitch: util.BuilderGetSwitch(builder,
+			"connect_override_obfuscation_switch"),
+		OverrideDNSEntry: util.BuilderGetEntry(builder,
+			"connect_override_dns_entry"),
+		operations: map[int]context.CancelFunc{},
+	}
+
+	connectTab.CancelButton.Connect("clicked", connectTab.CancelOperations)
+
+	return connectTab
+}
+
+// BeginOperation shows the busy indicator with the given description. The
+// returned ID must be passed to EndOperation once the operation has finished.
+func (connectTab *ConnectTab) BeginOperation(description string,
+	cancel context.CancelFunc) int {
+	id := connectTab.nextOperation
+	connectTab.nextOperation++
+	connectTab.operations[id] = cancel
+
+	connectTab.BusyLabel.SetText(description)
+	connectTab.CancelButton.SetSensitive(true)
+	connectTab.BusySpinner.Start()
+	connectTab.BusyBox.Show()
+
+	return id
+}
+
+// EndOperation marks the operation with the given ID as finished. The busy
+// indicator is hidden once no operations remain.
+func (connectTab *ConnectTab) EndOperation(id int) {
+	delete(connectTab.operations, id)
+	if len(connectTab.operations) > 0 {
+		return
+	}
+
+	connectTab.BusySpinner.Stop()
+	connectTab.BusyBox.Hide()
+}
+
+// CancelOperations is invoked whenever the 'Cancel' button on the 'Connect'
+// tab is clicked. This function cancels all running operations.
+func (connectTab *ConnectTab) CancelOperations() {
+	for _, cancel := range connectTab.operations {
+		cancel()
 	}
+	connectTab.BusyLabel.SetText("Cancelling...")
+	connectTab.CancelButton.SetSensitive(false)
+}
+
+// UpdateControls updates the status label and enables / disables the buttons
+// depending on the connection state.
+func (connectTab *ConnectTab) UpdateControls(state daemon.ConnectionState) {
+	canConnect := state.CanConnect()
+	connectTab.StatusLabel.SetText(state.String())
+	connectTab.DisconnectButton.SetSensitive(state.CanDisconnect())
+	connectTab.CountryConnectButton.SetSensitive(canConnect)
+	connectTab.CityConnectButton.SetSensitive(canConnect)
+	connectTab.GroupConnectButton.SetSensitive(canConnect)
+	connectTab.ServerConnectButton.SetSensitive(canConnect)
+	connectTab.BestConnectButton.SetSensitive(canConnect)
+}
+
+// ApplyOverrides returns the given settings with the values from the
+// 'Connection Options' panel applied, if overriding is enabled. If no DNS
+// servers are entered, the servers in settings are kept.
+func (connectTab *ConnectTab) ApplyOverrides(
+	settings ConnectSettings) ConnectSettings {
+	if !connectTab.OverrideCheckButton.GetActive() {
+		return settings
+	}
+
+	settings.Protocol = ParseProtocol(
+		connectTab.OverrideProtocolComboText.GetActiveText())
+	settings.Obfuscate = connectTab.OverrideObfuscationSwitch.GetActive()
+
+	dnsText, _ := connectTab.OverrideDNSEntry.GetText()
+	if dns := ParseDNS(dnsText); dns != nil {
+		settings.DNS = dns
+	}
+
+	return settings
 }
 
 func ConnectSaveClicked(app *Application) error {
@@ -61,49 +178,83 @@ func ConnectSaveClicked(app *Application) error {
 		Group:   app.Window.ConnectTab.GroupsComboBoxText.GetActiveText(),
 		Server:  serverText,
 	}
-	return SaveConfig(app)
+	app.Config.SettingsChanged("Connect")
+	if err := SaveConfig(app); err != nil {
+		app.DisplaySaveError(err)
+		return err
+	}
+	return nil
+}
+
+// ConnectOverrideToggled is invoked whenever the 'Override saved settings'
+// check button on the 'Connect' tab is toggled. When enabled, the override
+// controls are initialised from the saved settings. The groups are then
+// refreshed to match the effective settings.
+func ConnectOverrideToggled(app *Application) {
+	connectTab := app.Window.ConnectTab
+	enabled := connectTab.OverrideCheckButton.GetActive()
+	connectTab.OverrideGrid.SetSensitive(enabled)
+
+	if enabled {
+		settings := app.Config.ConnectSettings(app.Presets)
+		connectTab.initialisingOverrides = true
+		if settings.Protocol == pb.ProtocolEnum_TCP {
+			connectTab.OverrideProtocolComboText.SetActive(1)
+		} else {
+			connectTab.OverrideProtocolComboText.SetActive(0)
+		}
+		connectTab.OverrideObfuscationSwitch.SetActive(settings.Obfuscate)
+		connectTab.initialisingOverrides = false
+	}
+
+	app.PopulateGroups()
+}
+
+// ConnectOverrideChanged is invoked whenever the protocol or obfuscation
+// override on the 'Connect' tab is changed. This function refreshes the groups
+// available with the new settings.
+func ConnectOverrideChanged(app *Application) {
+	if app.Window.ConnectTab.initialisingOverrides {
+		return
+	}
+
+	app.PopulateGroups()
 }
 
 // DisconnectClicked is invoked whenever the 'Disconnect' button on the
 // 'Connect' tab is clicked. This function will disconnect the user from their
 // current VPN session.
 func DisconnectClicked(app *Application) error {
-	status, err := app.Client.Status()
 	infoBar := app.Window.InfoBar
+	var status *pb.StatusResponse
+	client := app.Client
 
-	if err != nil {
-		util.LogError("Lost connection to NordVPN daemon", err)
-		infoBar.Button.SetLabel("Reconnect")
-		infoBar.Button.Connect("clicked", app.ConnectToDaemon)
-		infoBar.DisplayMessage("Lost connection to NordVPN daemon",
-			gtk.MESSAGE_ERROR)
+	app.Connection.BeginDisconnect()
+	app.RunOperation("Disconnecting...", func(context.Context) error {
+		var err error
+		status, err = daemon.Disconnect(client)
 		return err
-	}
+	}, func(err error) {
+		// The user probably used some other tool to disconnect
+		if errors.Is(err, daemon.ErrNotConnected) {
+			app.Connection.EndDisconnect(nil)
+			infoBar.DisplayMessage("You are not connected to a VPN",
+				gtk.MESSAGE_ERROR)
+			return
+		}
 
-	// The user probably used some other tool to disconnect
-	if status.GetState() == "Disconnected" {
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("You are not connected to a VPN",
-			gtk.MESSAGE_ERROR)
-		return nil
-	}
+		app.Connection.EndDisconnect(err)
+		if err != nil {
+			app.DisplayError("Could not disconnect from VPN", err,
+				func() { _ = DisconnectClicked(app) })
+			return
+		}
 
-	err = app.Client.Disconnect()
-	if err != nil {
-		util.LogError("Could not disconnect from VPN", err)
-		infoBar.Button.SetLabel("Reconnect")
-		infoBar.Button.Connect("clicked", app.ConnectToDaemon)
-		infoBar.DisplayMessage("Could not disconnect from VPN",
-			gtk.MESSAGE_ERROR)
-		return err
-	}
+		infoBar.DisplayMessage("Successfully disconnected from "+status.
+			GetHostname(), gtk.MESSAGE_INFO)
+		app.StatusPoller.Refresh()
+	})
 
-	infoBar.Button.SetLabel("Dismiss")
-	infoBar.Button.Connect("clicked", infoBar.HideMessage)
-	infoBar.DisplayMessage("Successfully disconnected from "+status.
-		GetHostname(), gtk.MESSAGE_INFO)
-	_ = app.UpdateConnectionStatus()
 	return nil
 }
 
@@ -111,7 +262,12 @@ func DisconnectClicked(app *Application) error {
 // combo box on the 'Connect' tab. This function updates the cities combo box
 // with the relevant cities.
 func CountrySelected(app *Application) {
-	_ = app.PopulateCities()
+	// The selection is cleared while the countries are being repopulated
+	if app.Window.ConnectTab.CountriesComboBoxText.GetActiveText() == "" {
+		return
+	}
+
+	app.PopulateCities()
 }
 
 // ConnectToCountry is invoked whenever the 'Connect to Country' button on the
@@ -146,8 +302,6 @@ func ConnectToServer(app *Application) error {
 	if len(text) == 0 {
 		util.LogError("No server specified", nil)
 		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
 		infoBar.DisplayMessage("No server specified", gtk.MESSAGE_ERROR)
 		return errors.New("no server specified")
 	}
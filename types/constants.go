@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 const (
 	AppId          = "net.adambruce.nordvpn-gtk"
 	AppName        = "NordVPN GTK"
@@ -10,4 +12,56 @@ const (
 	AppLicense     = "<a href=\"https://github.com/adamdb5/nordvpn-gtk/blob/main/LICENSE\">MIT License</a>"
 	ConfigDir      = "nordvpn-gtk"
 	ConfigFile     = "nordvpn-gtk.conf"
+	PresetsFile    = "presets.json"
+	PolicyFile     = "policy.json"
+	NordAccountURL = "https://my.nordaccount.com/"
+)
+
+// StatusPollInterval is the interval at which the connection status is
+// retrieved from the daemon.
+const StatusPollInterval = 1 * time.Second
+
+// InfoMessageTimeout is the amount of time for which info messages are
+// displayed in the info bar before being dismissed automatically.
+const InfoMessageTimeout = 5 * time.Second
+
+// MaxMessageHistory is the maximum number of info bar messages retained on the
+// 'Messages' tab.
+const MaxMessageHistory = 200
+
+// ReconnectInitialDelay and ReconnectMaxDelay bound the delay between attempts
+// to reconnect to the daemon once it has become unreachable.
+const (
+	ReconnectInitialDelay = 2 * time.Second
+	ReconnectMaxDelay     = 60 * time.Second
+)
+
+// WhitelistExpiryInterval is the interval at which temporary whitelist
+// entries are checked for expiry.
+const WhitelistExpiryInterval = 1 * time.Second
+
+// HostnameResolveInterval is the interval at which whitelisted hostnames are
+// resolved again, and HostnameResolveTimeout bounds each resolution.
+const (
+	HostnameResolveInterval = 5 * time.Minute
+	HostnameResolveTimeout  = 10 * time.Second
 )
+
+// ConfigBackups is the number of previous versions of the config file which
+// are kept when it is saved.
+const ConfigBackups = 5
+
+// ConfigReloadDelay is the amount of time for which the config file must be
+// left unchanged by other programs before it is reloaded.
+const ConfigReloadDelay = 500 * time.Millisecond
+
+// SystemConfigDir contains the system-wide defaults, in *.conf files, and the
+// policy enforced for every user, in PolicyFile.
+const SystemConfigDir = "/etc/xdg/nordvpn-gtk"
+
+// LockedTooltip is the tooltip of the controls for settings which are locked
+// by the system policy.
+const LockedTooltip = "Managed by your organisation"
+
+// BundleFile is the name suggested for exported configuration bundles.
+const BundleFile = "nordvpn-gtk-bundle.json"
@@ -0,0 +1,58 @@
+package types
+
+import (
+	"context"
+	"github.com/adamdb5/opennord"
+	"github.com/adamdb5/opennord/pb"
+	"main/daemon"
+)
+
+// DaemonClient is the set of NordVPN daemon RPCs used by the application,
+// along with Close to release the connection to the daemon. It is implemented
+// by daemon.Client, which can talk to the system daemon or to a daemon on any
+// other socket (such as the fake provided by the daemontest package).
+type DaemonClient interface {
+	AccountInfo() (*pb.AccountResponse, error)
+	Cities(country string) (*pb.CitiesResponse, error)
+	Close() error
+	Connect(ctx context.Context, req *pb.ConnectRequest) (
+		pb.Daemon_ConnectClient, error)
+	Countries() (*pb.CountriesResponse, error)
+	Disconnect() error
+	FrontendCountries() (*pb.FrontendCountriesResponse, error)
+	Groups(req *pb.GroupsRequest) (*pb.GroupsResponse, error)
+	IsLoggedIn() (*pb.IsLoggedInResponse, error)
+	Login(req *pb.LoginRequest) error
+	LoginOAuth2() (*pb.LoginOAuth2Response, error)
+	Logout() error
+	Plans() (*pb.PlansResponse, error)
+	Ping() error
+	RateConnection(req *pb.RateConnectionRequest) error
+	SetAutoConnect(req *pb.SetAutoConnectRequest) (*pb.Payload, error)
+	SetCyberSec(enabled bool) error
+	SetDefaults() error
+	SetDns(req *pb.SetDNSRequest) error
+	SetFirewall(enabled bool) error
+	SetIpv6(enabled bool) error
+	SetKillSwitch(enabled bool) error
+	SetNotify(enabled bool) error
+	SetObfuscate(enabled bool) error
+	SetProtocol(protocol pb.ProtocolEnum) error
+	SetTechnology(technology pb.TechnologyEnum) error
+	SetWhitelist(req *pb.SetWhitelistRequest) error
+	Settings() (*pb.SettingsResponse, error)
+	SettingsProtocols() (*pb.ProtocolsResponse, error)
+	SettingsTechnologies() (*pb.TechnologyResponse, error)
+	Status() (*pb.StatusResponse, error)
+}
+
+var _ DaemonClient = (*daemon.Client)(nil)
+
+// DialSystemDaemon creates a client for the system NordVPN daemon.
+func DialSystemDaemon() (DaemonClient, error) {
+	client, err := daemon.NewClient(opennord.SocketPath)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+	"main/daemon/daemonerr"
+	"main/util"
+	"os/exec"
+)
+
+// DisplayError logs err and displays it in the info bar, prefixed with the
+// given summary. The info bar's button offers the recovery action suggested
+// for the error. If the suggested action is to retry the operation, retry is
+// invoked when the button is clicked; if retry is nil, the user is instead
+// offered to reconnect to the daemon. If the daemon is unreachable, the daemon
+// supervisor is started instead of displaying the error.
+func (app *Application) DisplayError(summary string, err error,
+	retry func()) {
+	util.LogError(summary, err)
+
+	// The supervisor reports its progress in the info bar until the daemon
+	// can be reached again.
+	if daemonerr.KindOf(err) == daemonerr.Unreachable {
+		app.Supervisor.Start()
+		return
+	}
+
+	action := daemonerr.ActionOf(err)
+	if action == daemonerr.ActionRetry && retry == nil {
+		action = daemonerr.ActionReconnect
+	}
+
+	app.Window.InfoBar.Post(Message{
+		Text:        summary + ": " + daemonerr.UserMessage(err),
+		Type:        gtk.MESSAGE_ERROR,
+		ActionLabel: action.Label(),
+		Action:      func() { app.Recover(action, retry) },
+	})
+}
+
+// Recover performs the given recovery action.
+func (app *Application) Recover(action daemonerr.Action, retry func()) {
+	switch action {
+	case daemonerr.ActionReconnect:
+		app.Supervisor.Reconnect()
+	case daemonerr.ActionRetry:
+		retry()
+	case daemonerr.ActionLogIn:
+		app.Window.ShowPage(app.Window.AccountTab.Grid)
+	case daemonerr.ActionRenew:
+		err := exec.Command("xdg-open", NordAccountURL).Start()
+		if err != nil {
+			util.LogError("Unable to open URL", err)
+			app.Window.InfoBar.DisplayMessage("Unable to open URL",
+				gtk.MESSAGE_ERROR)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package types
+
+import (
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"main/daemon"
+	"main/daemon/daemonerr"
+	"main/util"
+	"strconv"
+	"time"
+)
+
+// reconnectMessageID identifies the info bar message describing the progress
+// of the supervisor.
+const reconnectMessageID = "daemon-reconnect"
+
+// DaemonSupervisor re-establishes the connection to the daemon once it has
+// become unreachable. Attempts are retried with capped exponential backoff,
+// and a countdown to the next attempt is displayed in the info bar. All
+// methods must be called on the GTK main loop.
+type DaemonSupervisor struct {
+	app     *Application
+	backoff *daemon.Backoff
+
+	active     bool
+	dialing    bool
+	retryAt    time.Time
+	generation uint64
+}
+
+// NewDaemonSupervisor creates a supervisor which reconnects the given
+// application to the daemon.
+func NewDaemonSupervisor(app *Application) *DaemonSupervisor {
+	return &DaemonSupervisor{
+		app:     app,
+		backoff: daemon.NewBackoff(ReconnectInitialDelay, ReconnectMaxDelay),
+	}
+}
+
+// Start begins reconnecting to the daemon after the next backoff delay.
+// Calling Start while the supervisor is already reconnecting has no effect.
+func (supervisor *DaemonSupervisor) Start() {
+	if supervisor.active {
+		return
+	}
+
+	util.LogInfo("Reconnecting to NordVPN daemon")
+	supervisor.active = true
+	supervisor.schedule()
+}
+
+// Reconnect attempts to reconnect to the daemon immediately.
+func (supervisor *DaemonSupervisor) Reconnect() {
+	if supervisor.dialing {
+		return
+	}
+
+	supervisor.active = true
+	supervisor.attempt()
+}
+
+// Stop abandons any further attempts to reconnect to the daemon.
+func (supervisor *DaemonSupervisor) Stop() {
+	supervisor.active = false
+	supervisor.generation++
+	supervisor.app.Window.InfoBar.Withdraw(reconnectMessageID)
+}
+
+// Active reports whether the supervisor is reconnecting to the daemon.
+func (supervisor *DaemonSupervisor) Active() bool {
+	return supervisor.active
+}
+
+// schedule waits for the next backoff delay before attempting to reconnect,
+// updating the countdown in the info bar every second.
+func (supervisor *DaemonSupervisor) schedule() {
+	supervisor.generation++
+	generation := supervisor.generation
+	supervisor.retryAt = time.Now().Add(supervisor.backoff.Next())
+	supervisor.postCountdown()
+
+	glib.TimeoutAdd(uint(time.Second/time.Millisecond), func() bool {
+		if supervisor.generation != generation {
+			return false
+		}
+
+		if time.Until(supervisor.retryAt) <= 0 {
+			supervisor.attempt()
+			return false
+		}
+
+		supervisor.postCountdown()
+		return true
+	})
+}
+
+// attempt dials the daemon in the background. If the daemon is still
+// unreachable, the next attempt is scheduled.
+func (supervisor *DaemonSupervisor) attempt() {
+	supervisor.generation++
+	supervisor.dialing = true
+	generation := supervisor.generation
+	app := supervisor.app
+
+	app.Window.InfoBar.Post(Message{
+		ID:   reconnectMessageID,
+		Text: "Reconnecting to NordVPN daemon...",
+		Type: gtk.MESSAGE_WARNING,
+	})
+
+	var client DaemonClient
+	RunInBackground(func() error {
+		var err error
+		client, err = app.DialDaemon()
+		return err
+	}, func(err error) {
+		supervisor.dialing = false
+
+		// The supervisor was stopped while dialing
+		if supervisor.generation != generation {
+			if err == nil {
+				_ = client.Close()
+			}
+			return
+		}
+
+		if err == nil {
+			supervisor.active = false
+			supervisor.backoff.Reset()
+			app.Window.InfoBar.Withdraw(reconnectMessageID)
+			util.LogInfo("Reconnected to NordVPN daemon")
+			app.AttachClient(client)
+			app.Window.InfoBar.DisplayMessage(
+				"Reconnected to NordVPN daemon", gtk.MESSAGE_INFO)
+			return
+		}
+
+		switch daemonerr.KindOf(err) {
+		case daemonerr.Unreachable, daemonerr.Timeout:
+			util.LogError("Could not reconnect to NordVPN daemon", err)
+			supervisor.schedule()
+		default:
+			// Waiting will not resolve other failures, such as the user not
+			// having permission to access the socket.
+			supervisor.Stop()
+			app.DisplayError("Could not reconnect to NordVPN daemon", err,
+				supervisor.Reconnect)
+		}
+	})
+}
+
+// postCountdown displays the time remaining until the next attempt.
+func (supervisor *DaemonSupervisor) postCountdown() {
+	remaining := time.Until(supervisor.retryAt).Round(time.Second)
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+
+	supervisor.app.Window.InfoBar.Post(Message{
+		ID: reconnectMessageID,
+		Text: "Lost connection to NordVPN daemon. Reconnecting in " +
+			strconv.Itoa(int(remaining/time.Second)) + "s...",
+		Type:        gtk.MESSAGE_WARNING,
+		ActionLabel: "Reconnect Now",
+		Action:      supervisor.Reconnect,
+	})
+}
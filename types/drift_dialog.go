@@ -0,0 +1,189 @@
+package types
+
+import (
+	"context"
+	"github.com/adamdb5/opennord/pb"
+	"github.com/gotk3/gotk3/gtk"
+	"main/util"
+	"strconv"
+	"strings"
+)
+
+// driftMessageID identifies the info bar message offering to review the
+// settings which differ between the daemon and the config.
+const driftMessageID = "settings-drift"
+
+// DriftDialog contains the GTK components for the dialog which lists the
+// settings whose values differ between the daemon and the config.
+type DriftDialog struct {
+	Dialog  *gtk.Dialog
+	ListBox *gtk.ListBox
+}
+
+// BuildDriftDialog constructs the settings drift dialog from the provided
+// builder.
+func BuildDriftDialog(builder *gtk.Builder) *DriftDialog {
+	return &DriftDialog{
+		Dialog:  util.BuilderGetDialog(builder, "drift_dialog"),
+		ListBox: util.BuilderGetListBox(builder, "drift_list_box"),
+	}
+}
+
+// Run displays the given drifts, and waits for the user to choose whether to
+// keep the daemon's value or the saved value of each setting. If the user
+// applies their choices, the returned slice reports whether the daemon's
+// value was chosen for the corresponding drift. Otherwise, ok is false. The
+// saved value must be kept for settings locked by the system policy in
+// config.
+func (driftDialog *DriftDialog) Run(drifts []SettingDrift, config *Config) (
+	adopt []bool, ok bool) {
+	clearListBox(driftDialog.ListBox)
+
+	choices := make([]*gtk.ComboBoxText, len(drifts))
+	for i, drift := range drifts {
+		label, _ := gtk.LabelNew(drift.Name)
+		label.SetXAlign(0)
+		choice, _ := gtk.ComboBoxTextNew()
+		choice.AppendText("Keep daemon value (" + drift.Daemon + ")")
+		choice.AppendText("Keep saved value (" + drift.Saved + ")")
+		choice.SetActive(0)
+		if config.Locked(drift.Field) {
+			choice.SetActive(1)
+			choice.SetSensitive(false)
+			choice.SetTooltipText(LockedTooltip)
+		}
+		choices[i] = choice
+
+		box, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+		box.PackStart(label, true, true, 0)
+		box.PackEnd(choice, false, false, 0)
+		row, _ := gtk.ListBoxRowNew()
+		row.Add(box)
+		driftDialog.ListBox.Add(row)
+		row.ShowAll()
+	}
+
+	response := driftDialog.Dialog.Run()
+	driftDialog.Dialog.Hide()
+	if response != gtk.RESPONSE_OK {
+		return nil, false
+	}
+
+	adopt = make([]bool, len(drifts))
+	for i, choice := range choices {
+		adopt[i] = choice.GetActive() == 0
+	}
+	return adopt, true
+}
+
+// CheckSettingsDrift retrieves the daemon's settings in the background and
+// compares them with the saved settings. If any of them differ, the info bar
+// offers to review the differences.
+func (app *Application) CheckSettingsDrift() {
+	var settings *pb.SettingsResponse
+	client := app.Client
+
+	RunInBackground(func() error {
+		var err error
+		settings, err = client.Settings()
+		return err
+	}, func(err error) {
+		if err != nil {
+			app.DisplayError("Unable to retrieve NordVPN settings", err,
+				app.CheckSettingsDrift)
+			return
+		}
+
+		drifts := CompareSettings(settings.GetSettings(), app.Config,
+			app.Presets)
+		if len(drifts) == 0 {
+			app.Window.InfoBar.Withdraw(driftMessageID)
+			return
+		}
+
+		for _, drift := range drifts {
+			util.LogInfo("Setting differs from saved config: " +
+				drift.String())
+		}
+		app.postSettingsDrift(drifts)
+	})
+}
+
+// ReconcileSettings asks the user whether to keep the daemon's value or the
+// saved value of each of the given settings. Adopted daemon values are saved
+// to the config, and saved values are sent to the daemon.
+func (app *Application) ReconcileSettings(drifts []SettingDrift) {
+	adopt, ok := app.Window.DriftDialog.Run(drifts, app.Config)
+	if !ok {
+		// Keep offering to review the differences until they are resolved
+		app.postSettingsDrift(drifts)
+		return
+	}
+
+	var pushes []SettingDrift
+	adopted := false
+	for i, drift := range drifts {
+		if adopt[i] {
+			drift.Adopt(app.Config)
+			adopted = true
+		} else {
+			pushes = append(pushes, drift)
+		}
+	}
+
+	if adopted {
+		app.populating = true
+		app.PopulateFromConfig()
+		app.populating = false
+
+		if err := SaveConfig(app); err != nil {
+			app.DisplaySaveError(err)
+		}
+	}
+
+	if len(pushes) == 0 {
+		return
+	}
+
+	var failed []string
+	var lastErr error
+	config := app.Config
+	client := app.Client
+	app.RunOperation("Applying saved settings...", func(context.Context) error {
+		for _, drift := range pushes {
+			if err := drift.Push(client, config); err != nil {
+				util.LogError("Unable to set "+drift.Name, err)
+				failed = append(failed, drift.Name)
+				lastErr = err
+			}
+		}
+		return nil
+	}, func(error) {
+		if lastErr != nil {
+			app.DisplayError("Unable to apply saved settings ("+
+				strings.Join(failed, ", ")+")", lastErr,
+				app.CheckSettingsDrift)
+			return
+		}
+
+		app.Window.InfoBar.DisplayMessage("Applied saved settings to NordVPN",
+			gtk.MESSAGE_INFO)
+	})
+}
+
+// postSettingsDrift posts the info bar message offering to review the given
+// drifts.
+func (app *Application) postSettingsDrift(drifts []SettingDrift) {
+	text := "1 setting differs"
+	if len(drifts) != 1 {
+		text = strconv.Itoa(len(drifts)) + " settings differ"
+	}
+
+	app.Window.InfoBar.Post(Message{
+		ID:          driftMessageID,
+		Text:        text + " between NordVPN and your saved configuration",
+		Type:        gtk.MESSAGE_WARNING,
+		ActionLabel: "Review",
+		Action:      func() { app.ReconcileSettings(drifts) },
+	})
+}
@@ -1,36 +1,289 @@
 package types
 
 import (
+	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 	"main/util"
+	"time"
 )
 
+// Message is a message which may be displayed in the info bar.
+type Message struct {
+	// ID optionally identifies the message, allowing it to be updated in
+	// place or withdrawn.
+	ID   string
+	Text string
+	Type gtk.MessageType
+	// ActionLabel is the label of the info bar's button while the message is
+	// displayed. If empty, the button is labelled "Dismiss".
+	ActionLabel string
+	// Action is invoked when the info bar's button is clicked, after the
+	// message has been dismissed. If nil, the button only dismisses the
+	// message.
+	Action func()
+	// Time is the time at which the message was posted.
+	Time time.Time
+}
+
 // InfoBar contains the GTK components for the GTKInfoBar that is displayed at
-// the top of the application window.
+// the top of the application window. Messages posted to the info bar are
+// queued by severity, and are displayed one at a time.
 type InfoBar struct {
 	InfoBar *gtk.InfoBar
 	Label   *gtk.Label
 	Button  *gtk.Button
+
+	current   *Message
+	displayed uint64
+	queue     []*Message
+	history   []Message
+	listeners []func(message Message)
 }
 
 // BuildInfoBar constructs the GTKInfoBar for the application.
 func BuildInfoBar(builder *gtk.Builder) *InfoBar {
-	return &InfoBar{
+	infoBar := &InfoBar{
 		InfoBar: util.BuilderGetInfoBar(builder, "info_bar"),
 		Label:   util.BuilderGetLabel(builder, "info_bar_label"),
 		Button:  util.BuilderGetButton(builder, "info_bar_button"),
 	}
+
+	// The button is only connected once, and performs the action of
+	// whichever message is currently displayed.
+	infoBar.Button.Connect("clicked", infoBar.buttonClicked)
+
+	return infoBar
+}
+
+// Post queues a message for display. If the message is more severe than the
+// message currently displayed, it is displayed immediately and the current
+// message is returned to the queue. Messages identical to one which is
+// already displayed or queued are discarded, and a message with the same ID
+// as a displayed or queued message replaces it in place.
+func (infoBar *InfoBar) Post(message Message) {
+	if existing := infoBar.find(message.ID); existing != nil {
+		message.Time = existing.Time
+		*existing = message
+		if existing == infoBar.current {
+			infoBar.render(existing)
+		}
+		return
+	}
+
+	if infoBar.pending(message) {
+		return
+	}
+
+	message.Time = time.Now()
+	infoBar.record(message)
+
+	switch {
+	case infoBar.current == nil:
+		infoBar.display(&message)
+	case severity(message.Type) > severity(infoBar.current.Type):
+		infoBar.enqueue(infoBar.current, true)
+		infoBar.display(&message)
+	default:
+		infoBar.enqueue(&message, false)
+	}
+}
+
+// DisplayMessage posts a message with the specified text and type, which can
+// only be dismissed.
+func (infoBar *InfoBar) DisplayMessage(text string,
+	messageType gtk.MessageType) {
+	infoBar.Post(Message{Text: text, Type: messageType})
+}
+
+// HideMessage dismisses the message currently displayed, and displays the
+// next queued message, if any.
+func (infoBar *InfoBar) HideMessage() {
+	infoBar.current = nil
+
+	if len(infoBar.queue) == 0 {
+		infoBar.InfoBar.Hide()
+		return
+	}
+
+	next := infoBar.queue[0]
+	infoBar.queue = infoBar.queue[1:]
+	infoBar.display(next)
+}
+
+// Withdraw removes the message with the given ID, whether it is displayed or
+// queued.
+func (infoBar *InfoBar) Withdraw(id string) {
+	if id == "" {
+		return
+	}
+
+	if infoBar.current != nil && infoBar.current.ID == id {
+		infoBar.HideMessage()
+		return
+	}
+
+	for i, queued := range infoBar.queue {
+		if queued.ID == id {
+			infoBar.queue = append(infoBar.queue[:i], infoBar.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clear dismisses the message currently displayed and discards all queued
+// messages.
+func (infoBar *InfoBar) Clear() {
+	infoBar.queue = nil
+	infoBar.HideMessage()
+}
+
+// History returns the messages posted during this session, oldest first.
+func (infoBar *InfoBar) History() []Message {
+	history := make([]Message, len(infoBar.history))
+	copy(history, infoBar.history)
+	return history
+}
+
+// ClearHistory discards the messages posted during this session.
+func (infoBar *InfoBar) ClearHistory() {
+	infoBar.history = nil
+}
+
+// OnMessage registers fn to be invoked whenever a message is added to the
+// history.
+func (infoBar *InfoBar) OnMessage(fn func(message Message)) {
+	infoBar.listeners = append(infoBar.listeners, fn)
 }
 
-// DisplayMessage displays the info bar with the specified text and type.
-func (infoBar InfoBar) DisplayMessage(text string, messageType gtk.MessageType) {
+// buttonClicked dismisses the current message and performs its action.
+func (infoBar *InfoBar) buttonClicked() {
+	message := infoBar.current
 	infoBar.HideMessage()
-	infoBar.Label.SetText(text)
-	infoBar.InfoBar.SetMessageType(messageType)
+
+	if message != nil && message.Action != nil {
+		message.Action()
+	}
+}
+
+// display shows the given message in the info bar. Info messages are
+// dismissed automatically after InfoMessageTimeout.
+func (infoBar *InfoBar) display(message *Message) {
+	infoBar.current = message
+	infoBar.displayed++
+	infoBar.render(message)
+
+	if expires(message.Type) {
+		displayed := infoBar.displayed
+		glib.TimeoutAdd(uint(InfoMessageTimeout/time.Millisecond),
+			func() bool {
+				// Only dismiss the message if it hasn't since been replaced
+				if infoBar.displayed == displayed {
+					infoBar.HideMessage()
+				}
+				return false
+			})
+	}
+}
+
+// render updates the info bar's widgets to show the given message.
+func (infoBar *InfoBar) render(message *Message) {
+	label := message.ActionLabel
+	if label == "" {
+		label = "Dismiss"
+	}
+
+	infoBar.Label.SetText(message.Text)
+	infoBar.Button.SetLabel(label)
+	infoBar.InfoBar.SetMessageType(message.Type)
 	infoBar.InfoBar.Show()
 }
 
-// HideMessage hides the info bar.
-func (infoBar InfoBar) HideMessage() {
-	infoBar.InfoBar.Hide()
+// enqueue inserts message into the queue after all messages of equal or
+// greater severity. If front is true, the message is instead inserted before
+// messages of equal severity.
+func (infoBar *InfoBar) enqueue(message *Message, front bool) {
+	i := 0
+	for ; i < len(infoBar.queue); i++ {
+		queued := severity(infoBar.queue[i].Type)
+		if queued < severity(message.Type) ||
+			(front && queued == severity(message.Type)) {
+			break
+		}
+	}
+
+	infoBar.queue = append(infoBar.queue, nil)
+	copy(infoBar.queue[i+1:], infoBar.queue[i:])
+	infoBar.queue[i] = message
+}
+
+// pending reports whether a message with the same text and type as message
+// is currently displayed or queued.
+func (infoBar *InfoBar) pending(message Message) bool {
+	same := func(other *Message) bool {
+		return other != nil && other.Text == message.Text &&
+			other.Type == message.Type
+	}
+
+	if same(infoBar.current) {
+		return true
+	}
+	for _, queued := range infoBar.queue {
+		if same(queued) {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the displayed or queued message with the given ID, or nil if
+// there is no such message.
+func (infoBar *InfoBar) find(id string) *Message {
+	if id == "" {
+		return nil
+	}
+
+	if infoBar.current != nil && infoBar.current.ID == id {
+		return infoBar.current
+	}
+	for _, queued := range infoBar.queue {
+		if queued.ID == id {
+			return queued
+		}
+	}
+	return nil
+}
+
+// record adds message to the history, discarding the oldest messages once
+// MaxMessageHistory is reached.
+func (infoBar *InfoBar) record(message Message) {
+	infoBar.history = append(infoBar.history, message)
+	if len(infoBar.history) > MaxMessageHistory {
+		infoBar.history = infoBar.history[len(infoBar.history)-
+			MaxMessageHistory:]
+	}
+
+	for _, listener := range infoBar.listeners {
+		listener(message)
+	}
+}
+
+// severity ranks message types, such that more severe messages are displayed
+// first.
+func severity(messageType gtk.MessageType) int {
+	switch messageType {
+	case gtk.MESSAGE_ERROR:
+		return 3
+	case gtk.MESSAGE_WARNING:
+		return 2
+	case gtk.MESSAGE_QUESTION:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// expires reports whether messages of the given type are dismissed
+// automatically.
+func expires(messageType gtk.MessageType) bool {
+	return messageType == gtk.MESSAGE_INFO || messageType == gtk.MESSAGE_OTHER
 }
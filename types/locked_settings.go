@@ -0,0 +1,129 @@
+package types
+
+import (
+	"errors"
+	"github.com/gotk3/gotk3/gtk"
+	"main/util"
+)
+
+// errSettingLocked is returned by the callbacks which refuse to change a
+// setting locked by the system policy.
+var errSettingLocked = errors.New("setting is managed by your organisation")
+
+// lockableControl is a control which is made insensitive while the setting it
+// changes is locked by the system policy.
+type lockableControl interface {
+	SetSensitive(sensitive bool)
+	GetTooltipText() (string, error)
+	SetTooltipText(text string)
+}
+
+// lockedControl associates a control with the config field it changes.
+type lockedControl struct {
+	field   string
+	control lockableControl
+	// tooltip is the control's own tooltip, which is restored when the field
+	// is unlocked.
+	tooltip string
+}
+
+// settingLocks tracks which of a tab's controls change settings locked by the
+// system policy.
+type settingLocks struct {
+	controls []lockedControl
+	locked   map[string]bool
+}
+
+// add registers the controls which change the given config field.
+func (locks *settingLocks) add(field string, controls ...lockableControl) {
+	for _, control := range controls {
+		tooltip, _ := control.GetTooltipText()
+		locks.controls = append(locks.controls, lockedControl{
+			field:   field,
+			control: control,
+			tooltip: tooltip,
+		})
+	}
+}
+
+// replace registers the controls which change the given config field in place
+// of those registered for it before, for controls which are recreated. The
+// controls are locked straight away if the field is locked.
+func (locks *settingLocks) replace(field string,
+	controls ...lockableControl) {
+	var kept []lockedControl
+	for _, locked := range locks.controls {
+		if locked.field != field {
+			kept = append(kept, locked)
+		}
+	}
+	locks.controls = kept
+	locks.add(field, controls...)
+
+	if !locks.locked[field] {
+		return
+	}
+	for _, control := range controls {
+		control.SetSensitive(false)
+		control.SetTooltipText(LockedTooltip)
+	}
+}
+
+// apply makes the controls for the fields locked in config insensitive,
+// explaining why in their tooltips. The other controls are made sensitive,
+// so the tab's UpdateControls must be invoked afterwards.
+func (locks *settingLocks) apply(config *Config) {
+	locks.locked = map[string]bool{}
+	for _, locked := range locks.controls {
+		if config.Locked(locked.field) {
+			locks.locked[locked.field] = true
+			locked.control.SetSensitive(false)
+			locked.control.SetTooltipText(LockedTooltip)
+			continue
+		}
+		locked.control.SetSensitive(true)
+		locked.control.SetTooltipText(locked.tooltip)
+	}
+}
+
+// Locked reports whether the controls for the given config field are locked.
+func (locks *settingLocks) Locked(field string) bool {
+	return locks.locked[field]
+}
+
+// ApplyLocks locks the controls on the 'Configure' and 'Whitelist' tabs for
+// the settings enforced by the system policy.
+func (app *Application) ApplyLocks() {
+	app.Window.ConfigureTab.locks.apply(app.Config)
+	app.Window.WhiteListTab.locks.apply(app.Config)
+	app.UpdateControls(app.Connection.State())
+}
+
+// refuseLocked reports whether the given config field is locked by the system
+// policy, in which case the user is told that the named setting cannot be
+// changed.
+func (app *Application) refuseLocked(field string, name string) bool {
+	if !app.Config.Locked(field) {
+		return false
+	}
+
+	util.LogWarning("Refused to change "+name, errSettingLocked)
+	app.Window.InfoBar.DisplayMessage(name+" is managed by your "+
+		"organisation and cannot be changed", gtk.MESSAGE_WARNING)
+	return true
+}
+
+// entryField returns the config field containing the whitelist entries of
+// the given kind.
+func entryField(kind string) string {
+	switch kind {
+	case EntryHostname:
+		return "WhiteList.Hostnames"
+	case EntryUDP:
+		return "WhiteList.UDPPorts"
+	case EntryTCP:
+		return "WhiteList.TCPPorts"
+	default:
+		return "WhiteList.Subnets"
+	}
+}
@@ -0,0 +1,55 @@
+package types
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+	"main/util"
+)
+
+// MessagesTab contains the GTK components for the 'Messages' GTKNotebook page,
+// which lists the messages displayed in the info bar during this session.
+type MessagesTab struct {
+	ListBox     *gtk.ListBox
+	ClearButton *gtk.Button
+}
+
+// BuildMessagesTab constructs the GTKNotebook page for the 'Messages' tab from
+// the provided builder.
+func BuildMessagesTab(builder *gtk.Builder) *MessagesTab {
+	return &MessagesTab{
+		ListBox: util.BuilderGetListBox(builder, "messages_list_box"),
+		ClearButton: util.BuilderGetButton(builder,
+			"messages_clear_button"),
+	}
+}
+
+// AddMessage adds a message to the top of the list.
+func (messagesTab *MessagesTab) AddMessage(message Message) {
+	label, _ := gtk.LabelNew(message.Time.Format("15:04:05") + "  " +
+		messageTypeName(message.Type) + ": " + message.Text)
+	label.SetLineWrap(true)
+	label.SetXAlign(0)
+	row, _ := gtk.ListBoxRowNew()
+	row.SetHAlign(gtk.ALIGN_START)
+	row.Add(label)
+	messagesTab.ListBox.Insert(row, 0)
+	row.ShowAll()
+}
+
+// Clear removes all messages from the list.
+func (messagesTab *MessagesTab) Clear() {
+	clearListBox(messagesTab.ListBox)
+}
+
+// messageTypeName returns a human-readable name for the message type.
+func messageTypeName(messageType gtk.MessageType) string {
+	switch messageType {
+	case gtk.MESSAGE_ERROR:
+		return "Error"
+	case gtk.MESSAGE_WARNING:
+		return "Warning"
+	case gtk.MESSAGE_QUESTION:
+		return "Question"
+	default:
+		return "Info"
+	}
+}
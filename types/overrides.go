@@ -0,0 +1,273 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"main/util"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The environment variables which may be used instead of the corresponding
+// command-line options.
+const (
+	EnvConfig        = "NORDVPN_GTK_CONFIG"
+	EnvProfile       = "NORDVPN_GTK_PROFILE"
+	EnvProtocol      = "NORDVPN_GTK_PROTOCOL"
+	EnvTechnology    = "NORDVPN_GTK_TECHNOLOGY"
+	EnvNoAutoConnect = "NORDVPN_GTK_NO_AUTOCONNECT"
+	EnvUI            = "NORDVPN_GTK_UI"
+)
+
+// Overrides are the settings given on the command line or in the environment.
+// They apply for a single run of the application, and are never saved to the
+// config file. Empty fields are not overridden.
+type Overrides struct {
+	// ConfigPath replaces the path of the user's config file.
+	ConfigPath string
+	// UIPath replaces the path of the GtkBuilder file defining the interface.
+	UIPath string
+	// Profile is the name of the saved profile to use.
+	Profile string
+	// Protocol is the protocol to use, either UDP or TCP.
+	Protocol string
+	// Technology is the technology to use, either OPENVPN or NORDLYNX.
+	Technology string
+	// NoAutoConnect disables auto-connect.
+	NoAutoConnect bool
+}
+
+// OverridesFromEnvironment reads the overrides from the NORDVPN_GTK_*
+// environment variables.
+func OverridesFromEnvironment() (Overrides, error) {
+	overrides := Overrides{
+		ConfigPath: os.Getenv(EnvConfig),
+		UIPath:     os.Getenv(EnvUI),
+		Profile:    os.Getenv(EnvProfile),
+		Protocol:   os.Getenv(EnvProtocol),
+		Technology: os.Getenv(EnvTechnology),
+	}
+
+	if value := os.Getenv(EnvNoAutoConnect); value != "" {
+		noAutoConnect, err := strconv.ParseBool(value)
+		if err != nil {
+			return overrides, fmt.Errorf("%s must be true or false, not %q",
+				EnvNoAutoConnect, value)
+		}
+		overrides.NoAutoConnect = noAutoConnect
+	}
+
+	return overrides, nil
+}
+
+// Merge returns the overrides with the fields set in other replacing their
+// own, so that command-line options may take precedence over the environment.
+func (overrides Overrides) Merge(other Overrides) Overrides {
+	replace := func(value *string, with string) {
+		if with != "" {
+			*value = with
+		}
+	}
+	replace(&overrides.ConfigPath, other.ConfigPath)
+	replace(&overrides.UIPath, other.UIPath)
+	replace(&overrides.Profile, other.Profile)
+	replace(&overrides.Protocol, other.Protocol)
+	replace(&overrides.Technology, other.Technology)
+	overrides.NoAutoConnect = overrides.NoAutoConnect || other.NoAutoConnect
+	return overrides
+}
+
+// ApplyOverrides replaces the settings in use with those given in the
+// overrides. Settings locked by the system policy are not overridden. The
+// values the overridden fields had are remembered, and are written in their
+// place whenever the config is saved, so that the overrides are never saved.
+// A description of each override which could not be applied is returned.
+func (config *Config) ApplyOverrides(overrides Overrides) []string {
+	var problems []string
+	saved := config.fields()
+	override := func(fields ...string) {
+		if config.overridden == nil {
+			config.overridden = map[string]interface{}{}
+		}
+		for _, field := range fields {
+			// Overriding a field twice keeps the value from the file
+			if _, ok := config.overridden[field]; !ok {
+				config.overridden[field] = saved[field]
+			}
+		}
+	}
+	refuse := func(field string, name string) bool {
+		if config.Locked(field) {
+			problems = append(problems, "not overriding the "+name+
+				": it is managed by your organisation")
+			return true
+		}
+		return false
+	}
+
+	if overrides.Profile != "" {
+		if err := config.SwitchProfile(overrides.Profile); err != nil {
+			problems = append(problems, "unable to use profile: "+
+				err.Error())
+		} else {
+			fields := []string{"ActiveProfile"}
+			for field := range profileFieldNames() {
+				fields = append(fields, field)
+			}
+			override(fields...)
+		}
+	}
+
+	if protocol := strings.ToUpper(overrides.Protocol); protocol != "" &&
+		!refuse("Protocol", "protocol") {
+		switch protocol {
+		case "UDP", "TCP":
+			override("Protocol")
+			config.Protocol = protocol
+		default:
+			problems = append(problems, fmt.Sprintf("unknown protocol %q",
+				overrides.Protocol))
+		}
+	}
+
+	if technology := strings.ToUpper(overrides.Technology); technology != "" &&
+		!refuse("Technology", "technology") {
+		switch technology {
+		case "OPENVPN", "NORDLYNX":
+			override("Technology")
+			config.Technology = technology
+		default:
+			problems = append(problems, fmt.Sprintf("unknown technology %q",
+				overrides.Technology))
+		}
+	}
+
+	if overrides.NoAutoConnect &&
+		!refuse("AutoConnectEnabled", "auto-connect setting") {
+		override("AutoConnectEnabled")
+		config.AutoConnectEnabled = false
+	}
+
+	return problems
+}
+
+// SettingsChanged records that the named fields of the settings in use have
+// been changed in the application, so that they are no longer overridden and
+// their new values are saved. If the active profile is overridden, changing a
+// setting makes the profile chosen for this run the active profile, as the
+// settings in use belong to it. Its other settings are then saved with the
+// values stored in the profile, rather than with those in the config file.
+func (config *Config) SettingsChanged(fields ...string) {
+	if len(config.overridden) == 0 {
+		return
+	}
+
+	profileFields := profileFieldNames()
+	_, profileOverridden := config.overridden["ActiveProfile"]
+	profile, profileExists := config.Profiles[config.ActiveProfile]
+	for _, field := range fields {
+		if !profileOverridden || !profileExists || !profileFields[field] {
+			continue
+		}
+
+		data, _ := json.Marshal(profile)
+		var stored map[string]interface{}
+		_ = json.Unmarshal(data, &stored)
+		for name := range profileFields {
+			if _, ok := config.overridden[name]; ok {
+				config.overridden[name] = stored[name]
+			}
+		}
+		delete(config.overridden, "ActiveProfile")
+		break
+	}
+
+	for _, field := range fields {
+		delete(config.overridden, field)
+	}
+}
+
+// Overridden reports whether any of the settings in use are overridden.
+func (config *Config) Overridden() bool {
+	return len(config.overridden) > 0
+}
+
+// withoutOverrides returns a copy of the config with the overridden fields
+// restored to the values they had before the overrides were applied. The
+// config itself is returned if nothing is overridden.
+func (config *Config) withoutOverrides() *Config {
+	if !config.Overridden() {
+		return config
+	}
+
+	fields := config.fields()
+	for field, value := range config.overridden {
+		fields[field] = value
+	}
+
+	copied, err := config.cloneFields(fields)
+	if err != nil {
+		// The fields were encoded from a config, so cannot fail to decode
+		util.LogWarning("Unable to copy config", err)
+		return config
+	}
+	return copied
+}
+
+// fields returns the fields of the config, as they are written to the config
+// file.
+func (config *Config) fields() map[string]interface{} {
+	data, _ := json.Marshal(config)
+	var fields map[string]interface{}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+// EffectiveConfig returns the config which would be used with the given
+// overrides, along with the problems found with the config files and
+// overrides. Unlike LoadConfig, no files are modified.
+func EffectiveConfig(overrides Overrides) (*Config, []string, error) {
+	system, problems := LoadSystemConfig(SystemConfigDir)
+
+	path := overrides.ConfigPath
+	if path == "" {
+		var err error
+		if path, err = DefaultConfigPath(); err != nil {
+			return nil, problems, fmt.Errorf(
+				"unable to determine user config directory: %w", err)
+		}
+	}
+
+	config, _, fileProblems, err := ReadConfig(path, system)
+	if errors.Is(err, os.ErrNotExist) {
+		config, fileProblems = DefaultConfig(system)
+	} else if err != nil {
+		return nil, problems, err
+	}
+	problems = append(problems, fileProblems...)
+
+	return config, append(problems, config.ApplyOverrides(overrides)...), nil
+}
+
+// PrintEffectiveConfig writes the config which would be used with the given
+// overrides to w, in the format of the config file. The problems found are
+// logged.
+func PrintEffectiveConfig(overrides Overrides, w io.Writer) error {
+	config, problems, err := EffectiveConfig(overrides)
+	for _, problem := range problems {
+		util.LogWarning("Problem with config: "+problem, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
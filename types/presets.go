@@ -0,0 +1,40 @@
+package types
+
+import (
+	"main/util"
+	"main/whitelist"
+	"os"
+	"path/filepath"
+)
+
+// LoadPresets loads the catalogue of whitelist presets, consisting of the
+// builtin presets and any defined in the user's presets file. If the presets
+// file cannot be read, only the builtin presets are available.
+func LoadPresets() *whitelist.Catalogue {
+	builtin := whitelist.BuiltinPresets()
+
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		util.LogWarning("Unable to determine user config directory", err)
+		return whitelist.NewCatalogue(builtin, nil)
+	}
+
+	presetsPath := filepath.Join(userConfigDir, ConfigDir, PresetsFile)
+	presetsFile, err := os.Open(presetsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			util.LogWarning("Unable to open presets file", err)
+		}
+		return whitelist.NewCatalogue(builtin, nil)
+	}
+	defer presetsFile.Close()
+
+	user, err := whitelist.ReadPresets(presetsFile)
+	if err != nil {
+		util.LogWarning("Unable to read presets file", err)
+		return whitelist.NewCatalogue(builtin, nil)
+	}
+	util.LogInfo("Loaded user presets file")
+
+	return whitelist.NewCatalogue(builtin, user)
+}
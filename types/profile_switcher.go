@@ -0,0 +1,296 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"github.com/adamdb5/opennord/pb"
+	"github.com/gotk3/gotk3/gtk"
+	"main/daemon/daemonerr"
+	"main/util"
+	"strings"
+)
+
+// ProfileSwitcher contains the GTK components for choosing, saving and
+// deleting the named configuration profiles.
+type ProfileSwitcher struct {
+	ComboText    *gtk.ComboBoxText
+	SaveButton   *gtk.Button
+	DeleteButton *gtk.Button
+	NameDialog   *gtk.Dialog
+	NameEntry    *gtk.Entry
+}
+
+// BuildProfileSwitcher constructs the profile switcher from the provided
+// builder.
+func BuildProfileSwitcher(builder *gtk.Builder) *ProfileSwitcher {
+	profileSwitcher := &ProfileSwitcher{
+		ComboText: util.BuilderGetComboBoxText(builder, "profile_combo_text"),
+		SaveButton: util.BuilderGetButton(builder,
+			"profile_save_button"),
+		DeleteButton: util.BuilderGetButton(builder,
+			"profile_delete_button"),
+		NameDialog: util.BuilderGetDialog(builder, "profile_name_dialog"),
+		NameEntry:  util.BuilderGetEntry(builder, "profile_name_entry"),
+	}
+	profileSwitcher.NameDialog.SetDefaultResponse(gtk.RESPONSE_OK)
+
+	return profileSwitcher
+}
+
+// Populate lists the given profile names, selecting the active profile. The
+// 'Delete' button is only enabled while a profile is selected.
+func (profileSwitcher *ProfileSwitcher) Populate(names []string,
+	active string) {
+	profileSwitcher.ComboText.RemoveAll()
+	profileSwitcher.ComboText.SetActive(-1)
+	for i, name := range names {
+		profileSwitcher.ComboText.AppendText(name)
+		if name == active {
+			profileSwitcher.ComboText.SetActive(i)
+		}
+	}
+	profileSwitcher.DeleteButton.SetSensitive(active != "")
+}
+
+// RunNameDialog asks the user for the name to save a profile as, suggesting
+// the given name. If the user cancels, or does not enter a name, ok is false.
+func (profileSwitcher *ProfileSwitcher) RunNameDialog(suggested string) (
+	name string, ok bool) {
+	profileSwitcher.NameEntry.SetText(suggested)
+	profileSwitcher.NameEntry.GrabFocus()
+
+	response := profileSwitcher.NameDialog.Run()
+	profileSwitcher.NameDialog.Hide()
+	if response != gtk.RESPONSE_OK {
+		return "", false
+	}
+
+	name, _ = profileSwitcher.NameEntry.GetText()
+	name = strings.TrimSpace(name)
+	return name, name != ""
+}
+
+// PopulateProfiles lists the saved profiles in the profile switcher, without
+// invoking its callbacks.
+func (app *Application) PopulateProfiles() {
+	populating := app.populating
+	app.populating = true
+	app.Window.ProfileSwitcher.Populate(app.Config.ProfileNames(),
+		app.Config.ActiveProfile)
+	app.populating = populating
+}
+
+// ProfileSelected is invoked whenever a profile is selected from the profile
+// combo box. This function replaces the settings in use with those of the
+// chosen profile, and applies them to the daemon.
+func ProfileSelected(app *Application) error {
+	name := app.Window.ProfileSwitcher.ComboText.GetActiveText()
+	if name == "" || name == app.Config.ActiveProfile {
+		return nil
+	}
+
+	if err := app.Config.SwitchProfile(name); err != nil {
+		util.LogError("Unable to switch profile", err)
+		app.Window.InfoBar.DisplayMessage("Unable to switch to profile "+
+			name, gtk.MESSAGE_ERROR)
+		app.PopulateProfiles()
+		return err
+	}
+	util.LogInfo("Switched to profile " + name)
+
+	app.populating = true
+	app.PopulateFromConfig()
+	app.populating = false
+	app.PopulateProfiles()
+	app.PopulateGroups()
+
+	if err := SaveConfig(app); err != nil {
+		app.DisplaySaveError(err)
+	}
+
+	ApplyProfileSettings(app)
+	return nil
+}
+
+// ProfileSaveClicked is invoked whenever the 'Save As...' button of the
+// profile switcher is clicked. This function saves the settings in use as a
+// profile with the name chosen by the user.
+func ProfileSaveClicked(app *Application) error {
+	name, ok := app.Window.ProfileSwitcher.RunNameDialog(
+		app.Config.ActiveProfile)
+	if !ok {
+		return nil
+	}
+
+	app.Config.SaveProfile(name)
+	app.PopulateProfiles()
+	if err := SaveConfig(app); err != nil {
+		app.DisplaySaveError(err)
+		return err
+	}
+
+	app.Window.InfoBar.DisplayMessage("Saved profile "+name,
+		gtk.MESSAGE_INFO)
+	return nil
+}
+
+// ProfileDeleteClicked is invoked whenever the 'Delete' button of the profile
+// switcher is clicked. This function deletes the selected profile. The
+// settings in use are kept.
+func ProfileDeleteClicked(app *Application) error {
+	name := app.Window.ProfileSwitcher.ComboText.GetActiveText()
+	if name == "" {
+		return nil
+	}
+
+	app.Config.DeleteProfile(name)
+	app.PopulateProfiles()
+	if err := SaveConfig(app); err != nil {
+		app.DisplaySaveError(err)
+		return err
+	}
+
+	app.Window.InfoBar.DisplayMessage("Deleted profile "+name,
+		gtk.MESSAGE_INFO)
+	return nil
+}
+
+// profileSetting is a setting which is sent to the daemon when switching
+// profile.
+type profileSetting struct {
+	name string
+	set  func(client DaemonClient) error
+}
+
+// profileSettings returns the settings of profile in the order they are sent
+// to the daemon. The technology is sent first, as the protocol and
+// obfuscation may only be set when using OpenVPN.
+func profileSettings(profile *Profile,
+	whiteList *pb.Whitelist) []profileSetting {
+	var settings []profileSetting
+	add := func(name string, set func(client DaemonClient) error) {
+		settings = append(settings, profileSetting{name: name, set: set})
+	}
+
+	technology := pb.TechnologyEnum_OPENVPN
+	if profile.Technology != "" {
+		technology = ParseTechnology(profile.Technology)
+		add("Technology", func(client DaemonClient) error {
+			return client.SetTechnology(technology)
+		})
+	}
+	if technology == pb.TechnologyEnum_OPENVPN {
+		protocol := ParseProtocol(profile.Protocol)
+		add("Protocol", func(client DaemonClient) error {
+			return client.SetProtocol(protocol)
+		})
+		add("Obfuscation", func(client DaemonClient) error {
+			return client.SetObfuscate(profile.ObfuscationEnabled)
+		})
+	}
+
+	dns := ParseDNS(strings.Join(profile.DNSServers, ","))
+	add("CyberSec", func(client DaemonClient) error {
+		return client.SetCyberSec(profile.CyberSecEnabled)
+	})
+	add("DNS", func(client DaemonClient) error {
+		return client.SetDns(&pb.SetDNSRequest{
+			Dns:      dns,
+			CyberSec: profile.CyberSecEnabled,
+		})
+	})
+	add("Firewall", func(client DaemonClient) error {
+		return client.SetFirewall(profile.FirewallEnabled)
+	})
+	add("Kill Switch", func(client DaemonClient) error {
+		return client.SetKillSwitch(profile.KillSwitchEnabled)
+	})
+	add("IPv6", func(client DaemonClient) error {
+		return client.SetIpv6(profile.IPv6Enabled)
+	})
+	add("Notifications", func(client DaemonClient) error {
+		return client.SetNotify(profile.NotificationsEnabled)
+	})
+	add("Whitelist", func(client DaemonClient) error {
+		return client.SetWhitelist(&pb.SetWhitelistRequest{
+			Whitelist: whiteList,
+		})
+	})
+	add("Auto-connect", func(client DaemonClient) error {
+		_, err := client.SetAutoConnect(&pb.SetAutoConnectRequest{
+			ServerTag:   profile.AutoConnectServerTag,
+			Protocol:    ParseProtocol(profile.Protocol),
+			CyberSec:    profile.CyberSecEnabled,
+			Obfuscate:   profile.ObfuscationEnabled,
+			AutoConnect: profile.AutoConnectEnabled,
+			Dns:         dns,
+			Whitelist:   whiteList,
+		})
+		return err
+	})
+
+	return settings
+}
+
+// ApplyProfileSettings sends every setting of the active profile to the
+// daemon in a single operation. Settings which already have the requested
+// value are not treated as failures. Once finished, the info bar reports
+// which settings could not be applied, if any, offering to retry.
+func ApplyProfileSettings(app *Application) {
+	name := app.Config.ActiveProfile
+	app.applySettings("profile "+name, "Switched to profile "+name)
+}
+
+// applySettings sends every setting in use to the daemon, as described for
+// ApplyProfileSettings. subject names the settings in the info bar, and
+// success is displayed once all of them have been applied.
+func (app *Application) applySettings(subject string, success string) {
+	profile := app.Config.Profile.Clone()
+	settings := profileSettings(profile, profile.WhiteList.Proto(app.Presets))
+	client := app.Client
+	retry := func() { app.applySettings(subject, success) }
+
+	var failed []string
+	var lastErr error
+	whiteListSet := false
+	app.RunOperation("Applying "+subject+"...",
+		func(ctx context.Context) error {
+			for _, setting := range settings {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				app.PostProgress("Setting " + setting.name + "...")
+				err := setting.set(client)
+				if err == nil || errors.Is(err, daemonerr.ErrAlreadySet) {
+					whiteListSet = whiteListSet || setting.name == "Whitelist"
+					continue
+				}
+				util.LogError("Unable to set "+setting.name, err)
+				// There is no point trying the remaining settings
+				if daemonerr.KindOf(err) == daemonerr.Unreachable {
+					return err
+				}
+				failed = append(failed, setting.name)
+				lastErr = err
+			}
+			return nil
+		}, func(err error) {
+			if whiteListSet {
+				app.whiteListApplied(profile.WhiteList)
+			}
+			switch {
+			case errors.Is(err, context.Canceled):
+				app.Window.InfoBar.DisplayMessage("Applying "+subject+
+					" cancelled", gtk.MESSAGE_WARNING)
+			case err != nil:
+				app.DisplayError("Unable to apply "+subject, err, retry)
+			case lastErr != nil:
+				app.DisplayError("Unable to apply "+subject+" ("+
+					strings.Join(failed, ", ")+")", lastErr, retry)
+			default:
+				app.Window.InfoBar.DisplayMessage(success, gtk.MESSAGE_INFO)
+			}
+			app.StatusPoller.Refresh()
+		})
+}
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Clone returns a deep copy of the profile.
+func (profile *Profile) Clone() *Profile {
+	// Every field of a profile is serialisable, as profiles are saved in the
+	// config
+	bytes, _ := json.Marshal(profile)
+	var clone Profile
+	_ = json.Unmarshal(bytes, &clone)
+	clone.fillDefaults()
+	return &clone
+}
+
+// fillDefaults replaces missing sections of the profile with empty ones.
+func (profile *Profile) fillDefaults() {
+	if profile.Connect == nil {
+		profile.Connect = &Connect{}
+	}
+	if profile.WhiteList == nil {
+		profile.WhiteList = &WhiteList{}
+	}
+}
+
+// ProfileNames returns the names of the saved profiles in alphabetical order.
+func (config *Config) ProfileNames() []string {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SaveProfile saves a copy of the settings in use as the named profile,
+// replacing any existing profile of that name, and makes it the active
+// profile.
+func (config *Config) SaveProfile(name string) {
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]*Profile)
+	}
+	config.Profiles[name] = config.Profile.Clone()
+	config.ActiveProfile = name
+}
+
+// SwitchProfile makes the named profile the active profile, replacing the
+// settings in use with a copy of its settings. The settings in use are first
+// copied to the previously active profile, so that they are not lost. Any
+// overrides are discarded.
+func (config *Config) SwitchProfile(name string) error {
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return fmt.Errorf("no profile named %q", name)
+	}
+
+	config.storeActiveProfile()
+	config.overridden = nil
+	config.Profile = *profile.Clone()
+	config.ActiveProfile = name
+	return nil
+}
+
+// DeleteProfile deletes the named profile. If it is the active profile, the
+// settings in use are kept, but no profile is active.
+func (config *Config) DeleteProfile(name string) {
+	delete(config.Profiles, name)
+	if config.ActiveProfile == name {
+		config.ActiveProfile = ""
+	}
+}
+
+// storeActiveProfile copies the settings in use to the active profile, if
+// any. Overridden settings are stored with the values they had before they
+// were overridden. Nothing is stored if the active profile itself is
+// overridden, as the settings in use then belong to a profile chosen for this
+// run only.
+func (config *Config) storeActiveProfile() {
+	saved := config.withoutOverrides()
+	if config.ActiveProfile == "" ||
+		saved.ActiveProfile != config.ActiveProfile {
+		return
+	}
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]*Profile)
+	}
+	config.Profiles[config.ActiveProfile] = saved.Profile.Clone()
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"github.com/adamdb5/opennord/pb"
+	"main/whitelist"
+	"strings"
+)
+
+// SettingDrift describes a setting whose value in the daemon differs from the
+// value saved in the config.
+type SettingDrift struct {
+	Name string
+	// Field is the config field containing the saved value.
+	Field  string
+	Daemon string
+	Saved  string
+
+	// adopt updates the config with the daemon's value.
+	adopt func(config *Config)
+	// push sends the saved value to the daemon.
+	push func(client DaemonClient, config *Config) error
+}
+
+// String describes the drift, for example "kill switch: daemon=on,
+// saved=off".
+func (drift SettingDrift) String() string {
+	return strings.ToLower(drift.Name) + ": daemon=" + drift.Daemon +
+		", saved=" + drift.Saved
+}
+
+// Adopt updates config with the daemon's value of the setting.
+func (drift SettingDrift) Adopt(config *Config) {
+	drift.adopt(config)
+}
+
+// Push sends the value of the setting saved in config to the daemon.
+func (drift SettingDrift) Push(client DaemonClient, config *Config) error {
+	return drift.push(client, config)
+}
+
+// CompareSettings returns the settings whose values in the daemon differ from
+// those saved in config. Only the settings reported by the daemon are
+// compared: the technology, firewall, kill switch, auto-connect, notifications
+// and IPv6. The technology is not compared if none has been saved. The presets
+// are used to resolve the saved whitelist when pushing auto-connect.
+func CompareSettings(settings *pb.Settings, config *Config,
+	presets *whitelist.Catalogue) []SettingDrift {
+	var drifts []SettingDrift
+
+	compare := func(name string, field string, daemon bool, saved bool,
+		adopt func(config *Config, value bool),
+		push func(client DaemonClient, config *Config, value bool) error) {
+		if daemon == saved {
+			return
+		}
+
+		drifts = append(drifts, SettingDrift{
+			Name:   name,
+			Field:  field,
+			Daemon: onOff(daemon),
+			Saved:  onOff(saved),
+			adopt:  func(config *Config) { adopt(config, daemon) },
+			push: func(client DaemonClient, config *Config) error {
+				return push(client, config, saved)
+			},
+		})
+	}
+
+	if config.Technology != "" {
+		saved := ParseTechnology(config.Technology)
+		if technology := settings.GetTechnology(); technology != saved {
+			drifts = append(drifts, SettingDrift{
+				Name:   "Technology",
+				Field:  "Technology",
+				Daemon: technology.String(),
+				Saved:  saved.String(),
+				adopt: func(config *Config) {
+					config.Technology = technology.String()
+				},
+				push: func(client DaemonClient, config *Config) error {
+					return client.SetTechnology(saved)
+				},
+			})
+		}
+	}
+
+	compare("Firewall", "FirewallEnabled", settings.GetFirewall(),
+		config.FirewallEnabled,
+		func(config *Config, value bool) { config.FirewallEnabled = value },
+		func(client DaemonClient, config *Config, value bool) error {
+			return client.SetFirewall(value)
+		})
+	compare("Kill Switch", "KillSwitchEnabled", settings.GetKillSwitch(),
+		config.KillSwitchEnabled,
+		func(config *Config, value bool) { config.KillSwitchEnabled = value },
+		func(client DaemonClient, config *Config, value bool) error {
+			return client.SetKillSwitch(value)
+		})
+	compare("Auto-connect", "AutoConnectEnabled", settings.GetAutoConnect(),
+		config.AutoConnectEnabled,
+		func(config *Config, value bool) { config.AutoConnectEnabled = value },
+		func(client DaemonClient, config *Config, value bool) error {
+			settings := config.ConnectSettings(presets)
+			_, err := client.SetAutoConnect(&pb.SetAutoConnectRequest{
+				ServerTag:   config.AutoConnectServerTag,
+				Protocol:    settings.Protocol,
+				CyberSec:    settings.CyberSec,
+				Obfuscate:   settings.Obfuscate,
+				AutoConnect: value,
+				Dns:         settings.DNS,
+				Whitelist:   settings.WhiteList,
+			})
+			return err
+		})
+	compare("Notifications", "NotificationsEnabled", settings.GetNotify(),
+		config.NotificationsEnabled,
+		func(config *Config, value bool) {
+			config.NotificationsEnabled = value
+		},
+		func(client DaemonClient, config *Config, value bool) error {
+			return client.SetNotify(value)
+		})
+	compare("IPv6", "IPv6Enabled", settings.GetIpv6(), config.IPv6Enabled,
+		func(config *Config, value bool) { config.IPv6Enabled = value },
+		func(client DaemonClient, config *Config, value bool) error {
+			return client.SetIpv6(value)
+		})
+
+	return drifts
+}
+
+// ParseTechnology converts the name of a technology, as listed by the daemon,
+// into a pb.TechnologyEnum. Unrecognised names are treated as OpenVPN.
+func ParseTechnology(text string) pb.TechnologyEnum {
+	if strings.EqualFold(text, "NORDLYNX") {
+		return pb.TechnologyEnum_NORDLYNX
+	}
+	return pb.TechnologyEnum_OPENVPN
+}
+
+// onOff describes a boolean setting.
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
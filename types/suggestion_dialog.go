@@ -0,0 +1,69 @@
+package types
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+	"main/util"
+)
+
+// Suggestion is an entry which the user may choose to add to the whitelist.
+type Suggestion struct {
+	// Value is the entry which would be added, such as a subnet or a port.
+	Value string
+	// Description explains where the suggestion came from.
+	Description string
+}
+
+// SuggestionDialog contains the GTK components for the dialog which offers
+// entries to add to the whitelist.
+type SuggestionDialog struct {
+	Dialog  *gtk.Dialog
+	Label   *gtk.Label
+	ListBox *gtk.ListBox
+}
+
+// BuildSuggestionDialog constructs the suggestion dialog from the provided
+// builder.
+func BuildSuggestionDialog(builder *gtk.Builder) *SuggestionDialog {
+	return &SuggestionDialog{
+		Dialog:  util.BuilderGetDialog(builder, "suggestion_dialog"),
+		Label:   util.BuilderGetLabel(builder, "suggestion_label"),
+		ListBox: util.BuilderGetListBox(builder, "suggestion_list_box"),
+	}
+}
+
+// Run displays the given suggestions, all of which are initially selected,
+// and waits for the user to choose which of them to add. The selected
+// suggestions are returned, or nil if the dialog was cancelled.
+func (suggestionDialog *SuggestionDialog) Run(title string, prompt string,
+	suggestions []Suggestion) []Suggestion {
+	suggestionDialog.Dialog.SetTitle(title)
+	suggestionDialog.Label.SetText(prompt)
+	clearListBox(suggestionDialog.ListBox)
+
+	checkButtons := make([]*gtk.CheckButton, len(suggestions))
+	for i, suggestion := range suggestions {
+		checkButton, _ := gtk.CheckButtonNewWithLabel(suggestion.Value +
+			"  (" + suggestion.Description + ")")
+		checkButton.SetActive(true)
+		checkButtons[i] = checkButton
+
+		row, _ := gtk.ListBoxRowNew()
+		row.Add(checkButton)
+		suggestionDialog.ListBox.Add(row)
+		row.ShowAll()
+	}
+
+	response := suggestionDialog.Dialog.Run()
+	suggestionDialog.Dialog.Hide()
+	if response != gtk.RESPONSE_OK {
+		return nil
+	}
+
+	var selected []Suggestion
+	for i, checkButton := range checkButtons {
+		if checkButton.GetActive() {
+			selected = append(selected, suggestions[i])
+		}
+	}
+	return selected
+}
@@ -0,0 +1,330 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SystemConfig contains the settings configured for every user by an
+// administrator. Each is a set of config fields, in the format of the config
+// file.
+type SystemConfig struct {
+	// Defaults are the values of the settings missing from the user's config.
+	Defaults map[string]interface{}
+	// Policy contains the settings which are enforced, replacing the user's
+	// values, and which the user cannot change.
+	Policy map[string]interface{}
+}
+
+// LoadSystemConfig loads the system config from the given directory. The
+// defaults are merged from every *.conf file in the directory in
+// alphabetical order, so that later files take precedence. The policy is
+// loaded from PolicyFile. Files and policy settings which are invalid are
+// ignored, and a description of each problem is returned.
+func LoadSystemConfig(dir string) (*SystemConfig, []string) {
+	system := &SystemConfig{
+		Defaults: map[string]interface{}{},
+		Policy:   map[string]interface{}{},
+	}
+	var problems []string
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.conf"))
+	for _, path := range paths {
+		fields, err := readConfigFields(path)
+		if err == nil {
+			// Make sure the defaults can still be decoded with the file
+			merged := map[string]interface{}{}
+			mergeConfigFields(merged, system.Defaults)
+			mergeConfigFields(merged, fields)
+			_, err = buildConfig(merged)
+		}
+		if err != nil {
+			problems = append(problems, "ignoring system defaults in "+path+
+				": "+err.Error())
+			continue
+		}
+		mergeConfigFields(system.Defaults, fields)
+	}
+
+	path := filepath.Join(dir, PolicyFile)
+	fields, err := readConfigFields(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return system, problems
+	}
+	if err != nil {
+		return system, append(problems, "unable to read the policy in "+
+			path+": "+err.Error())
+	}
+
+	delete(fields, "Version")
+	known := profileFieldNames()
+	for _, key := range sortedKeys(fields) {
+		if !known[key] {
+			problems = append(problems, "ignoring policy setting "+key+
+				" in "+path+": it is not a setting which can be locked")
+			continue
+		}
+
+		setting := map[string]interface{}{key: fields[key]}
+		if err := NewProfile().applyPolicy(setting); err != nil {
+			problems = append(problems, "ignoring policy setting "+key+
+				" in "+path+": "+err.Error())
+			continue
+		}
+		system.Policy[key] = fields[key]
+	}
+
+	return system, problems
+}
+
+// Locked reports whether the given config field, such as "KillSwitchEnabled"
+// or "WhiteList.Subnets", is enforced by the system policy. Fields within a
+// locked object are also locked.
+func (config *Config) Locked(field string) bool {
+	parts := strings.Split(field, ".")
+	for i := range parts {
+		if config.locked[strings.Join(parts[:i+1], ".")] {
+			return true
+		}
+	}
+	return false
+}
+
+// enforcePolicy replaces the values of the settings in use and of each saved
+// profile with those in the policy, and locks the policy's fields.
+func (config *Config) enforcePolicy(policy map[string]interface{}) error {
+	config.policy = policy
+	config.locked = map[string]bool{}
+	lockFields(config.locked, "", policy)
+
+	if err := config.Profile.applyPolicy(policy); err != nil {
+		return err
+	}
+	for _, profile := range config.Profiles {
+		if profile == nil {
+			continue
+		}
+		if err := profile.applyPolicy(policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPolicy replaces the values of the profile's settings with those in the
+// policy.
+func (profile *Profile) applyPolicy(policy map[string]interface{}) error {
+	if len(policy) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	mergeConfigFields(fields, policy)
+	if data, err = json.Marshal(fields); err != nil {
+		return err
+	}
+
+	var enforced Profile
+	if err := json.Unmarshal(data, &enforced); err != nil {
+		return err
+	}
+	enforced.fillDefaults()
+	*profile = enforced
+	return nil
+}
+
+// restoreUserFields replaces the values the system config gave the fields
+// of a config, in the format of the config file, with those in the user's own
+// file. Locked fields are given the values they have in the file, or removed
+// if the file leaves them out, so that the user's choices return once the
+// policy is lifted. Fields which the file leaves out, and which still have
+// their system default, are removed so that they follow later changes to the
+// default. The settings in use and each profile are compared with the profile
+// of the same name in the file, and with the settings in the file otherwise.
+func (config *Config) restoreUserFields(fields map[string]interface{}) {
+	user := config.userFields()
+	userProfiles, _ := user["Profiles"].(map[string]interface{})
+	userProfile := func(name string) map[string]interface{} {
+		if profile, ok := userProfiles[name].(map[string]interface{}); ok {
+			return profile
+		}
+		return user
+	}
+
+	active, _ := fields["ActiveProfile"].(string)
+	settings := user
+	if active != "" {
+		settings = map[string]interface{}{}
+		profileFields := profileFieldNames()
+		for key, value := range user {
+			if !profileFields[key] {
+				settings[key] = value
+			}
+		}
+		for key, value := range userProfile(active) {
+			if profileFields[key] {
+				settings[key] = value
+			}
+		}
+	}
+	config.restoreFields(fields, settings, true)
+
+	profiles, _ := fields["Profiles"].(map[string]interface{})
+	for name, value := range profiles {
+		if profile, ok := value.(map[string]interface{}); ok {
+			// The active profile is a copy of the settings in use
+			config.restoreFields(profile, userProfile(name), name == active)
+		}
+	}
+}
+
+// restoreFields restores the locked fields of a config or profile to their
+// values in user, as described by restoreUserFields. If defaulted is set, the
+// fields which only have their system default are also removed.
+func (config *Config) restoreFields(fields map[string]interface{},
+	user map[string]interface{}, defaulted bool) {
+	for path := range config.locked {
+		if value, ok := lookupField(user, path); ok {
+			setField(fields, path, value)
+		} else {
+			deleteField(fields, path)
+		}
+	}
+	if !defaulted {
+		return
+	}
+
+	paths := map[string]bool{}
+	lockFields(paths, "", config.defaults)
+	for path := range paths {
+		if _, ok := lookupField(user, path); ok || path == "Version" {
+			continue
+		}
+		value, ok := lookupField(fields, path)
+		if defaultValue, _ := lookupField(config.defaults, path); ok &&
+			reflect.DeepEqual(value, defaultValue) {
+			deleteField(fields, path)
+		}
+	}
+}
+
+// userFields returns the fields of the config file as it was last read or
+// written, migrated to the current schema version.
+func (config *Config) userFields() map[string]interface{} {
+	data := config.savedData
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+	fields, _, err := decodeConfigFields(data)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return fields
+}
+
+// lookupField returns the value of the field at the given path, such as
+// "WhiteList.Subnets", and whether it is present.
+func lookupField(fields map[string]interface{}, path string) (interface{},
+	bool) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		object, ok := fields[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		fields = object
+	}
+	value, ok := fields[parts[len(parts)-1]]
+	return value, ok
+}
+
+// setField sets the field at the given path, creating the objects containing
+// it if necessary.
+func setField(fields map[string]interface{}, path string,
+	value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		object, ok := fields[part].(map[string]interface{})
+		if !ok {
+			object = map[string]interface{}{}
+			fields[part] = object
+		}
+		fields = object
+	}
+	fields[parts[len(parts)-1]] = value
+}
+
+// deleteField removes the field at the given path, if it is present.
+func deleteField(fields map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		object, ok := fields[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields = object
+	}
+	delete(fields, parts[len(parts)-1])
+}
+
+// lockFields adds the path of every value in fields to locked. Objects are
+// descended into, so that only the fields they contain are locked.
+func lockFields(locked map[string]bool, prefix string,
+	fields map[string]interface{}) {
+	for key, value := range fields {
+		if object, ok := value.(map[string]interface{}); ok {
+			lockFields(locked, prefix+key+".", object)
+			continue
+		}
+		locked[prefix+key] = true
+	}
+}
+
+// profileFieldNames returns the names of the config fields which belong to a
+// profile.
+func profileFieldNames() map[string]bool {
+	data, _ := json.Marshal(NewProfile())
+	var fields map[string]interface{}
+	_ = json.Unmarshal(data, &fields)
+
+	names := map[string]bool{}
+	for name := range fields {
+		names[name] = true
+	}
+	return names
+}
+
+// readConfigFields reads the fields of the config file at path, migrating
+// them to the current schema version.
+func readConfigFields(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields, _, err := decodeConfigFields(data)
+	return fields, err
+}
+
+// sortedKeys returns the keys of fields in alphabetical order.
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
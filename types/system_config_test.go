@@ -0,0 +1,139 @@
+package types
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFile writes data to the file named name in dir, failing the test if
+// it cannot.
+func writeFile(t *testing.T, dir string, name string, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readFields reads the fields of the config file at path.
+func readFields(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestWriteConfigKeepsUserValues(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "defaults.conf", `{"Protocol": "TCP",
+		"KillSwitchEnabled": true, "WhiteList": {"Subnets": ["10.0.0.0/8"]}}`)
+	writeFile(t, dir, PolicyFile, `{"FirewallEnabled": true,
+		"IPv6Enabled": false}`)
+	system, problems := LoadSystemConfig(dir)
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+
+	path := writeFile(t, dir, "user.conf", `{"Version": 1,
+		"FirewallEnabled": false, "DNSServers": ["1.1.1.1"]}`)
+	config, _, _, err := ReadConfig(path, system)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.FirewallEnabled || config.Protocol != "TCP" {
+		t.Fatalf("got firewall %v and protocol %q, want the system config",
+			config.FirewallEnabled, config.Protocol)
+	}
+	if config.Modified() {
+		t.Error("config is modified after reading it")
+	}
+
+	config.KillSwitchEnabled = false
+	if err := writeConfig(path, config); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := readFields(t, path)
+	want := map[string]interface{}{
+		// The user's own value is kept for the locked setting
+		"FirewallEnabled": false,
+		// The setting changed from its default is written
+		"KillSwitchEnabled": false,
+		"DNSServers":        []interface{}{"1.1.1.1"},
+	}
+	for field, value := range want {
+		if !reflect.DeepEqual(fields[field], value) {
+			t.Errorf("got %s %v, want %v", field, fields[field], value)
+		}
+	}
+	// Locked and default settings missing from the file are left out
+	for _, field := range []string{"IPv6Enabled", "Protocol"} {
+		if value, ok := fields[field]; ok {
+			t.Errorf("got %s %v, want it left out", field, value)
+		}
+	}
+	whiteList, _ := fields["WhiteList"].(map[string]interface{})
+	if value, ok := whiteList["Subnets"]; ok {
+		t.Errorf("got WhiteList.Subnets %v, want it left out", value)
+	}
+	if fields["Version"] != float64(ConfigVersion) {
+		t.Errorf("got version %v, want %d", fields["Version"], ConfigVersion)
+	}
+
+	reread, _, _, err := ReadConfig(path, system)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reread.FirewallEnabled || reread.Protocol != "TCP" ||
+		reread.KillSwitchEnabled {
+		t.Errorf("got firewall %v, protocol %q and kill switch %v after "+
+			"reading the config again", reread.FirewallEnabled,
+			reread.Protocol, reread.KillSwitchEnabled)
+	}
+}
+
+func TestWriteConfigKeepsProfileUserValues(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, PolicyFile, `{"FirewallEnabled": true}`)
+	system, _ := LoadSystemConfig(dir)
+
+	path := writeFile(t, dir, "user.conf", `{"Version": 1,
+		"ActiveProfile": "home", "Profiles": {
+			"home": {"FirewallEnabled": false},
+			"office": {"Protocol": "TCP"}}}`)
+	config, _, _, err := ReadConfig(path, system)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.storeActiveProfile()
+	if err := writeConfig(path, config); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := readFields(t, path)
+	profiles, _ := fields["Profiles"].(map[string]interface{})
+	home, _ := profiles["home"].(map[string]interface{})
+	office, _ := profiles["office"].(map[string]interface{})
+	if home["FirewallEnabled"] != false {
+		t.Errorf("got firewall %v in the home profile, want false",
+			home["FirewallEnabled"])
+	}
+	if value, ok := office["FirewallEnabled"]; ok {
+		t.Errorf("got firewall %v in the office profile, want it left out",
+			value)
+	}
+	// The settings in use belong to the active profile
+	if fields["FirewallEnabled"] != false {
+		t.Errorf("got firewall %v, want false", fields["FirewallEnabled"])
+	}
+}
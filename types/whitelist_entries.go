@@ -0,0 +1,220 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"main/whitelist"
+	"time"
+)
+
+// Whitelist entry kinds, identifying the list to which an entry belongs.
+const (
+	EntrySubnet   = "Subnet"
+	EntryHostname = "Hostname"
+	EntryUDP      = whitelist.ProtocolUDP
+	EntryTCP      = whitelist.ProtocolTCP
+)
+
+// TemporaryEntry is a whitelisted subnet or port range which is removed from
+// the whitelist once it expires.
+type TemporaryEntry struct {
+	// Kind is one of EntrySubnet, EntryHostname, EntryUDP or EntryTCP.
+	Kind string
+	// Value is the subnet, or the port or port range.
+	Value   string
+	Expires time.Time
+}
+
+// Expired reports whether the entry has expired by now.
+func (entry TemporaryEntry) Expired(now time.Time) bool {
+	return !now.Before(entry.Expires)
+}
+
+// String describes the entry, such as "8080 (TCP)".
+func (entry TemporaryEntry) String() string {
+	if entry.Kind == EntrySubnet || entry.Kind == EntryHostname {
+		return entry.Value
+	}
+	return entry.Value + " (" + entry.Kind + ")"
+}
+
+// validate checks that the entry's kind is known and that its value is valid
+// for that kind.
+func (entry TemporaryEntry) validate() error {
+	var err error
+	switch entry.Kind {
+	case EntrySubnet:
+		_, err = whitelist.ParseSubnet(entry.Value)
+	case EntryHostname:
+		_, err = whitelist.ParseHostname(entry.Value)
+	case EntryUDP, EntryTCP:
+		_, err = whitelist.ParsePortRange(entry.Value)
+	default:
+		err = fmt.Errorf("temporary entry %q has unknown kind %q",
+			entry.Value, entry.Kind)
+	}
+	return err
+}
+
+// Clone returns a deep copy of the whitelist.
+func (whiteList *WhiteList) Clone() *WhiteList {
+	// Every field of a whitelist is serialisable, as it is saved in the config
+	bytes, _ := json.Marshal(whiteList)
+	var clone WhiteList
+	_ = json.Unmarshal(bytes, &clone)
+	return &clone
+}
+
+// Has reports whether the subnet or port range is already whitelisted,
+// either permanently or temporarily.
+func (whiteList *WhiteList) Has(kind string, value string) bool {
+	for _, entry := range whiteList.Temporary {
+		if entry.Kind == kind && entry.Value == value {
+			return true
+		}
+	}
+
+	switch kind {
+	case EntrySubnet:
+		return containsString(whiteList.Subnets, value)
+	case EntryHostname:
+		return containsString(whiteList.Hostnames, value)
+	case EntryUDP, EntryTCP:
+		portRange, err := whitelist.ParsePortRange(value)
+		return err == nil && portsContain(*whiteList.ports(kind), portRange)
+	}
+	return false
+}
+
+// Add whitelists the subnet or port range. If lifetime is positive, the entry
+// is temporary and expires once the lifetime has elapsed; otherwise, it is
+// permanent.
+func (whiteList *WhiteList) Add(kind string, value string,
+	lifetime time.Duration) {
+	if lifetime > 0 {
+		whiteList.Temporary = append(whiteList.Temporary, TemporaryEntry{
+			Kind:    kind,
+			Value:   value,
+			Expires: time.Now().Add(lifetime),
+		})
+		return
+	}
+	whiteList.add(kind, value)
+}
+
+// Remove removes the subnet or port range from the whitelist, whether it is
+// permanent or temporary.
+func (whiteList *WhiteList) Remove(kind string, value string) {
+	var temporary []TemporaryEntry
+	for _, entry := range whiteList.Temporary {
+		if entry.Kind != kind || entry.Value != value {
+			temporary = append(temporary, entry)
+		}
+	}
+	whiteList.Temporary = temporary
+
+	switch kind {
+	case EntrySubnet:
+		var subnets []string
+		for _, subnet := range whiteList.Subnets {
+			if subnet != value {
+				subnets = append(subnets, subnet)
+			}
+		}
+		whiteList.Subnets = subnets
+	case EntryHostname:
+		var hostnames []string
+		for _, hostname := range whiteList.Hostnames {
+			if hostname != value {
+				hostnames = append(hostnames, hostname)
+			}
+		}
+		whiteList.Hostnames = hostnames
+		whiteList.forgetUnusedHosts()
+	case EntryUDP, EntryTCP:
+		ports := whiteList.ports(kind)
+		var remaining []whitelist.PortRange
+		for _, portRange := range *ports {
+			if portRange.String() != value {
+				remaining = append(remaining, portRange)
+			}
+		}
+		*ports = remaining
+	}
+}
+
+// TemporaryEntries returns the temporary entries of the given kind.
+func (whiteList *WhiteList) TemporaryEntries(kind string) []TemporaryEntry {
+	var entries []TemporaryEntry
+	for _, entry := range whiteList.Temporary {
+		if entry.Kind == kind {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// RemoveExpired removes the temporary entries which have expired by now, and
+// returns them.
+func (whiteList *WhiteList) RemoveExpired(now time.Time) []TemporaryEntry {
+	var expired, remaining []TemporaryEntry
+	for _, entry := range whiteList.Temporary {
+		if entry.Expired(now) {
+			expired = append(expired, entry)
+		} else {
+			remaining = append(remaining, entry)
+		}
+	}
+	whiteList.Temporary = remaining
+	whiteList.forgetUnusedHosts()
+	return expired
+}
+
+// AllHostnames returns the whitelisted hostnames, whether they are permanent
+// or temporary.
+func (whiteList *WhiteList) AllHostnames() []string {
+	hostnames := append([]string(nil), whiteList.Hostnames...)
+	for _, entry := range whiteList.TemporaryEntries(EntryHostname) {
+		if !containsString(hostnames, entry.Value) {
+			hostnames = append(hostnames, entry.Value)
+		}
+	}
+	return hostnames
+}
+
+// forgetUnusedHosts discards the addresses of hostnames which are no longer
+// whitelisted.
+func (whiteList *WhiteList) forgetUnusedHosts() {
+	hostnames := whiteList.AllHostnames()
+	for hostname := range whiteList.ResolvedHosts {
+		if !containsString(hostnames, hostname) {
+			delete(whiteList.ResolvedHosts, hostname)
+		}
+	}
+}
+
+// add permanently whitelists the subnet or port range. Port ranges are merged
+// with any they overlap.
+func (whiteList *WhiteList) add(kind string, value string) {
+	switch kind {
+	case EntrySubnet:
+		whiteList.Subnets = append(whiteList.Subnets, value)
+	case EntryHostname:
+		whiteList.Hostnames = append(whiteList.Hostnames, value)
+	case EntryUDP, EntryTCP:
+		portRange, err := whitelist.ParsePortRange(value)
+		if err != nil {
+			return
+		}
+		ports := whiteList.ports(kind)
+		*ports = whitelist.MergePortRanges(append(*ports, portRange))
+	}
+}
+
+// ports returns the list of ports for the given kind of entry.
+func (whiteList *WhiteList) ports(kind string) *[]whitelist.PortRange {
+	if kind == EntryUDP {
+		return &whiteList.UDPPorts
+	}
+	return &whiteList.TCPPorts
+}
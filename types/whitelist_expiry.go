@@ -0,0 +1,101 @@
+package types
+
+import (
+	"github.com/adamdb5/opennord/pb"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"main/util"
+	"strings"
+	"time"
+)
+
+// StartWhitelistExpiry periodically removes expired temporary entries from
+// the whitelist, and updates the time remaining until the others expire.
+func (app *Application) StartWhitelistExpiry() {
+	glib.TimeoutAdd(uint(WhitelistExpiryInterval/time.Millisecond),
+		func() bool {
+			app.ExpireWhitelist()
+			app.Window.WhiteListTab.UpdateCountdowns()
+			return true
+		})
+}
+
+// ExpireWhitelist removes the temporary entries which have expired from the
+// config and from the daemon, including those which expired while the
+// application was closed. Only the expired entries are removed from the
+// whitelist last applied and from the whitelist last saved, so any pending
+// edits to the whitelist in use are neither applied nor saved. Entries are
+// only removed while connected to the daemon, so that the daemon is never
+// left with entries missing from the config.
+func (app *Application) ExpireWhitelist() {
+	if app.Client == nil || app.expiringWhitelist ||
+		time.Now().Before(app.expiryRetryAt) {
+		return
+	}
+
+	now := time.Now()
+	expired := app.Config.WhiteList.RemoveExpired(now)
+	applied := app.appliedWhiteList.Clone()
+	appliedExpired := applied.RemoveExpired(now)
+	if len(expired) == 0 && len(appliedExpired) == 0 {
+		return
+	}
+
+	var names []string
+	for _, entry := range append(expired, appliedExpired...) {
+		if !containsString(names, entry.String()) {
+			names = append(names, entry.String())
+		}
+	}
+	util.LogInfo("Whitelist entries expired: " + strings.Join(names, ", "))
+	if len(expired) > 0 {
+		app.Window.WhiteListTab.Populate(app.Config.WhiteList)
+	}
+
+	finish := func() {
+		err := saveWhiteListChange(app, func(whiteList *WhiteList) bool {
+			return len(whiteList.RemoveExpired(now)) > 0
+		})
+		if err != nil {
+			app.DisplaySaveError(err)
+		}
+		app.Window.InfoBar.DisplayMessage("Whitelist entries expired: "+
+			strings.Join(names, ", "), gtk.MESSAGE_INFO)
+	}
+	if len(appliedExpired) == 0 {
+		finish()
+		return
+	}
+
+	app.expiringWhitelist = true
+	client := app.Client
+	whiteList := applied.Proto(app.Presets)
+	RunInBackground(func() error {
+		return client.SetWhitelist(&pb.SetWhitelistRequest{
+			Whitelist: whiteList,
+		})
+	}, func(err error) {
+		app.expiringWhitelist = false
+		if err != nil {
+			// The entries are removed again after a delay, or as soon as
+			// another client has been attached
+			app.expiryRetryAt = time.Now().Add(app.expiryBackoff.Next())
+			app.DisplayError("Unable to remove expired whitelist entries",
+				err, func() {
+					app.expiryRetryAt = time.Time{}
+					app.ExpireWhitelist()
+				})
+			return
+		}
+
+		app.expiryBackoff.Reset()
+		app.whiteListApplied(applied)
+		finish()
+	})
+}
+
+// whiteListApplied records that the daemon has accepted whiteList.
+func (app *Application) whiteListApplied(whiteList *WhiteList) {
+	app.appliedWhiteList = whiteList.Clone()
+	app.expiringWhitelist = false
+}
@@ -0,0 +1,138 @@
+package types
+
+import (
+	"context"
+	"github.com/adamdb5/opennord/pb"
+	"github.com/gotk3/gotk3/glib"
+	"main/util"
+	"main/whitelist"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// StartHostnameResolution resolves the whitelisted hostnames now, and again
+// every HostnameResolveInterval.
+func (app *Application) StartHostnameResolution() {
+	app.ResolveHostnames()
+	glib.TimeoutAdd(uint(HostnameResolveInterval/time.Millisecond),
+		func() bool {
+			app.ResolveHostnames()
+			return true
+		})
+}
+
+// ResolveHostnames resolves the whitelisted hostnames in the background. If
+// the addresses of a previously resolved hostname have changed, the updated
+// whitelist is sent to the daemon and saved. Hostnames which cannot be
+// resolved keep their previous addresses.
+func (app *Application) ResolveHostnames() {
+	// Hostnames added while resolving are resolved once it has finished
+	if app.resolvingHostnames {
+		app.resolveHostnamesAgain = true
+		return
+	}
+
+	hostnames := app.Config.WhiteList.AllHostnames()
+	if len(hostnames) == 0 {
+		return
+	}
+	app.resolvingHostnames = true
+
+	resolved := make(map[string][]string)
+	RunInBackground(func() error {
+		for _, hostname := range hostnames {
+			ctx, cancel := context.WithTimeout(context.Background(),
+				HostnameResolveTimeout)
+			subnets, err := whitelist.ResolveHostname(ctx, hostname)
+			cancel()
+			if err != nil {
+				util.LogWarning("Unable to resolve "+hostname, err)
+				continue
+			}
+			resolved[hostname] = subnets
+		}
+		return nil
+	}, func(error) {
+		app.resolvingHostnames = false
+		app.updateResolvedHosts(resolved)
+
+		if app.resolveHostnamesAgain {
+			app.resolveHostnamesAgain = false
+			app.ResolveHostnames()
+		}
+	})
+}
+
+// updateResolvedHosts records the addresses to which the hostnames resolved,
+// and updates the daemon if the addresses of any hostname in the whitelist
+// last applied have changed. Only the addresses are updated in the whitelist
+// sent to the daemon and in the whitelist saved, so any pending edits to the
+// whitelist in use are neither applied nor saved.
+func (app *Application) updateResolvedHosts(resolved map[string][]string) {
+	// The hostname may have been removed while it was being resolved, so
+	// only hostnames still whitelisted are updated
+	update := func(whiteList *WhiteList) (updated []string, changed []string) {
+		if whiteList.ResolvedHosts == nil {
+			whiteList.ResolvedHosts = make(map[string][]string)
+		}
+		stillWhitelisted := whiteList.AllHostnames()
+		for hostname, subnets := range resolved {
+			if !containsString(stillWhitelisted, hostname) {
+				continue
+			}
+
+			previous, known := whiteList.ResolvedHosts[hostname]
+			if reflect.DeepEqual(previous, subnets) {
+				continue
+			}
+			if known && len(previous) > 0 {
+				changed = append(changed, hostname)
+			}
+			whiteList.ResolvedHosts[hostname] = subnets
+			updated = append(updated, hostname)
+		}
+		return updated, changed
+	}
+
+	if updated, _ := update(app.Config.WhiteList); len(updated) > 0 {
+		app.Window.WhiteListTab.Populate(app.Config.WhiteList)
+	}
+
+	save := func() {
+		err := saveWhiteListChange(app, func(whiteList *WhiteList) bool {
+			updated, _ := update(whiteList)
+			return len(updated) > 0
+		})
+		if err != nil {
+			app.DisplaySaveError(err)
+		}
+	}
+
+	// Newly added hostnames are sent to the daemon when the whitelist is
+	// applied, but the daemon must follow hostnames which have moved
+	applied := app.appliedWhiteList.Clone()
+	_, changed := update(applied)
+	if len(changed) == 0 || app.Client == nil {
+		save()
+		return
+	}
+	util.LogInfo("Whitelisted hostnames changed address: " +
+		strings.Join(changed, ", "))
+
+	request := &pb.SetWhitelistRequest{Whitelist: applied.Proto(app.Presets)}
+	client := app.Client
+	app.RunOperation("Updating whitelisted hostnames...",
+		func(context.Context) error {
+			return client.SetWhitelist(request)
+		}, func(err error) {
+			if err != nil {
+				app.DisplayError("Unable to update whitelisted hostnames",
+					err, app.ResolveHostnames)
+				return
+			}
+
+			app.whiteListApplied(applied)
+			save()
+		})
+}
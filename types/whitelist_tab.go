@@ -1,10 +1,15 @@
 package types
 
 import (
+	"context"
 	"github.com/adamdb5/opennord/pb"
 	"github.com/gotk3/gotk3/gtk"
-	"log"
+	"main/daemon"
 	"main/util"
+	"main/whitelist"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type WhitelistTab struct {
@@ -12,20 +17,50 @@ type WhitelistTab struct {
 	SubnetEntry        *gtk.Entry
 	SubnetAddButton    *gtk.Button
 	SubnetRemoveButton *gtk.Button
+	SubnetDetectButton *gtk.Button
 	UDPListBox         *gtk.ListBox
 	UDPEntry           *gtk.Entry
 	UDPAddButton       *gtk.Button
 	UDPRemoveButton    *gtk.Button
+	UDPSuggestButton   *gtk.Button
 	TCPListBox         *gtk.ListBox
 	TCPEntry           *gtk.Entry
 	TCPAddButton       *gtk.Button
 	TCPRemoveButton    *gtk.Button
+	TCPSuggestButton   *gtk.Button
+	PresetListBox      *gtk.ListBox
+	SimplifyButton     *gtk.Button
+	LifetimeComboText  *gtk.ComboBoxText
 	ApplyButton        *gtk.Button
 	SaveButton         *gtk.Button
+
+	countdowns []countdown
+	locks      settingLocks
+}
+
+// countdown is a label displaying the time remaining until a temporary entry
+// expires.
+type countdown struct {
+	label *gtk.Label
+	// detail is displayed before the time remaining.
+	detail  string
+	expires time.Time
+}
+
+// entryLifetimes are the lifetimes which may be chosen for new entries.
+var entryLifetimes = []struct {
+	name     string
+	lifetime time.Duration
+}{
+	{"Never expire", 0},
+	{"Expire after 15 minutes", 15 * time.Minute},
+	{"Expire after 1 hour", time.Hour},
+	{"Expire after 4 hours", 4 * time.Hour},
+	{"Expire after 1 day", 24 * time.Hour},
 }
 
 func BuildWhitelistTab(builder *gtk.Builder) *WhitelistTab {
-	return &WhitelistTab{
+	whitelistTab := &WhitelistTab{
 		SubnetListBox: util.BuilderGetListBox(builder,
 			"whitelist_subnet_list_box"),
 		SubnetEntry: util.BuilderGetEntry(builder,
@@ -34,6 +69,8 @@ func BuildWhitelistTab(builder *gtk.Builder) *WhitelistTab {
 			"whitelist_subnet_add_button"),
 		SubnetRemoveButton: util.BuilderGetButton(builder,
 			"whitelist_subnet_remove_button"),
+		SubnetDetectButton: util.BuilderGetButton(builder,
+			"whitelist_subnet_detect_button"),
 
 		UDPListBox: util.BuilderGetListBox(builder,
 			"whitelist_udp_list_box"),
@@ -43,6 +80,8 @@ func BuildWhitelistTab(builder *gtk.Builder) *WhitelistTab {
 			"whitelist_udp_add_button"),
 		UDPRemoveButton: util.BuilderGetButton(builder,
 			"whitelist_udp_remove_button"),
+		UDPSuggestButton: util.BuilderGetButton(builder,
+			"whitelist_udp_suggest_button"),
 
 		TCPListBox: util.BuilderGetListBox(builder,
 			"whitelist_tcp_list_box"),
@@ -52,110 +91,654 @@ func BuildWhitelistTab(builder *gtk.Builder) *WhitelistTab {
 			"whitelist_tcp_add_button"),
 		TCPRemoveButton: util.BuilderGetButton(builder,
 			"whitelist_tcp_remove_button"),
+		TCPSuggestButton: util.BuilderGetButton(builder,
+			"whitelist_tcp_suggest_button"),
+
+		PresetListBox: util.BuilderGetListBox(builder,
+			"whitelist_preset_list_box"),
 
+		SimplifyButton: util.BuilderGetButton(builder,
+			"whitelist_simplify_button"),
 		ApplyButton: util.BuilderGetButton(builder,
 			"whitelist_apply_button"),
+		LifetimeComboText: util.BuilderGetComboBoxText(builder,
+			"whitelist_lifetime_combo_text"),
 		SaveButton: util.BuilderGetButton(builder, "whitelist_save_button"),
 	}
+
+	for _, entryLifetime := range entryLifetimes {
+		whitelistTab.LifetimeComboText.AppendText(entryLifetime.name)
+	}
+	whitelistTab.LifetimeComboText.SetActive(0)
+
+	// Hostnames are entered alongside subnets, so the subnet controls are
+	// only locked with the subnets
+	locks := &whitelistTab.locks
+	locks.add("WhiteList.Subnets", whitelistTab.SubnetEntry,
+		whitelistTab.SubnetAddButton, whitelistTab.SubnetRemoveButton,
+		whitelistTab.SubnetDetectButton)
+	locks.add("WhiteList.UDPPorts", whitelistTab.UDPEntry,
+		whitelistTab.UDPAddButton, whitelistTab.UDPRemoveButton,
+		whitelistTab.UDPSuggestButton)
+	locks.add("WhiteList.TCPPorts", whitelistTab.TCPEntry,
+		whitelistTab.TCPAddButton, whitelistTab.TCPRemoveButton,
+		whitelistTab.TCPSuggestButton)
+	locks.add("WhiteList.Presets", whitelistTab.PresetListBox)
+
+	return whitelistTab
+}
+
+// UpdateControls disables the 'Apply' button while the connection state is
+// changing.
+func (whitelistTab *WhitelistTab) UpdateControls(
+	state daemon.ConnectionState) {
+	whitelistTab.ApplyButton.SetSensitive(!state.Transitioning())
+}
+
+// ShowIssues flags the subnets with the given issues, describing the issues in
+// each row's tooltip. The 'Simplify' button is only sensitive while there are
+// issues to resolve, and the subnets are not locked by the system policy.
+func (whitelistTab *WhitelistTab) ShowIssues(issues []whitelist.Issue) {
+	for i := 0; ; i++ {
+		row := whitelistTab.SubnetListBox.GetRowAtIndex(i)
+		if row == nil {
+			break
+		}
+
+		entry := listBoxRowText(row)
+		var descriptions []string
+		for _, issue := range issues {
+			if issue.Entry == entry {
+				descriptions = append(descriptions, issue.String())
+			}
+		}
+
+		row.SetTooltipText(strings.Join(descriptions, "\n"))
+		if style, err := row.GetStyleContext(); err == nil {
+			if len(descriptions) > 0 {
+				style.AddClass("warning")
+			} else {
+				style.RemoveClass("warning")
+			}
+		}
+	}
+
+	whitelistTab.SimplifyButton.SetSensitive(len(issues) > 0 &&
+		!whitelistTab.locks.Locked("WhiteList.Subnets"))
+}
+
+// Populate replaces the rows of the subnet and port list boxes with the
+// entries of the whitelist. Hostnames display the addresses to which they
+// resolved, temporary entries display the time remaining until they expire,
+// and any issues with the subnets are flagged.
+func (whitelistTab *WhitelistTab) Populate(whiteList *WhiteList) {
+	whitelistTab.countdowns = nil
+
+	lists := []struct {
+		kinds   []string
+		listBox *gtk.ListBox
+		values  []string
+	}{
+		{[]string{EntrySubnet, EntryHostname}, whitelistTab.SubnetListBox,
+			whiteList.Subnets},
+		{[]string{EntryUDP}, whitelistTab.UDPListBox,
+			portStrings(whiteList.UDPPorts)},
+		{[]string{EntryTCP}, whitelistTab.TCPListBox,
+			portStrings(whiteList.TCPPorts)},
+	}
+	for _, list := range lists {
+		clearListBox(list.listBox)
+		for _, value := range list.values {
+			addListBoxRow(list.listBox, value)
+		}
+		if list.listBox == whitelistTab.SubnetListBox {
+			for _, hostname := range whiteList.Hostnames {
+				addEntryRow(list.listBox, hostname,
+					"("+resolvedAddresses(whiteList, hostname)+")")
+			}
+		}
+
+		for _, kind := range list.kinds {
+			for _, entry := range whiteList.TemporaryEntries(kind) {
+				detail := ""
+				if kind == EntryHostname {
+					detail = resolvedAddresses(whiteList, entry.Value)
+				}
+				whitelistTab.countdowns = append(whitelistTab.countdowns,
+					countdown{
+						label:   addEntryRow(list.listBox, entry.Value, ""),
+						detail:  detail,
+						expires: entry.Expires,
+					})
+			}
+		}
+	}
+
+	whitelistTab.UpdateCountdowns()
+	whitelistTab.ShowIssues(whitelist.CheckSubnets(whiteList.Subnets))
+}
+
+// UpdateCountdowns updates the time remaining until each temporary entry
+// expires.
+func (whitelistTab *WhitelistTab) UpdateCountdowns() {
+	for _, countdown := range whitelistTab.countdowns {
+		var remaining string
+		switch until := time.Until(countdown.expires); {
+		case until <= 0:
+			remaining = "expired"
+		case until > time.Minute:
+			remaining = "expires in " +
+				util.FormatDuration(int64(until.Round(time.Minute)))
+		default:
+			remaining = "expires in " +
+				util.FormatDuration(int64(until.Round(time.Second)))
+		}
+
+		if countdown.detail != "" {
+			remaining = countdown.detail + ", " + remaining
+		}
+		countdown.label.SetText("(" + remaining + ")")
+	}
+}
+
+// resolvedAddresses describes the addresses to which the hostname last
+// resolved.
+func resolvedAddresses(whiteList *WhiteList, hostname string) string {
+	subnets := whiteList.ResolvedHosts[hostname]
+	if len(subnets) == 0 {
+		return "unresolved"
+	}
+
+	addresses := make([]string, len(subnets))
+	for i, subnet := range subnets {
+		addresses[i] = strings.SplitN(subnet, "/", 2)[0]
+	}
+	return strings.Join(addresses, ", ")
+}
+
+// Lifetime returns the lifetime selected for new entries, or zero if they
+// should not expire.
+func (whitelistTab *WhitelistTab) Lifetime() time.Duration {
+	active := whitelistTab.LifetimeComboText.GetActive()
+	if active < 0 || active >= len(entryLifetimes) {
+		return 0
+	}
+	return entryLifetimes[active].lifetime
 }
 
+// SubnetAddButtonClicked is invoked whenever the subnet 'Add' button on the
+// 'Whitelist' tab is clicked. The subnet is validated before it is added to
+// the list and to the config. Hostnames, such as "nas.local", are also
+// accepted, and are resolved immediately.
 func SubnetAddButtonClicked(app *Application) error {
-	subnet, _ := app.Window.WhiteListTab.SubnetEntry.GetText()
-	label, _ := gtk.LabelNew(subnet)
-	row, _ := gtk.ListBoxRowNew()
-	row.SetHAlign(gtk.ALIGN_START)
-	row.Add(label)
-	app.Window.WhiteListTab.SubnetListBox.Add(row)
-	row.ShowAll()
-	app.Window.WhiteListTab.SubnetEntry.SetText("")
-	app.Config.WhiteList.Subnets = append(app.Config.WhiteList.Subnets, "")
+	whiteListTab := app.Window.WhiteListTab
+	text, _ := whiteListTab.SubnetEntry.GetText()
+	kind := EntrySubnet
+	value, err := whitelist.ParseSubnet(text)
+	if err != nil {
+		// Anything which isn't a subnet may be a hostname. Mistyped
+		// addresses are not, so the subnet's error is reported for them.
+		hostname, hostnameErr := whitelist.ParseHostname(text)
+		if hostnameErr != nil {
+			app.Window.InfoBar.DisplayMessage("Invalid subnet: "+
+				err.Error(), gtk.MESSAGE_ERROR)
+			return err
+		}
+		kind, value = EntryHostname, hostname
+	}
+	if app.refuseLocked(entryField(kind), "The whitelisted "+
+		strings.ToLower(kind)+"s") {
+		return errSettingLocked
+	}
+
+	whiteList := app.Config.WhiteList
+	if whiteList.Has(kind, value) {
+		app.Window.InfoBar.DisplayMessage(value+" is already whitelisted",
+			gtk.MESSAGE_INFO)
+		return nil
+	}
+
+	whiteList.Add(kind, value, whiteListTab.Lifetime())
+	app.Config.SettingsChanged("WhiteList")
+	whiteListTab.Populate(whiteList)
+	whiteListTab.SubnetEntry.SetText("")
+
+	if kind == EntryHostname {
+		app.ResolveHostnames()
+	}
 	return nil
 }
 
+// SubnetRemoveButtonClicked is invoked whenever the subnet 'Remove' button on
+// the 'Whitelist' tab is clicked. The selected subnet or hostname is removed
+// from the list and from the config.
 func SubnetRemoveButtonClicked(app *Application) error {
-	row := app.Window.WhiteListTab.SubnetListBox.GetSelectedRow()
-	if row != nil {
-		app.Window.WhiteListTab.SubnetListBox.Remove(row)
-		var newSubnets []string
-		for _, subnet := range app.Config.WhiteList.Subnets {
-			widget, _ := row.GetChild()
-			label, _ := widget.(*gtk.Label)
-			text, _ := label.GetText()
-			if subnet != text {
-				newSubnets = append(newSubnets, subnet)
-			}
+	listBox := app.Window.WhiteListTab.SubnetListBox
+	row := listBox.GetSelectedRow()
+	if row == nil {
+		return nil
+	}
+
+	value := listBoxRowText(row)
+	kind := EntryHostname
+	if _, err := whitelist.ParseSubnet(value); err == nil {
+		kind = EntrySubnet
+	}
+	if app.refuseLocked(entryField(kind), "The whitelisted "+
+		strings.ToLower(kind)+"s") {
+		return errSettingLocked
+	}
+
+	app.Config.WhiteList.Remove(kind, value)
+	app.Config.SettingsChanged("WhiteList")
+	app.Window.WhiteListTab.Populate(app.Config.WhiteList)
+	return nil
+}
+
+// SubnetDetectButtonClicked is invoked whenever the subnet 'Detect' button on
+// the 'Whitelist' tab is clicked. The subnets of the local networks and of
+// container and virtual machine bridges are offered for addition, excluding
+// those which are already whitelisted.
+func SubnetDetectButtonClicked(app *Application) error {
+	if app.refuseLocked(entryField(EntrySubnet), "The whitelisted subnets") {
+		return errSettingLocked
+	}
+
+	detected, err := whitelist.DetectSubnets()
+	if err != nil {
+		util.LogError("Unable to detect local subnets", err)
+		app.Window.InfoBar.DisplayMessage("Unable to detect local subnets",
+			gtk.MESSAGE_ERROR)
+		return err
+	}
+
+	whiteList := app.Config.WhiteList
+	var suggestions []Suggestion
+	for _, subnet := range detected {
+		if whitelist.Covers(whiteList.Subnets, subnet.Subnet) ||
+			whiteList.Has(EntrySubnet, subnet.Subnet) {
+			continue
 		}
-		app.Config.WhiteList.Subnets = newSubnets
-		log.Printf("%d", len(app.Config.WhiteList.Subnets))
+		suggestions = append(suggestions, Suggestion{
+			Value:       subnet.Subnet,
+			Description: subnet.Kind.String() + ", " + subnet.Interface,
+		})
 	}
+
+	if len(suggestions) == 0 {
+		app.Window.InfoBar.DisplayMessage("All local subnets are already "+
+			"whitelisted", gtk.MESSAGE_INFO)
+		return nil
+	}
+
+	selected := app.Window.SuggestionDialog.Run("Detected Subnets",
+		"The following subnets are attached to this computer. Choose which "+
+			"to add to the whitelist.", suggestions)
+	addSuggestions(app, EntrySubnet, selected)
 	return nil
 }
 
+// UDPAddButtonClicked is invoked whenever the UDP 'Add' button on the
+// 'Whitelist' tab is clicked. The entry may contain a single port or a range
+// such as "8000-8100".
 func UDPAddButtonClicked(app *Application) error {
-	subnet, _ := app.Window.WhiteListTab.UDPEntry.GetText()
-	label, _ := gtk.LabelNew(subnet)
-	row, _ := gtk.ListBoxRowNew()
-	row.SetHAlign(gtk.ALIGN_START)
-	row.Add(label)
-	app.Window.WhiteListTab.UDPListBox.Add(row)
-	row.ShowAll()
-	app.Window.WhiteListTab.UDPEntry.SetText("")
-	return nil
+	return addPort(app, EntryUDP, app.Window.WhiteListTab.UDPEntry)
 }
 
+// UDPRemoveButtonClicked is invoked whenever the UDP 'Remove' button on the
+// 'Whitelist' tab is clicked.
 func UDPRemoveButtonClicked(app *Application) error {
-	row := app.Window.WhiteListTab.UDPListBox.GetSelectedRow()
-	if row != nil {
-		app.Window.WhiteListTab.UDPListBox.Remove(row)
-	}
+	removeEntry(app, EntryUDP, app.Window.WhiteListTab.UDPListBox)
 	return nil
 }
 
+// UDPSuggestButtonClicked is invoked whenever the UDP 'Suggest' button on the
+// 'Whitelist' tab is clicked.
+func UDPSuggestButtonClicked(app *Application) error {
+	return suggestPorts(app, EntryUDP)
+}
+
+// TCPAddButtonClicked is invoked whenever the TCP 'Add' button on the
+// 'Whitelist' tab is clicked. The entry may contain a single port or a range
+// such as "8000-8100".
 func TCPAddButtonClicked(app *Application) error {
-	subnet, _ := app.Window.WhiteListTab.TCPEntry.GetText()
-	label, _ := gtk.LabelNew(subnet)
-	row, _ := gtk.ListBoxRowNew()
-	row.SetHAlign(gtk.ALIGN_START)
-	row.Add(label)
-	app.Window.WhiteListTab.TCPListBox.Add(row)
-	row.ShowAll()
-	app.Window.WhiteListTab.TCPEntry.SetText("")
-	return nil
+	return addPort(app, EntryTCP, app.Window.WhiteListTab.TCPEntry)
 }
 
+// TCPRemoveButtonClicked is invoked whenever the TCP 'Remove' button on the
+// 'Whitelist' tab is clicked.
 func TCPRemoveButtonClicked(app *Application) error {
-	row := app.Window.WhiteListTab.TCPListBox.GetSelectedRow()
-	if row != nil {
-		app.Window.WhiteListTab.TCPListBox.Remove(row)
+	removeEntry(app, EntryTCP, app.Window.WhiteListTab.TCPListBox)
+	return nil
+}
+
+// TCPSuggestButtonClicked is invoked whenever the TCP 'Suggest' button on the
+// 'Whitelist' tab is clicked.
+func TCPSuggestButtonClicked(app *Application) error {
+	return suggestPorts(app, EntryTCP)
+}
+
+// WhitelistSimplifyButtonClicked is invoked whenever the 'Simplify' button on
+// the 'Whitelist' tab is clicked. Invalid and redundant subnets are removed,
+// and the remaining subnets are written in their canonical form.
+func WhitelistSimplifyButtonClicked(app *Application) error {
+	if app.refuseLocked(entryField(EntrySubnet), "The whitelisted subnets") {
+		return errSettingLocked
+	}
+
+	issues := app.Config.WhiteList.Normalise()
+	app.Config.SettingsChanged("WhiteList")
+	app.Window.WhiteListTab.Populate(app.Config.WhiteList)
+
+	if len(issues) > 0 {
+		app.Window.InfoBar.DisplayMessage("Simplified whitelist, resolving "+
+			strconv.Itoa(len(issues))+" issue(s)", gtk.MESSAGE_INFO)
 	}
 	return nil
 }
 
+// WhitelistApplyButtonClicked is invoked whenever the 'Apply' button on the
+// 'Whitelist' tab is clicked. The whitelist is simplified before its subnets
+// and ports are sent to the daemon, and it is saved to the config once the
+// daemon has accepted it.
 func WhitelistApplyButtonClicked(app *Application) error {
+	app.Config.SettingsChanged("WhiteList")
+	if len(app.Config.WhiteList.Normalise()) > 0 {
+		app.Window.WhiteListTab.Populate(app.Config.WhiteList)
+	}
+	applied := app.Config.WhiteList.Clone()
+	whiteList := applied.Proto(app.Presets)
+	client := app.Client
+
+	app.RunOperation("Applying whitelist...", func(context.Context) error {
+		return client.SetWhitelist(&pb.SetWhitelistRequest{
+			Whitelist: whiteList,
+		})
+	}, func(err error) {
+		if err != nil {
+			app.DisplayError("Unable to apply whitelist", err,
+				func() { _ = WhitelistApplyButtonClicked(app) })
+			return
+		}
+		app.whiteListApplied(applied)
 
-	err := app.Client.SetWhitelist(&pb.SetWhitelistRequest{
-		Whitelist: &pb.Whitelist{
-			Ports: &pb.Ports{
-				Udp: nil,
-				Tcp: nil,
-			},
-			Subnets: nil,
-		},
+		if err := SaveConfig(app); err != nil {
+			util.LogError("Unable to save config", err)
+			app.Window.InfoBar.DisplayMessage("Whitelist applied, but could "+
+				"not be saved: "+err.Error(), gtk.MESSAGE_WARNING)
+			return
+		}
+		app.Window.InfoBar.DisplayMessage("Whitelist applied",
+			gtk.MESSAGE_INFO)
 	})
 
+	return nil
+}
+
+// WhitelistSaveButtonClicked is invoked whenever the 'Save' button on the
+// 'Whitelist' tab is clicked. The whitelist is saved to the config without
+// being sent to the daemon.
+func WhitelistSaveButtonClicked(app *Application) error {
+	if err := SaveConfig(app); err != nil {
+		app.DisplaySaveError(err)
+		return err
+	}
+	return nil
+}
+
+// addPort validates the port or port range in the given entry, before adding
+// it to the whitelist. Ranges which overlap are merged, so the list boxes are
+// refilled from the whitelist afterwards.
+func addPort(app *Application, kind string, entry *gtk.Entry) error {
+	if app.refuseLocked(entryField(kind), "The whitelisted "+kind+" ports") {
+		return errSettingLocked
+	}
+
+	text, _ := entry.GetText()
+	portRange, err := whitelist.ParsePortRange(text)
 	if err != nil {
-		util.LogError("Unable to apply whitelist", err)
-		infoBar := app.Window.InfoBar
-		infoBar.Button.SetLabel("Dismiss")
-		infoBar.Button.Connect("clicked", infoBar.HideMessage)
-		infoBar.DisplayMessage("Unable to apply whitelist",
-			gtk.MESSAGE_ERROR)
+		app.Window.InfoBar.DisplayMessage("Invalid "+kind+" port: "+
+			err.Error(), gtk.MESSAGE_ERROR)
 		return err
 	}
 
+	whiteList := app.Config.WhiteList
+	if whiteList.Has(kind, portRange.String()) {
+		app.Window.InfoBar.DisplayMessage(kind+" port "+
+			portRange.String()+" is already whitelisted", gtk.MESSAGE_INFO)
+		return nil
+	}
+
+	whiteList.Add(kind, portRange.String(), app.Window.WhiteListTab.Lifetime())
+	app.Config.SettingsChanged("WhiteList")
+	app.Window.WhiteListTab.Populate(whiteList)
+	entry.SetText("")
 	return nil
 }
 
-func WhitelistSaveButtonClicked(app *Application) error {
+// removeEntry removes the entry selected in the list box from the whitelist.
+func removeEntry(app *Application, kind string, listBox *gtk.ListBox) {
+	row := listBox.GetSelectedRow()
+	if row == nil || app.refuseLocked(entryField(kind), "The whitelisted "+
+		kind+" ports") {
+		return
+	}
+
+	app.Config.WhiteList.Remove(kind, listBoxRowText(row))
+	app.Config.SettingsChanged("WhiteList")
+	app.Window.WhiteListTab.Populate(app.Config.WhiteList)
+}
+
+// suggestPorts offers the ports on which local services are listening for the
+// given protocol, excluding those which are already whitelisted, and adds the
+// ports chosen by the user to the whitelist.
+func suggestPorts(app *Application, protocol string) error {
+	if app.refuseLocked(entryField(protocol), "The whitelisted "+protocol+
+		" ports") {
+		return errSettingLocked
+	}
+
+	sockets, err := whitelist.ListeningSockets()
+	if err != nil {
+		util.LogError("Unable to list listening sockets", err)
+		app.Window.InfoBar.DisplayMessage("Unable to list listening sockets",
+			gtk.MESSAGE_ERROR)
+		return err
+	}
+
+	var suggestions []Suggestion
+	for _, socket := range sockets {
+		port := strconv.Itoa(int(socket.Port))
+		if socket.Protocol != protocol ||
+			app.Config.WhiteList.Has(protocol, port) {
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{
+			Value:       port,
+			Description: socket.Description(),
+		})
+	}
+
+	if len(suggestions) == 0 {
+		app.Window.InfoBar.DisplayMessage("No local services are listening "+
+			"on "+protocol+" ports that aren't already whitelisted",
+			gtk.MESSAGE_INFO)
+		return nil
+	}
+
+	selected := app.Window.SuggestionDialog.Run("Listening "+protocol+" Ports",
+		"Local services are listening on the following "+protocol+" ports. "+
+			"Choose which to add to the whitelist.", suggestions)
+	addSuggestions(app, protocol, selected)
 	return nil
 }
+
+// addSuggestions adds the suggestions chosen by the user to the whitelist.
+func addSuggestions(app *Application, kind string, selected []Suggestion) {
+	if len(selected) == 0 {
+		return
+	}
+
+	lifetime := app.Window.WhiteListTab.Lifetime()
+	for _, suggestion := range selected {
+		app.Config.WhiteList.Add(kind, suggestion.Value, lifetime)
+	}
+	app.Config.SettingsChanged("WhiteList")
+	app.Window.WhiteListTab.Populate(app.Config.WhiteList)
+}
+
+// portsContain reports whether any of ports contains every port in
+// portRange.
+func portsContain(ports []whitelist.PortRange,
+	portRange whitelist.PortRange) bool {
+	for _, existing := range ports {
+		if existing.Contains(portRange) {
+			return true
+		}
+	}
+	return false
+}
+
+// populatePresetListBox replaces the rows of the preset list box with a check
+// button for each preset in the catalogue, which enables or disables the
+// preset in the whitelist in use when toggled. Enabled presets which are no
+// longer in the catalogue are listed as unavailable, so that they can be
+// disabled.
+func populatePresetListBox(app *Application) {
+	whitelistTab := app.Window.WhiteListTab
+	presets := app.Presets
+	whiteList := app.Config.WhiteList
+	clearListBox(whitelistTab.PresetListBox)
+	controls := []lockableControl{whitelistTab.PresetListBox}
+
+	addPreset := func(name string, label string, tooltip string) {
+		checkButton, _ := gtk.CheckButtonNewWithLabel(label)
+		checkButton.SetTooltipText(tooltip)
+		checkButton.SetActive(containsString(whiteList.Presets, name))
+		controls = append(controls, checkButton)
+
+		reverting := false
+		checkButton.Connect("toggled", func() {
+			if reverting {
+				return
+			}
+			if app.refuseLocked("WhiteList.Presets", "The whitelist presets") {
+				reverting = true
+				checkButton.SetActive(!checkButton.GetActive())
+				reverting = false
+				return
+			}
+
+			app.Config.SettingsChanged("WhiteList")
+			if checkButton.GetActive() {
+				if !containsString(whiteList.Presets, name) {
+					whiteList.Presets = append(whiteList.Presets, name)
+				}
+				return
+			}
+
+			var enabled []string
+			for _, existing := range whiteList.Presets {
+				if existing != name {
+					enabled = append(enabled, existing)
+				}
+			}
+			whiteList.Presets = enabled
+		})
+
+		row, _ := gtk.ListBoxRowNew()
+		row.Add(checkButton)
+		whitelistTab.PresetListBox.Add(row)
+		row.ShowAll()
+	}
+
+	for _, preset := range presets.Presets() {
+		label := preset.Name
+		if preset.Description != "" {
+			label += "  (" + preset.Description + ")"
+		}
+		addPreset(preset.Name, label, preset.Summary())
+	}
+	for _, name := range whiteList.Presets {
+		if _, ok := presets.Lookup(name); !ok {
+			addPreset(name, name+"  (unavailable)",
+				"This preset is no longer defined")
+		}
+	}
+
+	whitelistTab.locks.replace("WhiteList.Presets", controls...)
+}
+
+// addListBoxRow appends a row containing a label with the given text to the
+// list box. The row is named after the text, so that it can be identified
+// regardless of how it is displayed.
+func addListBoxRow(listBox *gtk.ListBox, text string) {
+	label, _ := gtk.LabelNew(text)
+	row, _ := gtk.ListBoxRowNew()
+	row.SetName(text)
+	row.SetHAlign(gtk.ALIGN_START)
+	row.Add(label)
+	listBox.Add(row)
+	row.ShowAll()
+}
+
+// addEntryRow appends a row for the entry to the list box, followed by a dim
+// label for details such as its resolved addresses. The detail label is
+// returned so that it can be updated.
+func addEntryRow(listBox *gtk.ListBox, value string,
+	detail string) *gtk.Label {
+	label, _ := gtk.LabelNew(value)
+	detailLabel, _ := gtk.LabelNew(detail)
+	if style, err := detailLabel.GetStyleContext(); err == nil {
+		style.AddClass("dim-label")
+	}
+
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	box.PackStart(label, false, false, 0)
+	box.PackStart(detailLabel, false, false, 0)
+	row, _ := gtk.ListBoxRowNew()
+	row.SetName(value)
+	row.SetHAlign(gtk.ALIGN_START)
+	row.Add(box)
+	listBox.Add(row)
+	row.ShowAll()
+	return detailLabel
+}
+
+// listBoxRowText returns the text of a row created by addListBoxRow or
+// addEntryRow.
+func listBoxRowText(row *gtk.ListBoxRow) string {
+	name, _ := row.GetName()
+	return name
+}
+
+// containsString reports whether values contains value.
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+// portStrings formats each of the given port ranges.
+func portStrings(ports []whitelist.PortRange) []string {
+	texts := make([]string, len(ports))
+	for i, portRange := range ports {
+		texts[i] = portRange.String()
+	}
+	return texts
+}
+
+// clearListBox removes every row from the given list box.
+func clearListBox(listBox *gtk.ListBox) {
+	children := listBox.GetChildren()
+	if children == nil {
+		return
+	}
+
+	children.Foreach(func(item interface{}) {
+		listBox.Remove(item.(gtk.IWidget))
+	})
+}
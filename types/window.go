@@ -8,13 +8,20 @@ import (
 // Window contains the GTK components for the root GTKWindow.
 type Window struct {
 	Window       *gtk.Window
+	Notebook     *gtk.Notebook
 	InfoBar      *InfoBar
 	ConnectTab   *ConnectTab
 	SessionTab   *SessionTab
 	ConfigureTab *ConfigureTab
 	WhiteListTab *WhitelistTab
 	AccountTab   *AccountTab
+	MessagesTab  *MessagesTab
 	AboutTab     *AboutTab
+	DriftDialog  *DriftDialog
+
+	SuggestionDialog *SuggestionDialog
+	ProfileSwitcher  *ProfileSwitcher
+	ImportDialog     *ImportDialog
 }
 
 // BuildWindow constructs the root GTKWindow for the application.
@@ -22,14 +29,34 @@ func BuildWindow(builder *gtk.Builder) *Window {
 	window := util.BuilderGetWindow(builder, "main_window")
 	window.SetTitle(AppName)
 
+	infoBar := BuildInfoBar(builder)
+	messagesTab := BuildMessagesTab(builder)
+	infoBar.OnMessage(messagesTab.AddMessage)
+	messagesTab.ClearButton.Connect("clicked", func() {
+		infoBar.ClearHistory()
+		messagesTab.Clear()
+	})
+
 	return &Window{
 		Window:       window,
-		InfoBar:      BuildInfoBar(builder),
+		Notebook:     util.BuilderGetNotebook(builder, "main_notebook"),
+		InfoBar:      infoBar,
 		ConnectTab:   BuildConnectTab(builder),
 		SessionTab:   BuildSessionTab(builder),
 		ConfigureTab: BuildConfigureTab(builder),
 		WhiteListTab: BuildWhitelistTab(builder),
 		AccountTab:   BuildAccountTab(builder),
+		MessagesTab:  messagesTab,
 		AboutTab:     BuildAboutTab(builder),
+		DriftDialog:  BuildDriftDialog(builder),
+
+		SuggestionDialog: BuildSuggestionDialog(builder),
+		ProfileSwitcher:  BuildProfileSwitcher(builder),
+		ImportDialog:     BuildImportDialog(builder),
 	}
 }
+
+// ShowPage switches the notebook to the page containing the given widget.
+func (window Window) ShowPage(page gtk.IWidget) {
+	window.Notebook.SetCurrentPage(window.Notebook.PageNum(page))
+}
@@ -64,3 +64,61 @@ func BuilderGetListBox(builder *gtk.Builder, name string) *gtk.ListBox {
 	obj, _ := builder.GetObject(name)
 	return obj.(*gtk.ListBox)
 }
+
+// BuilderGetBox is a helper function for retrieving a generic GTK widget
+// from the builder and casting to a GTK Box.
+func BuilderGetBox(builder *gtk.Builder, name string) *gtk.Box {
+	obj, _ := builder.GetObject(name)
+	return obj.(*gtk.Box)
+}
+
+// BuilderGetSpinner is a helper function for retrieving a generic GTK widget
+// from the builder and casting to a GTK Spinner.
+func BuilderGetSpinner(builder *gtk.Builder, name string) *gtk.Spinner {
+	obj, _ := builder.GetObject(name)
+	return obj.(*gtk.Spinner)
+}
+
+// BuilderGetNotebook is a helper function for retrieving a generic GTK widget
+// from the builder and casting to a GTK Notebook.
+func BuilderGetNotebook(builder *gtk.Builder, name string) *gtk.Notebook {
+	obj, _ := builder.GetObject(name)
+	return obj.(*gtk.Notebook)
+}
+
+// BuilderGetGrid is a helper function for retrieving a generic GTK widget
+// from the builder and casting to a GTK Grid.
+func BuilderGetGrid(builder *gtk.Builder, name string) *gtk.Grid {
+	obj, _ := builder.GetObject(name)
+	return obj.(*gtk.Grid)
+}
+
+// BuilderGetCheckButton is a helper function for retrieving a generic GTK
+// widget from the builder and casting to a GTK Check Button.
+func BuilderGetCheckButton(builder *gtk.Builder,
+	name string) *gtk.CheckButton {
+	obj, _ := builder.GetObject(name)
+	return obj.(*gtk.CheckButton)
+}
+
+// BuilderGetDialog is a helper function for retrieving a generic GTK widget
+// from the builder and casting to a GTK Dialog.
+func BuilderGetDialog(builder *gtk.Builder, name string) *gtk.Dialog {
+	obj, _ := builder.GetObject(name)
+	return obj.(*gtk.Dialog)
+}
+
+// BuilderGetRadioButton is a helper function for retrieving a generic GTK
+// widget from the builder and casting to a GTK Radio Button.
+func BuilderGetRadioButton(builder *gtk.Builder,
+	name string) *gtk.RadioButton {
+	obj, _ := builder.GetObject(name)
+	return obj.(*gtk.RadioButton)
+}
+
+// BuilderGetTextView is a helper function for retrieving a generic GTK widget
+// from the builder and casting to a GTK Text View.
+func BuilderGetTextView(builder *gtk.Builder, name string) *gtk.TextView {
+	obj, _ := builder.GetObject(name)
+	return obj.(*gtk.TextView)
+}
@@ -0,0 +1,157 @@
+package whitelist
+
+import (
+	"net"
+	"strings"
+)
+
+// InterfaceKind classifies a network interface by what it connects to.
+type InterfaceKind int
+
+const (
+	// KindLAN is a physical interface, such as Ethernet or Wi-Fi.
+	KindLAN InterfaceKind = iota
+	// KindContainerBridge is a bridge created by a container runtime, such as
+	// Docker or Podman.
+	KindContainerBridge
+	// KindVMBridge is a bridge created by a hypervisor, such as libvirt or
+	// VirtualBox.
+	KindVMBridge
+	// KindVPNTunnel is a VPN tunnel, such as the one created by the NordVPN
+	// daemon.
+	KindVPNTunnel
+	// KindLoopback is the loopback interface.
+	KindLoopback
+)
+
+// String returns a human-readable name for the kind of interface.
+func (kind InterfaceKind) String() string {
+	switch kind {
+	case KindLAN:
+		return "Local network"
+	case KindContainerBridge:
+		return "Container bridge"
+	case KindVMBridge:
+		return "Virtual machine bridge"
+	case KindVPNTunnel:
+		return "VPN tunnel"
+	case KindLoopback:
+		return "Loopback"
+	default:
+		return "Unknown"
+	}
+}
+
+// Interface name prefixes used to classify interfaces.
+var (
+	vpnTunnelPrefixes = []string{"nordlynx", "nordtun", "tun", "wg", "ppp",
+		"ipsec", "utun", "proton", "mullvad", "tailscale", "zt"}
+	containerBridgePrefixes = []string{"docker", "br-", "podman", "cni",
+		"cali", "flannel", "lxcbr", "lxdbr", "veth", "kube"}
+	vmBridgePrefixes = []string{"virbr", "vnet", "vboxnet", "vmnet", "tap"}
+)
+
+// DetectedSubnet is a subnet to which the host is directly attached.
+type DetectedSubnet struct {
+	// Interface is the name of the interface attached to the subnet.
+	Interface string
+	Kind      InterfaceKind
+	// Subnet is the canonical CIDR of the subnet.
+	Subnet string
+}
+
+// DetectSubnets lists the subnets of the local networks, container bridges
+// and virtual machine bridges to which the host is attached. Interfaces which
+// are down, loopback interfaces and VPN tunnels are excluded, as are
+// link-local addresses.
+func DetectSubnets() ([]DetectedSubnet, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var detected []DetectedSubnet
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		kind := ClassifyInterface(iface)
+		if kind == KindVPNTunnel || kind == KindLoopback {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, subnet := range subnetsOf(addrs) {
+			detected = append(detected, DetectedSubnet{
+				Interface: iface.Name,
+				Kind:      kind,
+				Subnet:    subnet,
+			})
+		}
+	}
+	return detected, nil
+}
+
+// ClassifyInterface determines the kind of the given interface from its flags
+// and name.
+func ClassifyInterface(iface net.Interface) InterfaceKind {
+	switch {
+	case iface.Flags&net.FlagLoopback != 0:
+		return KindLoopback
+	case hasPrefix(iface.Name, vpnTunnelPrefixes):
+		return KindVPNTunnel
+	case hasPrefix(iface.Name, containerBridgePrefixes):
+		return KindContainerBridge
+	case hasPrefix(iface.Name, vmBridgePrefixes):
+		return KindVMBridge
+	case iface.Flags&net.FlagPointToPoint != 0 && len(iface.HardwareAddr) == 0:
+		// Tunnels have no hardware address, whatever they are named
+		return KindVPNTunnel
+	default:
+		return KindLAN
+	}
+}
+
+// subnetsOf returns the canonical CIDRs of the subnets containing the given
+// addresses, excluding link-local and loopback addresses.
+func subnetsOf(addrs []net.Addr) []string {
+	var subnets []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() || ipNet.IP.IsLoopback() {
+			continue
+		}
+
+		network := net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask}
+		subnet, err := ParseSubnet(network.String())
+		if err != nil || contains(subnets, subnet) {
+			continue
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets
+}
+
+// contains reports whether values contains value.
+func contains(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPrefix reports whether name begins with any of the given prefixes.
+func hasPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package whitelist
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ParseHostname validates a hostname, such as "nas.local", returning it in
+// lower case. Addresses are not hostnames, and are rejected, as are names
+// whose last label is numeric, such as "192.168.1.256", which are mistyped
+// addresses rather than hostnames.
+func ParseHostname(text string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(text), "."))
+	if name == "" {
+		return "", fmt.Errorf("no hostname specified")
+	}
+	if len(name) > 253 || net.ParseIP(name) != nil {
+		return "", fmt.Errorf("%q is not a valid hostname", text)
+	}
+
+	labels := strings.Split(name, ".")
+	for _, label := range labels {
+		if !validLabel(label) {
+			return "", fmt.Errorf("%q is not a valid hostname", text)
+		}
+	}
+	if isNumeric(labels[len(labels)-1]) {
+		return "", fmt.Errorf("%q is not a valid hostname", text)
+	}
+	return name, nil
+}
+
+// ResolveHostname looks up the addresses of a hostname using the system
+// resolver, which consults /etc/hosts as well as DNS. The addresses are
+// returned as sorted /32 and /128 subnets.
+func ResolveHostname(ctx context.Context, name string) ([]string, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets []string
+	for _, addr := range addrs {
+		// Link-local addresses are only meaningful with a zone, which the
+		// daemon does not accept
+		if addr.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		subnet := hostSubnet(addr.IP)
+		if !contains(subnets, subnet) {
+			subnets = append(subnets, subnet)
+		}
+	}
+	if len(subnets) == 0 {
+		return nil, fmt.Errorf("%s has no usable addresses", name)
+	}
+
+	sort.Strings(subnets)
+	return subnets, nil
+}
+
+// validLabel reports whether label is a valid DNS label: 1 to 63 letters,
+// digits, hyphens and underscores, which neither begins nor ends with a
+// hyphen. Underscores are not strictly valid, but are used by some devices.
+func validLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 ||
+		label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' ||
+			c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// isNumeric reports whether label consists only of digits.
+func isNumeric(label string) bool {
+	for _, c := range label {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
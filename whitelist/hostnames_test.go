@@ -0,0 +1,70 @@
+package whitelist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHostname(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"nas", "nas"},
+		{"nas.local", "nas.local"},
+		{"NAS.Local", "nas.local"},
+		{" printer.home.arpa ", "printer.home.arpa"},
+		{"nas.local.", "nas.local"},
+		{"my-nas.local", "my-nas.local"},
+		{"_printer.local", "_printer.local"},
+		{"host1.example.com", "host1.example.com"},
+		{"1password.example.com", "1password.example.com"},
+		{"192.168.1.x", "192.168.1.x"},
+		{strings.Repeat("a", 63) + ".nas", strings.Repeat("a", 63) + ".nas"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			got, err := ParseHostname(test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseHostnameRejects(t *testing.T) {
+	for _, text := range []string{
+		"",
+		" ",
+		".",
+		// Addresses are not hostnames
+		"192.168.1.10",
+		"2001:db8::1",
+		"::1",
+		// Nor are mistyped addresses
+		"192.168.1.256",
+		"10.0.0",
+		"1234",
+		"nas.local.1",
+		// Invalid labels
+		"nas..local",
+		".nas.local",
+		"-nas.local",
+		"nas-.local",
+		"nas local",
+		"nas.local/24",
+		"nás.local",
+		strings.Repeat("a", 64) + ".local",
+		strings.Repeat("a.", 127) + "local",
+	} {
+		t.Run(text, func(t *testing.T) {
+			if got, err := ParseHostname(text); err == nil {
+				t.Errorf("got %q, want an error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package whitelist
+
+import (
+	"net"
+	"strconv"
+)
+
+// IssueKind identifies the kind of problem found with a whitelisted subnet.
+type IssueKind int
+
+const (
+	// IssueInvalid indicates that the entry is not a valid subnet.
+	IssueInvalid IssueKind = iota
+	// IssueHostBits indicates that the subnet has bits set beyond its prefix,
+	// such as 192.168.1.5/24.
+	IssueHostBits
+	// IssueNotCanonical indicates that the subnet is valid, but is not written
+	// in its canonical form, such as a bare address or an IPv6 address with
+	// leading zeros.
+	IssueNotCanonical
+	// IssueDuplicate indicates that the subnet is equal to an earlier entry.
+	IssueDuplicate
+	// IssueSubsumed indicates that the subnet is contained within another
+	// entry, such as 192.168.1.0/24 within 192.168.0.0/16.
+	IssueSubsumed
+)
+
+// Issue describes a problem with a whitelisted subnet.
+type Issue struct {
+	// Entry is the subnet as it appears in the whitelist.
+	Entry string
+	Kind  IssueKind
+	// Related is the canonical form of the subnet for IssueHostBits and
+	// IssueNotCanonical, or the entry which makes it redundant for
+	// IssueDuplicate and IssueSubsumed.
+	Related string
+}
+
+// String describes the issue.
+func (issue Issue) String() string {
+	switch issue.Kind {
+	case IssueInvalid:
+		return issue.Entry + " is not a valid subnet"
+	case IssueHostBits:
+		return issue.Entry + " has host bits set, it is equivalent to " +
+			issue.Related
+	case IssueNotCanonical:
+		return issue.Entry + " can be written as " + issue.Related
+	case IssueDuplicate:
+		return issue.Entry + " is a duplicate of " + issue.Related
+	case IssueSubsumed:
+		return issue.Entry + " is already covered by " + issue.Related
+	default:
+		return issue.Entry + " has an unknown issue"
+	}
+}
+
+// subnet is a parsed whitelist entry.
+type subnet struct {
+	entry   string
+	network *net.IPNet
+}
+
+// canonical returns the subnet with its host bits cleared.
+func (s subnet) canonical() string {
+	ones, _ := s.network.Mask.Size()
+	return s.network.IP.String() + "/" + strconv.Itoa(ones)
+}
+
+// contains reports whether every address in other is also in s.
+func (s subnet) contains(other subnet) bool {
+	ones, bits := s.network.Mask.Size()
+	otherOnes, otherBits := other.network.Mask.Size()
+	return bits == otherBits && ones <= otherOnes &&
+		s.network.Contains(other.network.IP)
+}
+
+// NormaliseSubnets canonicalises the given subnets, and removes those which
+// are invalid, duplicated, or contained within another entry. The remaining
+// subnets keep their original order. The issues found along the way are
+// returned, and are empty if the subnets are already normalised.
+func NormaliseSubnets(subnets []string) ([]string, []Issue) {
+	var issues []Issue
+	var parsed []subnet
+	for _, entry := range subnets {
+		text, err := ParseSubnet(entry)
+		if err != nil {
+			issues = append(issues, Issue{Entry: entry, Kind: IssueInvalid})
+			continue
+		}
+
+		ip, network, _ := net.ParseCIDR(text)
+		s := subnet{entry: entry, network: network}
+		switch canonical := s.canonical(); {
+		case !ip.Equal(network.IP):
+			issues = append(issues, Issue{
+				Entry:   entry,
+				Kind:    IssueHostBits,
+				Related: canonical,
+			})
+		case canonical != entry:
+			issues = append(issues, Issue{
+				Entry:   entry,
+				Kind:    IssueNotCanonical,
+				Related: canonical,
+			})
+		}
+		parsed = append(parsed, s)
+	}
+
+	var normalised []string
+	for i, s := range parsed {
+		if issue, redundant := redundancy(s, i, parsed); redundant {
+			issues = append(issues, issue)
+			continue
+		}
+		normalised = append(normalised, s.canonical())
+	}
+	return normalised, issues
+}
+
+// CheckSubnets returns the issues which NormaliseSubnets would resolve.
+func CheckSubnets(subnets []string) []Issue {
+	_, issues := NormaliseSubnets(subnets)
+	return issues
+}
+
+// redundancy determines whether the i'th subnet is made redundant by another
+// subnet. Of several equal subnets, only the first is kept.
+func redundancy(s subnet, i int, subnets []subnet) (Issue, bool) {
+	for j, other := range subnets {
+		if i == j || !other.contains(s) {
+			continue
+		}
+
+		if s.contains(other) {
+			// The subnets are equal, so the later one is the duplicate
+			if j < i {
+				return Issue{
+					Entry:   s.entry,
+					Kind:    IssueDuplicate,
+					Related: other.entry,
+				}, true
+			}
+			continue
+		}
+
+		return Issue{
+			Entry:   s.entry,
+			Kind:    IssueSubsumed,
+			Related: other.entry,
+		}, true
+	}
+	return Issue{}, false
+}
+
+// Covers reports whether every address in the given subnet is already within
+// one of subnets. Invalid subnets are never covered.
+func Covers(subnets []string, entry string) bool {
+	text, err := ParseSubnet(entry)
+	if err != nil {
+		return false
+	}
+	_, network, _ := net.ParseCIDR(text)
+	candidate := subnet{entry: entry, network: network}
+
+	for _, existing := range subnets {
+		text, err := ParseSubnet(existing)
+		if err != nil {
+			continue
+		}
+		_, network, _ := net.ParseCIDR(text)
+		if (subnet{entry: existing, network: network}).contains(candidate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package whitelist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormaliseSubnets(t *testing.T) {
+	tests := []struct {
+		name    string
+		subnets []string
+		want    []string
+		issues  []Issue
+	}{
+		{
+			name:    "normalised",
+			subnets: []string{"10.0.0.0/8", "192.168.1.0/24", "2001:db8::/32"},
+			want:    []string{"10.0.0.0/8", "192.168.1.0/24", "2001:db8::/32"},
+		},
+		{
+			name:    "host bits",
+			subnets: []string{"192.168.1.5/24"},
+			want:    []string{"192.168.1.0/24"},
+			issues: []Issue{{
+				Entry:   "192.168.1.5/24",
+				Kind:    IssueHostBits,
+				Related: "192.168.1.0/24",
+			}},
+		},
+		{
+			name:    "bare addresses",
+			subnets: []string{"10.0.0.1", "2001:db8::1"},
+			want:    []string{"10.0.0.1/32", "2001:db8::1/128"},
+			issues: []Issue{
+				{
+					Entry:   "10.0.0.1",
+					Kind:    IssueNotCanonical,
+					Related: "10.0.0.1/32",
+				},
+				{
+					Entry:   "2001:db8::1",
+					Kind:    IssueNotCanonical,
+					Related: "2001:db8::1/128",
+				},
+			},
+		},
+		{
+			name:    "leading zeros",
+			subnets: []string{"2001:0db8::/32"},
+			want:    []string{"2001:db8::/32"},
+			issues: []Issue{{
+				Entry:   "2001:0db8::/32",
+				Kind:    IssueNotCanonical,
+				Related: "2001:db8::/32",
+			}},
+		},
+		{
+			name:    "IPv4-mapped",
+			subnets: []string{"::ffff:10.0.0.0/104"},
+			want:    []string{"10.0.0.0/8"},
+			issues: []Issue{{
+				Entry:   "::ffff:10.0.0.0/104",
+				Kind:    IssueNotCanonical,
+				Related: "10.0.0.0/8",
+			}},
+		},
+		{
+			name:    "duplicate",
+			subnets: []string{"10.0.0.0/8", "192.168.0.0/16", "10.0.0.0/8"},
+			want:    []string{"10.0.0.0/8", "192.168.0.0/16"},
+			issues: []Issue{{
+				Entry:   "10.0.0.0/8",
+				Kind:    IssueDuplicate,
+				Related: "10.0.0.0/8",
+			}},
+		},
+		{
+			name:    "duplicate once canonicalised",
+			subnets: []string{"10.0.0.0/8", "10.1.2.3/8"},
+			want:    []string{"10.0.0.0/8"},
+			issues: []Issue{
+				{
+					Entry:   "10.1.2.3/8",
+					Kind:    IssueHostBits,
+					Related: "10.0.0.0/8",
+				},
+				{
+					Entry:   "10.1.2.3/8",
+					Kind:    IssueDuplicate,
+					Related: "10.0.0.0/8",
+				},
+			},
+		},
+		{
+			name:    "contained in a later subnet",
+			subnets: []string{"192.168.1.0/24", "192.168.0.0/16"},
+			want:    []string{"192.168.0.0/16"},
+			issues: []Issue{{
+				Entry:   "192.168.1.0/24",
+				Kind:    IssueSubsumed,
+				Related: "192.168.0.0/16",
+			}},
+		},
+		{
+			name: "contained in an earlier subnet",
+			subnets: []string{
+				"2001:db8::/32",
+				"10.0.0.0/8",
+				"2001:db8:1::/48",
+				"10.0.0.1",
+			},
+			want: []string{"2001:db8::/32", "10.0.0.0/8"},
+			issues: []Issue{
+				{
+					Entry:   "10.0.0.1",
+					Kind:    IssueNotCanonical,
+					Related: "10.0.0.1/32",
+				},
+				{
+					Entry:   "2001:db8:1::/48",
+					Kind:    IssueSubsumed,
+					Related: "2001:db8::/32",
+				},
+				{
+					Entry:   "10.0.0.1",
+					Kind:    IssueSubsumed,
+					Related: "10.0.0.0/8",
+				},
+			},
+		},
+		{
+			name:    "families kept apart",
+			subnets: []string{"0.0.0.0/0", "::/0"},
+			want:    []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			name:    "invalid",
+			subnets: []string{"10.0.0.0/8", "nonsense", "10.0.0.0/33", ""},
+			want:    []string{"10.0.0.0/8"},
+			issues: []Issue{
+				{Entry: "nonsense", Kind: IssueInvalid},
+				{Entry: "10.0.0.0/33", Kind: IssueInvalid},
+				{Entry: "", Kind: IssueInvalid},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, issues := NormaliseSubnets(test.subnets)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(issues, test.issues) {
+				t.Errorf("got issues %v, want %v", issues, test.issues)
+			}
+			if checked := CheckSubnets(test.subnets); !reflect.DeepEqual(
+				checked, test.issues) {
+				t.Errorf("got %v from CheckSubnets, want %v", checked,
+					test.issues)
+			}
+
+			// Normalising is idempotent
+			again, issues := NormaliseSubnets(got)
+			if !reflect.DeepEqual(again, got) || len(issues) > 0 {
+				t.Errorf("normalising again gave %v with issues %v", again,
+					issues)
+			}
+		})
+	}
+}
+
+func TestIssueString(t *testing.T) {
+	tests := []struct {
+		issue Issue
+		want  string
+	}{
+		{
+			Issue{Entry: "nonsense", Kind: IssueInvalid},
+			"nonsense is not a valid subnet",
+		},
+		{
+			Issue{
+				Entry:   "192.168.1.5/24",
+				Kind:    IssueHostBits,
+				Related: "192.168.1.0/24",
+			},
+			"192.168.1.5/24 has host bits set, it is equivalent to " +
+				"192.168.1.0/24",
+		},
+		{
+			Issue{
+				Entry:   "10.0.0.1",
+				Kind:    IssueNotCanonical,
+				Related: "10.0.0.1/32",
+			},
+			"10.0.0.1 can be written as 10.0.0.1/32",
+		},
+		{
+			Issue{
+				Entry:   "10.0.0.0/8",
+				Kind:    IssueDuplicate,
+				Related: "10.0.0.0/8",
+			},
+			"10.0.0.0/8 is a duplicate of 10.0.0.0/8",
+		},
+		{
+			Issue{
+				Entry:   "192.168.1.0/24",
+				Kind:    IssueSubsumed,
+				Related: "192.168.0.0/16",
+			},
+			"192.168.1.0/24 is already covered by 192.168.0.0/16",
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.issue.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	subnets := []string{"192.168.0.0/16", "nonsense", "2001:db8::/32"}
+	tests := []struct {
+		entry string
+		want  bool
+	}{
+		{"192.168.1.0/24", true},
+		{"192.168.1.5", true},
+		{"192.168.0.0/16", true},
+		{"192.0.0.0/8", false},
+		{"10.0.0.1", false},
+		{"2001:db8:1::/48", true},
+		{"::ffff:192.168.1.1", true},
+		{"nonsense", false},
+	}
+
+	for _, test := range tests {
+		if got := Covers(subnets, test.entry); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.entry, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package whitelist
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports. A single port is represented by a
+// range whose Start and End are equal.
+type PortRange struct {
+	Start uint32
+	End   uint32
+}
+
+// SinglePort returns the range containing only the given port.
+func SinglePort(port uint32) PortRange {
+	return PortRange{Start: port, End: port}
+}
+
+// ParsePortRange validates a single port, such as "22", or a range of ports,
+// such as "8000-8100".
+func ParsePortRange(text string) (PortRange, error) {
+	text = strings.TrimSpace(text)
+	// Accept the en dash, which is commonly used when writing ranges
+	text = strings.Replace(text, "–", "-", 1)
+
+	separator := strings.Index(text, "-")
+	if separator < 0 {
+		port, err := ParsePort(text)
+		if err != nil {
+			return PortRange{}, err
+		}
+		return SinglePort(port), nil
+	}
+
+	start, err := ParsePort(text[:separator])
+	if err != nil {
+		return PortRange{}, err
+	}
+	end, err := ParsePort(text[separator+1:])
+	if err != nil {
+		return PortRange{}, err
+	}
+	if start > end {
+		return PortRange{}, fmt.Errorf("%q is not a valid port range, the "+
+			"first port must not be greater than the last", text)
+	}
+	return PortRange{Start: start, End: end}, nil
+}
+
+// String returns the port, or the first and last ports of the range separated
+// by a hyphen.
+func (portRange PortRange) String() string {
+	if portRange.Start == portRange.End {
+		return strconv.FormatUint(uint64(portRange.Start), 10)
+	}
+	return strconv.FormatUint(uint64(portRange.Start), 10) + "-" +
+		strconv.FormatUint(uint64(portRange.End), 10)
+}
+
+// Contains reports whether every port in other is also in the range.
+func (portRange PortRange) Contains(other PortRange) bool {
+	return portRange.Start <= other.Start && other.End <= portRange.End
+}
+
+// MarshalJSON encodes a single port as a number, and a range as a string such
+// as "8000-8100".
+func (portRange PortRange) MarshalJSON() ([]byte, error) {
+	if portRange.Start == portRange.End {
+		return json.Marshal(portRange.Start)
+	}
+	return json.Marshal(portRange.String())
+}
+
+// UnmarshalJSON decodes a port or range encoded by MarshalJSON. Plain numbers
+// are accepted so that configs written before ranges were supported can still
+// be read.
+func (portRange *PortRange) UnmarshalJSON(data []byte) error {
+	var port uint32
+	if err := json.Unmarshal(data, &port); err == nil {
+		if port < MinPort || port > MaxPort {
+			return fmt.Errorf("%d is not a valid port, ports must be "+
+				"between %d and %d", port, MinPort, MaxPort)
+		}
+		*portRange = SinglePort(port)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("port must be a number or a string: %w", err)
+	}
+
+	parsed, err := ParsePortRange(text)
+	if err != nil {
+		return err
+	}
+	*portRange = parsed
+	return nil
+}
+
+// MergePortRanges sorts the given ranges, merging any which overlap or are
+// adjacent to each other.
+func MergePortRanges(ranges []PortRange) []PortRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sorted := make([]PortRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	merged := []PortRange{sorted[0]}
+	for _, next := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if next.Start <= last.End+1 {
+			if next.End > last.End {
+				last.End = next.End
+			}
+			continue
+		}
+		merged = append(merged, next)
+	}
+	return merged
+}
+
+// ExpandPorts lists every port within the given ranges, in ascending order and
+// without duplicates. The daemon only accepts individual ports, so ranges are
+// expanded before being sent to it.
+func ExpandPorts(ranges []PortRange) []int32 {
+	var ports []int32
+	for _, portRange := range MergePortRanges(ranges) {
+		for port := portRange.Start; port <= portRange.End; port++ {
+			ports = append(ports, int32(port))
+		}
+	}
+	return ports
+}
@@ -0,0 +1,204 @@
+package whitelist
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		text string
+		want PortRange
+	}{
+		{"22", SinglePort(22)},
+		{" 443 ", SinglePort(443)},
+		{"1", SinglePort(1)},
+		{"65535", SinglePort(65535)},
+		{"8000-8100", PortRange{Start: 8000, End: 8100}},
+		{"8000 - 8100", PortRange{Start: 8000, End: 8100}},
+		{"8000–8100", PortRange{Start: 8000, End: 8100}},
+		{"53-53", SinglePort(53)},
+		{"1-65535", PortRange{Start: 1, End: 65535}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			got, err := ParsePortRange(test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParsePortRangeRejects(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"0",
+		"65536",
+		"99999999999",
+		"-1",
+		"http",
+		"22.5",
+		"8100-8000",
+		"0-100",
+		"100-65536",
+		"100-",
+		"-100",
+		"1-2-3",
+	} {
+		t.Run(text, func(t *testing.T) {
+			if got, err := ParsePortRange(text); err == nil {
+				t.Errorf("got %v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestPortRangeString(t *testing.T) {
+	for _, text := range []string{"22", "8000-8100"} {
+		portRange, err := ParsePortRange(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := portRange.String(); got != text {
+			t.Errorf("got %q, want %q", got, text)
+		}
+	}
+}
+
+func TestPortRangeJSON(t *testing.T) {
+	ranges := []PortRange{SinglePort(53), {Start: 8000, End: 8100}}
+	data, err := json.Marshal(ranges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[53,"8000-8100"]` {
+		t.Errorf("got %s, want [53,\"8000-8100\"]", data)
+	}
+
+	var decoded []PortRange
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, ranges) {
+		t.Errorf("got %v, want %v", decoded, ranges)
+	}
+
+	for _, invalid := range []string{`0`, `65536`, `"0-10"`, `true`} {
+		var portRange PortRange
+		if err := json.Unmarshal([]byte(invalid), &portRange); err == nil {
+			t.Errorf("%s was decoded as %v, want an error", invalid,
+				portRange)
+		}
+	}
+}
+
+func TestMergePortRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []PortRange
+		want   []PortRange
+	}{
+		{
+			name:   "empty",
+			ranges: nil,
+			want:   nil,
+		},
+		{
+			name:   "single",
+			ranges: []PortRange{SinglePort(22)},
+			want:   []PortRange{SinglePort(22)},
+		},
+		{
+			name:   "unsorted",
+			ranges: []PortRange{SinglePort(443), SinglePort(22)},
+			want:   []PortRange{SinglePort(22), SinglePort(443)},
+		},
+		{
+			name: "overlapping",
+			ranges: []PortRange{
+				{Start: 8000, End: 8100},
+				{Start: 8050, End: 8200},
+			},
+			want: []PortRange{{Start: 8000, End: 8200}},
+		},
+		{
+			name: "adjacent",
+			ranges: []PortRange{
+				{Start: 8000, End: 8100},
+				{Start: 8101, End: 8200},
+			},
+			want: []PortRange{{Start: 8000, End: 8200}},
+		},
+		{
+			name: "separated by one port",
+			ranges: []PortRange{
+				{Start: 8000, End: 8100},
+				{Start: 8102, End: 8200},
+			},
+			want: []PortRange{
+				{Start: 8000, End: 8100},
+				{Start: 8102, End: 8200},
+			},
+		},
+		{
+			name: "contained",
+			ranges: []PortRange{
+				{Start: 1000, End: 2000},
+				SinglePort(1500),
+				{Start: 1200, End: 1300},
+			},
+			want: []PortRange{{Start: 1000, End: 2000}},
+		},
+		{
+			name:   "duplicates",
+			ranges: []PortRange{SinglePort(22), SinglePort(22)},
+			want:   []PortRange{SinglePort(22)},
+		},
+		{
+			name: "unsorted chain",
+			ranges: []PortRange{
+				SinglePort(3),
+				{Start: 10, End: 20},
+				SinglePort(1),
+				SinglePort(2),
+				{Start: 21, End: 65535},
+			},
+			want: []PortRange{
+				{Start: 1, End: 3},
+				{Start: 10, End: 65535},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := append([]PortRange(nil), test.ranges...)
+			got := MergePortRanges(test.ranges)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(test.ranges, original) {
+				t.Errorf("the ranges given were modified to %v",
+					test.ranges)
+			}
+		})
+	}
+}
+
+func TestExpandPorts(t *testing.T) {
+	got := ExpandPorts([]PortRange{
+		{Start: 65533, End: 65535},
+		SinglePort(22),
+		{Start: 21, End: 23},
+	})
+	want := []int32{21, 22, 23, 65533, 65534, 65535}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
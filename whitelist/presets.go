@@ -0,0 +1,154 @@
+package whitelist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Preset is a named group of subnets and ports which are whitelisted
+// together, such as those needed by a particular service.
+type Preset struct {
+	Name        string
+	Description string
+	Subnets     []string
+	UDPPorts    []PortRange
+	TCPPorts    []PortRange
+}
+
+// Summary lists the subnets and ports whitelisted by the preset.
+func (preset Preset) Summary() string {
+	var lines []string
+	if len(preset.Subnets) > 0 {
+		lines = append(lines, "Subnets: "+strings.Join(preset.Subnets, ", "))
+	}
+	if len(preset.UDPPorts) > 0 {
+		lines = append(lines, "UDP: "+joinPorts(preset.UDPPorts))
+	}
+	if len(preset.TCPPorts) > 0 {
+		lines = append(lines, "TCP: "+joinPorts(preset.TCPPorts))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validate checks that the preset is named and that its subnets are valid.
+func (preset Preset) validate() error {
+	if preset.Name == "" {
+		return fmt.Errorf("preset has no name")
+	}
+	for _, subnet := range preset.Subnets {
+		if _, err := ParseSubnet(subnet); err != nil {
+			return fmt.Errorf("preset %q: %w", preset.Name, err)
+		}
+	}
+	return nil
+}
+
+// BuiltinPresets returns the presets bundled with the application.
+func BuiltinPresets() []Preset {
+	return []Preset{
+		{
+			Name:        "mDNS / DLNA",
+			Description: "Local service discovery and media streaming",
+			Subnets: []string{"224.0.0.251/32", "239.255.255.250/32",
+				"ff02::fb/128", "ff02::c/128"},
+			UDPPorts: []PortRange{SinglePort(1900), SinglePort(5353)},
+			TCPPorts: []PortRange{SinglePort(8200)},
+		},
+		{
+			Name:        "CUPS Printing",
+			Description: "Network printers and shared printers",
+			UDPPorts:    []PortRange{SinglePort(631)},
+			TCPPorts: []PortRange{SinglePort(515), SinglePort(631),
+				SinglePort(9100)},
+		},
+		{
+			Name:        "SSH",
+			Description: "Remote logins to this computer",
+			TCPPorts:    []PortRange{SinglePort(22)},
+		},
+		{
+			Name:        "KDE Connect",
+			Description: "Pairing with phones and other devices",
+			UDPPorts:    []PortRange{{Start: 1714, End: 1764}},
+			TCPPorts:    []PortRange{{Start: 1714, End: 1764}},
+		},
+		{
+			Name:        "Steam In-Home Streaming",
+			Description: "Streaming games between computers on the network",
+			UDPPorts:    []PortRange{{Start: 27031, End: 27036}},
+			TCPPorts:    []PortRange{{Start: 27036, End: 27037}},
+		},
+	}
+}
+
+// Catalogue is an ordered collection of presets, looked up by name.
+type Catalogue struct {
+	presets []Preset
+}
+
+// NewCatalogue creates a catalogue of the builtin presets, extended with the
+// user's presets. A user preset with the same name as a builtin preset
+// replaces it.
+func NewCatalogue(builtin []Preset, user []Preset) *Catalogue {
+	catalogue := &Catalogue{}
+	for _, preset := range builtin {
+		catalogue.add(preset)
+	}
+	for _, preset := range user {
+		catalogue.add(preset)
+	}
+	return catalogue
+}
+
+// Presets returns the presets in the catalogue.
+func (catalogue *Catalogue) Presets() []Preset {
+	presets := make([]Preset, len(catalogue.presets))
+	copy(presets, catalogue.presets)
+	return presets
+}
+
+// Lookup returns the preset with the given name.
+func (catalogue *Catalogue) Lookup(name string) (Preset, bool) {
+	for _, preset := range catalogue.presets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
+
+// add appends the preset, or replaces the preset with the same name.
+func (catalogue *Catalogue) add(preset Preset) {
+	for i, existing := range catalogue.presets {
+		if existing.Name == preset.Name {
+			catalogue.presets[i] = preset
+			return
+		}
+	}
+	catalogue.presets = append(catalogue.presets, preset)
+}
+
+// ReadPresets decodes a JSON array of presets, such as a user's preset file.
+func ReadPresets(reader io.Reader) ([]Preset, error) {
+	var presets []Preset
+	if err := json.NewDecoder(reader).Decode(&presets); err != nil {
+		return nil, err
+	}
+	for _, preset := range presets {
+		if err := preset.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return presets, nil
+}
+
+// joinPorts formats the given port ranges as a comma-separated list.
+func joinPorts(ports []PortRange) string {
+	texts := make([]string, len(ports))
+	for i, portRange := range ports {
+		texts[i] = portRange.String()
+	}
+	return strings.Join(texts, ", ")
+}
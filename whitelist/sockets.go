@@ -0,0 +1,247 @@
+package whitelist
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Socket protocols, matching the names of the whitelist's port lists.
+const (
+	ProtocolTCP = "TCP"
+	ProtocolUDP = "UDP"
+)
+
+// Socket states, as listed in /proc/net.
+const (
+	tcpListen = "0A"
+	udpClose  = "07"
+)
+
+// ListeningSocket is a port on which a local process accepts connections from
+// other hosts.
+type ListeningSocket struct {
+	Protocol string
+	Port     uint32
+	// Processes are the names of the processes which own the socket. It is
+	// empty if the owning processes could not be determined, which is the
+	// case for processes owned by other users unless running as root.
+	Processes []string
+}
+
+// Description returns the names of the processes owning the socket, or
+// "unknown process" if they are not known.
+func (socket ListeningSocket) Description() string {
+	if len(socket.Processes) == 0 {
+		return "unknown process"
+	}
+	return strings.Join(socket.Processes, ", ")
+}
+
+// ListeningSockets lists the TCP and UDP ports which are listening on a
+// non-loopback address, sorted by protocol and port. Sockets listening on
+// both IPv4 and IPv6 are only listed once.
+func ListeningSockets() ([]ListeningSocket, error) {
+	return listeningSockets("/proc")
+}
+
+// listeningSockets lists the listening sockets described by the proc
+// filesystem mounted at procRoot.
+func listeningSockets(procRoot string) ([]ListeningSocket, error) {
+	tables := []struct {
+		name     string
+		protocol string
+		state    string
+	}{
+		{"tcp", ProtocolTCP, tcpListen},
+		{"tcp6", ProtocolTCP, tcpListen},
+		{"udp", ProtocolUDP, udpClose},
+		{"udp6", ProtocolUDP, udpClose},
+	}
+
+	type key struct {
+		protocol string
+		port     uint32
+	}
+	inodes := make(map[key][]uint64)
+	found := false
+	for _, table := range tables {
+		file, err := os.Open(filepath.Join(procRoot, "net", table.name))
+		if err != nil {
+			// IPv6 may be disabled, in which case only the IPv4 tables exist
+			continue
+		}
+		entries, err := parseSocketTable(file, table.state)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse /proc/net/%s: %w",
+				table.name, err)
+		}
+
+		found = true
+		for _, entry := range entries {
+			k := key{table.protocol, entry.port}
+			inodes[k] = append(inodes[k], entry.inode)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unable to read %s",
+			filepath.Join(procRoot, "net"))
+	}
+
+	processes := socketProcesses(procRoot)
+	var sockets []ListeningSocket
+	for k, socketInodes := range inodes {
+		socket := ListeningSocket{Protocol: k.protocol, Port: k.port}
+		for _, inode := range socketInodes {
+			for _, process := range processes[inode] {
+				if !contains(socket.Processes, process) {
+					socket.Processes = append(socket.Processes, process)
+				}
+			}
+		}
+		sort.Strings(socket.Processes)
+		sockets = append(sockets, socket)
+	}
+
+	sort.Slice(sockets, func(i, j int) bool {
+		if sockets[i].Protocol != sockets[j].Protocol {
+			return sockets[i].Protocol < sockets[j].Protocol
+		}
+		return sockets[i].Port < sockets[j].Port
+	})
+	return sockets, nil
+}
+
+// socketEntry is a socket listed in a /proc/net table.
+type socketEntry struct {
+	port  uint32
+	inode uint64
+}
+
+// parseSocketTable parses a table in the format of /proc/net/tcp, returning
+// the sockets in the given state which are bound to a non-loopback address
+// and are not connected to a remote host.
+func parseSocketTable(reader io.Reader, state string) ([]socketEntry, error) {
+	scanner := bufio.NewScanner(reader)
+	// Skip the header
+	scanner.Scan()
+
+	var entries []socketEntry
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+
+		ip, port, err := parseSocketAddress(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		_, remotePort, err := parseSocketAddress(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		if ip.IsLoopback() || remotePort != 0 || port == 0 {
+			continue
+		}
+
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inode %q", fields[9])
+		}
+		entries = append(entries, socketEntry{port: port, inode: inode})
+	}
+	return entries, scanner.Err()
+}
+
+// parseSocketAddress parses an address such as "0100007F:0016". The address
+// is written as hexadecimal 32-bit words in host byte order, and the port in
+// hexadecimal.
+func parseSocketAddress(text string) (net.IP, uint32, error) {
+	separator := strings.Index(text, ":")
+	if separator < 0 {
+		return nil, 0, fmt.Errorf("invalid socket address %q", text)
+	}
+
+	raw, err := hex.DecodeString(text[:separator])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid socket address %q", text)
+	}
+	port, err := strconv.ParseUint(text[separator+1:], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid socket port %q", text)
+	}
+
+	// Each 32-bit word is little-endian on the architectures supported by
+	// the NordVPN daemon
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		for i := 0; i < 4; i++ {
+			ip[word+i] = raw[word+3-i]
+		}
+	}
+	return ip, uint32(port), nil
+}
+
+// socketProcesses maps socket inodes to the names of the processes which have
+// them open. Processes whose file descriptors cannot be read are skipped.
+func socketProcesses(procRoot string) map[uint64][]string {
+	processes := make(map[uint64][]string)
+
+	dirs, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return processes
+	}
+	for _, dir := range dirs {
+		if _, err := strconv.Atoi(dir.Name()); err != nil {
+			continue
+		}
+
+		pidDir := filepath.Join(procRoot, dir.Name())
+		fds, err := ioutil.ReadDir(filepath.Join(pidDir, "fd"))
+		if err != nil {
+			continue
+		}
+
+		var name string
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(pidDir, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(
+				strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"),
+				10, 64)
+			if err != nil {
+				continue
+			}
+
+			if name == "" {
+				name = processName(pidDir)
+			}
+			if !contains(processes[inode], name) {
+				processes[inode] = append(processes[inode], name)
+			}
+		}
+	}
+	return processes
+}
+
+// processName returns the name of the process whose /proc directory is
+// given.
+func processName(pidDir string) string {
+	comm, err := ioutil.ReadFile(filepath.Join(pidDir, "comm"))
+	if err != nil {
+		return "pid " + filepath.Base(pidDir)
+	}
+	return strings.TrimSpace(string(comm))
+}
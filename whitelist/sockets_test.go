@@ -0,0 +1,206 @@
+package whitelist
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const socketTableHeader = "  sl  local_address rem_address   st tx_queue " +
+	"rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+// tcpTable lists sshd on every address, CUPS on the loopback address, a web
+// server on 192.168.1.10, and an established outgoing connection.
+const tcpTable = socketTableHeader +
+	"   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 " +
+	"00000000     0        0 1001 1 0000000000000000 100 0 0 10 0\n" +
+	"   1: 0100007F:0277 00000000:0000 0A 00000000:00000000 00:00000000 " +
+	"00000000     0        0 1002 1 0000000000000000 100 0 0 10 0\n" +
+	"   2: 0A01A8C0:1F90 00000000:0000 0A 00000000:00000000 00:00000000 " +
+	"00000000  1000        0 1003 1 0000000000000000 100 0 0 10 0\n" +
+	"   3: 0A01A8C0:D431 5DB8D822:01BB 01 00000000:00000000 00:00000000 " +
+	"00000000  1000        0 1004 1 0000000000000000 20 4 30 10 -1\n"
+
+// tcp6Table lists sshd on every address, a development server on the
+// loopback address, and a listening socket still connected to a remote host.
+const tcp6Table = socketTableHeader +
+	"   0: 00000000000000000000000000000000:0016 " +
+	"00000000000000000000000000000000:0000 0A 00000000:00000000 " +
+	"00:00000000 00000000     0        0 2001 1 " +
+	"0000000000000000 100 0 0 10 0\n" +
+	"   1: 00000000000000000000000001000000:0BB8 " +
+	"00000000000000000000000000000000:0000 0A 00000000:00000000 " +
+	"00:00000000 00000000  1000        0 2002 1 " +
+	"0000000000000000 100 0 0 10 0\n" +
+	"   2: 00000000000000000000000000000000:1389 " +
+	"B80D0120000000000000000001000000:C350 0A 00000000:00000000 " +
+	"00:00000000 00000000  1000        0 2003 1 " +
+	"0000000000000000 100 0 0 10 0\n"
+
+// udpTable lists a DNS server on every address and an unbound socket.
+const udpTable = socketTableHeader +
+	"  10: 00000000:0035 00000000:0000 07 00000000:00000000 00:00000000 " +
+	"00000000     0        0 3001 2 0000000000000000 0\n" +
+	"  11: 00000000:0000 00000000:0000 07 00000000:00000000 00:00000000 " +
+	"00000000     0        0 3002 2 0000000000000000 0\n"
+
+func TestParseSocketTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		state string
+		want  []socketEntry
+	}{
+		{
+			name:  "tcp",
+			table: tcpTable,
+			state: tcpListen,
+			want:  []socketEntry{{22, 1001}, {8080, 1003}},
+		},
+		{
+			name:  "tcp6",
+			table: tcp6Table,
+			state: tcpListen,
+			want:  []socketEntry{{22, 2001}},
+		},
+		{
+			name:  "udp",
+			table: udpTable,
+			state: udpClose,
+			want:  []socketEntry{{53, 3001}},
+		},
+		{
+			name:  "other state",
+			table: tcpTable,
+			state: udpClose,
+		},
+		{
+			name:  "header only",
+			table: socketTableHeader,
+			state: tcpListen,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := parseSocketTable(strings.NewReader(test.table),
+				test.state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, test.want) {
+				t.Errorf("got %v, want %v", entries, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSocketTableRejects(t *testing.T) {
+	for _, line := range []string{
+		"   0: 0000000:0016 00000000:0000 0A 0 0 0 0 0 1001",
+		"   0: 00000000:0016 00000000 0A 0 0 0 0 0 1001",
+		"   0: 00000000:1FFFF 00000000:0000 0A 0 0 0 0 0 1001",
+		"   0: 00000000:0016 00000000:0000 0A 0 0 0 0 0 inode",
+	} {
+		reader := strings.NewReader(socketTableHeader + line + "\n")
+		if entries, err := parseSocketTable(reader, tcpListen); err == nil {
+			t.Errorf("%q was parsed as %v, want an error", line, entries)
+		}
+	}
+}
+
+func TestParseSocketAddress(t *testing.T) {
+	tests := []struct {
+		text string
+		ip   net.IP
+		port uint32
+	}{
+		{"0100007F:0016", net.ParseIP("127.0.0.1"), 22},
+		{"0A01A8C0:1F90", net.ParseIP("192.168.1.10"), 8080},
+		{"00000000000000000000000001000000:0BB8", net.ParseIP("::1"), 3000},
+		{"B80D0120000000000000000001000000:FFFF",
+			net.ParseIP("2001:db8::1"), 65535},
+	}
+
+	for _, test := range tests {
+		ip, port, err := parseSocketAddress(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		if !ip.Equal(test.ip) || port != test.port {
+			t.Errorf("%s: got %v port %d, want %v port %d", test.text, ip,
+				port, test.ip, test.port)
+		}
+	}
+}
+
+// writeProcFile writes a file of the fake proc filesystem at root.
+func writeProcFile(t *testing.T, root string, name string, data string) {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// linkSocket opens the socket with the given inode as a file descriptor of
+// the process with the given pid, in the fake proc filesystem at root.
+func linkSocket(t *testing.T, root string, pid string, fd string,
+	inode string) {
+	t.Helper()
+	dir := filepath.Join(root, pid, "fd")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.Symlink("socket:["+inode+"]", filepath.Join(dir, fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListeningSockets(t *testing.T) {
+	root := t.TempDir()
+	writeProcFile(t, root, "net/tcp", tcpTable)
+	writeProcFile(t, root, "net/tcp6", tcp6Table)
+	writeProcFile(t, root, "net/udp", udpTable)
+	writeProcFile(t, root, "100/comm", "sshd\n")
+	linkSocket(t, root, "100", "3", "1001")
+	linkSocket(t, root, "100", "4", "2001")
+	writeProcFile(t, root, "200/comm", "dnsmasq\n")
+	linkSocket(t, root, "200", "5", "3001")
+	// Only the numbered directories are processes, and the web server
+	// belongs to a process which cannot be inspected
+	writeProcFile(t, root, "self/comm", "nordvpn-gtk\n")
+
+	sockets, err := listeningSockets(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ListeningSocket{
+		// sshd is listed once for both IPv4 and IPv6
+		{Protocol: ProtocolTCP, Port: 22, Processes: []string{"sshd"}},
+		{Protocol: ProtocolTCP, Port: 8080},
+		{Protocol: ProtocolUDP, Port: 53, Processes: []string{"dnsmasq"}},
+	}
+	if !reflect.DeepEqual(sockets, want) {
+		t.Errorf("got %v, want %v", sockets, want)
+	}
+	if description := sockets[1].Description(); description !=
+		"unknown process" {
+		t.Errorf("got description %q, want \"unknown process\"",
+			description)
+	}
+}
+
+func TestListeningSocketsMissingTables(t *testing.T) {
+	if sockets, err := listeningSockets(t.TempDir()); err == nil {
+		t.Errorf("got %v, want an error", sockets)
+	}
+}
@@ -0,0 +1,74 @@
+// Package whitelist validates the subnets and ports which may be whitelisted
+// by the NordVPN daemon.
+package whitelist
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// MinPort and MaxPort are the lowest and highest ports which may be
+// whitelisted.
+const (
+	MinPort = 1
+	MaxPort = 65535
+)
+
+// ParseSubnet validates an IPv4 or IPv6 subnet in CIDR notation, returning it
+// in its canonical textual form. A bare address is treated as a subnet
+// containing only that address.
+func ParseSubnet(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("no subnet specified")
+	}
+
+	if !strings.Contains(text, "/") {
+		ip := net.ParseIP(text)
+		if ip == nil {
+			return "", fmt.Errorf("%q is not a valid IP address or subnet",
+				text)
+		}
+		return hostSubnet(ip), nil
+	}
+
+	ip, network, err := net.ParseCIDR(text)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid subnet", text)
+	}
+
+	ones, bits := network.Mask.Size()
+	if ip.To4() != nil && bits == 8*net.IPv6len {
+		// IPv4-mapped IPv6 subnets are written as IPv4 subnets
+		if ones < 8*(net.IPv6len-net.IPv4len) {
+			return "", fmt.Errorf("%q is not a valid subnet", text)
+		}
+		ones -= 8 * (net.IPv6len - net.IPv4len)
+	}
+	return ip.String() + "/" + strconv.Itoa(ones), nil
+}
+
+// ParsePort validates a port number.
+func ParsePort(text string) (uint32, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, fmt.Errorf("no port specified")
+	}
+
+	port, err := strconv.ParseUint(text, 10, 32)
+	if err != nil || port < MinPort || port > MaxPort {
+		return 0, fmt.Errorf("%q is not a valid port, ports must be "+
+			"between %d and %d", text, MinPort, MaxPort)
+	}
+	return uint32(port), nil
+}
+
+// hostSubnet returns the subnet containing only the given address.
+func hostSubnet(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String() + "/32"
+	}
+	return ip.String() + "/128"
+}